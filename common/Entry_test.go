@@ -4,6 +4,7 @@
 package common
 
 import (
+    "bytes"
     "testing"
     "fmt"
 )
@@ -21,6 +22,7 @@ func TestEntryMarshal(t *testing.T) {
    
     e := new(Entry)
     e.Version = byte(255)
+    e.ChainID = new(Hash)
     e.ChainID.Bytes = make([]byte,32,32)
     for i:=0; i<32; i++ {
        e.ChainID.Bytes[i] = byte(i+1)
@@ -38,3 +40,44 @@ func TestEntryMarshal(t *testing.T) {
     fmt.Println()
 }
 
+func TestEntryUnmarshal(t *testing.T) {
+	e := new(Entry)
+	e.ChainID = Sha([]byte("chain"))
+	e.ExtIDs = [][]byte{[]byte("one"), {}, []byte("three")}
+	e.Data = []byte("some data")
+
+	data, err := e.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e2 := new(Entry)
+	if err := e2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if !e2.ChainID.IsSameAs(e.ChainID) {
+		t.Errorf("ChainID %v != %v", e2.ChainID, e.ChainID)
+	}
+	if len(e2.ExtIDs) != len(e.ExtIDs) {
+		t.Fatalf("got %v ExtIDs, expected %v", len(e2.ExtIDs), len(e.ExtIDs))
+	}
+	for i := range e.ExtIDs {
+		if !bytes.Equal(e2.ExtIDs[i], e.ExtIDs[i]) {
+			t.Errorf("ExtID %v is %q, expected %q", i, e2.ExtIDs[i], e.ExtIDs[i])
+		}
+	}
+	if !bytes.Equal(e2.Data, e.Data) {
+		t.Errorf("Data is %q, expected %q", e2.Data, e.Data)
+	}
+
+	data2, _ := e2.MarshalBinary()
+	if !bytes.Equal(data, data2) {
+		t.Errorf("entry does not marshal back to the same binary")
+	}
+
+	// A truncated entry has to be rejected
+	if err := e2.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Errorf("truncated entry was accepted")
+	}
+}
@@ -56,6 +56,7 @@ var msg = map[string][]byte{
 	"RemoveFedServer":    []byte{6, 32},  // The ChainID of the Federated server which is removed from the pool.
 	"AddFedServerKey":    []byte{7, 65},  // Adds an Ed25519 public key to the authority set.
 	"AddFedServerBTCKey": []byte{8, 66},  // Adds a Bitcoin public key hash to the authority set.
+	"SetECPrice":         []byte{9, 8},   // Sets the Entry Credits per KB of entry and per new chain.
 }
 
 // This map gives us a maping of an opcode to its operand size. I could fill out the table
@@ -0,0 +1,205 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestCBlockMarshal(t *testing.T) {
+	chain := &CChain{ChainID: Sha([]byte("ec"))}
+	b, err := CreateCBlock(chain, nil, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b.Header.DBHeight = 7
+
+	pubKey := Sha([]byte("key"))
+	b.AddServerIndexEntry(0)
+	b.AddCBEntry(NewBuyCBEntry(pubKey, Sha([]byte("tx")), 100))
+	b.AddCBEntry(NewPayEntryCBEntry(pubKey, Sha([]byte("entry")), 2, 12345, make([]byte, 64)))
+	b.AddCBEntry(NewPayChainCBEntry(pubKey, Sha([]byte("first")), 11, Sha([]byte("chain")),
+		Sha([]byte("both")), make([]byte, 64)))
+	b.AddEndOfMinuteMarker(1)
+	b.Header.EntryCount = len(b.CBEntries)
+
+	if _, err := b.MarshalBinary(); err == nil {
+		t.Errorf("block marshalled before its header MRs are built")
+	}
+	if err := b.BuildHeaderMRs(NewECBalanceTree(nil)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := b.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b2 := new(CBlock)
+	if err := b2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if b2.Header.DBHeight != 7 || b2.Header.EntryCount != 5 || len(b2.CBEntries) != 5 {
+		t.Fatalf("header changed in marshalling: %+v", b2.Header)
+	}
+
+	pay := b2.CBEntries[2].(*PayEntryCBEntry)
+	if pay.Credits() != 2 || pay.TimeStamp != 12345 || !pay.PublicKey().IsSameAs(pubKey) {
+		t.Errorf("pay entry changed in marshalling: %+v", pay)
+	}
+	if b2.CBEntries[1].Credits() != 100 || b2.CBEntries[3].Credits() != 11 {
+		t.Errorf("credits changed in marshalling")
+	}
+
+	data2, _ := b2.MarshalBinary()
+	if !bytes.Equal(data, data2) {
+		t.Errorf("block marshals differently after a round trip")
+	}
+}
+
+func TestDBlockHeaderMarshal(t *testing.T) {
+	h := &DBlockHeader{
+		NetworkID:     NETWORK_ID_DB,
+		BodyMR:        Sha([]byte("body")),
+		PrevKeyMR:     NewHash(),
+		PrevBlockHash: NewHash(),
+		BlockHeight:   3,
+		EntryCount:    4,
+	}
+
+	data, _ := h.MarshalBinary()
+	if len(data) != h.MarshalledSize() {
+		t.Errorf("marshalled %d bytes, MarshalledSize is %d", len(data), h.MarshalledSize())
+	}
+
+	h2 := new(DBlockHeader)
+	h2.UnmarshalBinary(data)
+	if h2.BlockHeight != 3 || h2.EntryCount != 4 || !h2.BodyMR.IsSameAs(h.BodyMR) {
+		t.Errorf("header changed in marshalling: %+v", h2)
+	}
+}
+
+func TestCBEntryInfoMarshal(t *testing.T) {
+	chain := &CChain{ChainID: Sha([]byte("ec"))}
+	b, _ := CreateCBlock(chain, nil, 5)
+	pubKey := Sha([]byte("key"))
+	b.AddCBEntry(NewBuyCBEntry(pubKey, Sha([]byte("tx")), 100))
+	b.AddEndOfMinuteMarker(1)
+	b.AddEndOfMinuteMarker(2)
+	b.AddCBEntry(NewPayEntryCBEntry(pubKey, Sha([]byte("entry")), 2, 12345, make([]byte, 64)))
+
+	minutes := b.Minutes()
+	if minutes[0] != 0 || minutes[1] != 0 || minutes[2] != 1 || minutes[3] != 2 {
+		t.Errorf("wrong minutes %v", minutes)
+	}
+
+	info := &CBEntryInfo{CBHash: Sha([]byte("block")), DBHeight: 9, Minute: minutes[3], Entry: b.CBEntries[3]}
+	data, err := info.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info2 := new(CBEntryInfo)
+	if err := info2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	pay, ok := info2.Entry.(*PayEntryCBEntry)
+	if !ok || !info2.CBHash.IsSameAs(info.CBHash) || info2.DBHeight != 9 || info2.Minute != 2 ||
+		pay.Credits() != 2 || !pay.PublicKey().IsSameAs(pubKey) {
+		t.Errorf("entry info changed in marshalling: %+v", info2)
+	}
+
+	if err := info2.UnmarshalBinary(data[:HASH_LENGTH]); err == nil {
+		t.Errorf("truncated entry info was unmarshalled")
+	}
+}
+
+func TestCBlockHeaderMRs(t *testing.T) {
+	chain := &CChain{ChainID: Sha([]byte("ec"))}
+	b, _ := CreateCBlock(chain, nil, 5)
+	k1, k2 := Sha([]byte("one")), Sha([]byte("two"))
+	b.AddServerIndexEntry(0)
+	b.AddCBEntry(NewBuyCBEntry(k1, Sha([]byte("tx")), 100))
+	b.AddEndOfMinuteMarker(1)
+	b.AddCBEntry(NewPayEntryCBEntry(k1, Sha([]byte("entry")), 2, 12345, make([]byte, 64)))
+	b.AddCBEntry(NewPayEntryCBEntry(k2, Sha([]byte("entry")), 1, 12345, make([]byte, 64)))
+	b.Header.EntryCount = len(b.CBEntries)
+
+	prior := NewECBalanceTree([]ECBalance{{PublicKey: k2, Credits: 5}})
+
+	next, err := b.ApplyBalances(prior)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, _ := next.Balance(k1); c != 98 {
+		t.Errorf("wrong balance %d", c)
+	}
+	if c, _ := next.Balance(k2); c != 4 {
+		t.Errorf("wrong balance %d", c)
+	}
+	if c, _ := prior.Balance(k2); c != 5 {
+		t.Errorf("balances before the block changed")
+	}
+
+	// Zero Merkle roots are refused once there are entries and balances
+	b.Header.SegmentsMR, b.Header.BalanceMR = NewHash(), NewHash()
+	if err := b.VerifySegmentsMR(); err == nil {
+		t.Errorf("zero SegmentsMR verified")
+	}
+	if err := b.VerifyBalanceMR(next.Root()); err == nil {
+		t.Errorf("zero BalanceMR verified")
+	}
+
+	if err := b.BuildHeaderMRs(prior); err != nil {
+		t.Fatal(err)
+	}
+	if !b.Header.BalanceMR.IsSameAs(next.Root()) {
+		t.Errorf("BalanceMR is not the root of the balances after the block")
+	}
+
+	data, _ := b.MarshalBinary()
+	b2 := new(CBlock)
+	b2.UnmarshalBinary(data)
+	if err := b2.VerifySegmentsMR(); err != nil {
+		t.Error(err)
+	}
+	if err := b2.VerifyBalanceMR(next.Root()); err != nil {
+		t.Error(err)
+	}
+	if err := b2.VerifyBalanceMR(prior.Root()); err == nil {
+		t.Errorf("bad BalanceMR verified")
+	}
+	b2.CBEntries[1] = NewBuyCBEntry(k1, Sha([]byte("other")), 100)
+	if err := b2.VerifySegmentsMR(); err == nil {
+		t.Errorf("bad SegmentsMR verified")
+	}
+}
+
+func TestECBalanceProof(t *testing.T) {
+	for n := 1; n <= 9; n++ {
+		balances := make([]ECBalance, n)
+		for i := range balances {
+			balances[i] = ECBalance{PublicKey: Sha([]byte{byte(i)}), Credits: i * 10}
+		}
+		tree := NewECBalanceTree(balances)
+		root := tree.Root()
+
+		for i := range balances {
+			proof := tree.Proof(balances[i].PublicKey)
+			if proof == nil || proof.Credits != i*10 {
+				t.Fatalf("no proof of balance %d of %d", i, n)
+			}
+			if err := VerifyECBalanceProof(root, proof); err != nil {
+				t.Errorf("balance %d of %d: %v", i, n, err)
+			}
+
+			proof.Credits++
+			if err := VerifyECBalanceProof(root, proof); err == nil {
+				t.Errorf("wrong balance %d of %d verified", i, n)
+			}
+		}
+	}
+
+	tree := NewECBalanceTree(nil)
+	if tree.Proof(Sha([]byte("none"))) != nil {
+		t.Errorf("proof of a missing key")
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	CommitEntrySize = 8 + HASH_LENGTH + 4 + HASH_LENGTH + SIG_LENGTH
+	CommitChainSize = 8 + HASH_LENGTH*3 + 4 + HASH_LENGTH + SIG_LENGTH
+
+	// DefaultCommitWindow is how far the timestamp of a commit may be from
+	// the time it is received
+	DefaultCommitWindow = time.Hour
+)
+
+var (
+	commitWindow     = DefaultCommitWindow
+	commitWindowLock sync.RWMutex
+)
+
+// GetCommitWindow returns how far the timestamp of a commit may be from the
+// time it is received
+func GetCommitWindow() time.Duration {
+	commitWindowLock.RLock()
+	defer commitWindowLock.RUnlock()
+
+	return commitWindow
+}
+
+// SetCommitWindow changes how far the timestamp of a commit may be from the
+// time it is received
+func SetCommitWindow(window time.Duration) error {
+	if window <= 0 {
+		return errors.New("The commit window has to be positive")
+	}
+
+	commitWindowLock.Lock()
+	defer commitWindowLock.Unlock()
+
+	commitWindow = window
+	return nil
+}
+
+// CheckCommitTimestamp makes sure a commit timestamp, in seconds since 1970,
+// is no further than window from now
+func CheckCommitTimestamp(timestamp uint64, now time.Time, window time.Duration) error {
+	t := time.Unix(int64(timestamp), 0)
+	if t.Before(now.Add(-window)) {
+		return fmt.Errorf("Commit timestamp %d is too old", timestamp)
+	}
+	if t.After(now.Add(window)) {
+		return fmt.Errorf("Commit timestamp %d is in the future", timestamp)
+	}
+	return nil
+}
+
+// CommitEntry pays for an entry before it is revealed. The commit is built
+// and signed by the owner of the Entry Credits, so the server only has to
+// check the signature.
+type CommitEntry struct {
+	Timestamp uint64 // 8  Seconds since 1970
+	EntryHash *Hash  // 32 Sha of the binary entry
+	Credits   uint32 // 4  Credits paid for the entry
+	ECPubKey  *Hash  // 32 Entry Credit public key
+	Sig       []byte // 64 Signature of the first 44 bytes
+}
+
+// MarshalBinarySig returns the part of the commit covered by the signature
+func (c *CommitEntry) MarshalBinarySig() ([]byte, error) {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.BigEndian, c.Timestamp)
+	buf.Write(c.EntryHash.Bytes)
+	binary.Write(&buf, binary.BigEndian, c.Credits)
+
+	return buf.Bytes(), nil
+}
+
+func (c *CommitEntry) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+
+	data, err := c.MarshalBinarySig()
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(data)
+
+	buf.Write(c.ECPubKey.Bytes)
+	buf.Write(c.Sig)
+
+	return buf.Bytes(), nil
+}
+
+func (c *CommitEntry) MarshalledSize() int {
+	return CommitEntrySize
+}
+
+func (c *CommitEntry) UnmarshalBinary(data []byte) (err error) {
+	if len(data) != CommitEntrySize {
+		return fmt.Errorf("Entry commit must be %d bytes, not %d", CommitEntrySize, len(data))
+	}
+
+	c.Timestamp, data = binary.BigEndian.Uint64(data[0:8]), data[8:]
+	c.EntryHash, data = UnmarshalHash(data)
+	c.Credits, data = binary.BigEndian.Uint32(data[0:4]), data[4:]
+	c.ECPubKey, data = UnmarshalHash(data)
+
+	c.Sig = make([]byte, SIG_LENGTH)
+	copy(c.Sig, data)
+
+	return nil
+}
+
+// Sign fills in the public key and signature of the commit
+func (c *CommitEntry) Sign(key Signer) error {
+	data, err := c.MarshalBinarySig()
+	if err != nil {
+		return err
+	}
+
+	sig := key.Sign(data)
+	c.ECPubKey = &Hash{Bytes: sig.Key()}
+	c.Sig = sig.Sig[:]
+
+	return nil
+}
+
+// VerifySignature returns true iff Sig is a valid signature of the commit
+// by ECPubKey.
+func (c *CommitEntry) VerifySignature() bool {
+	if c.EntryHash == nil || c.ECPubKey == nil {
+		return false
+	}
+
+	data, err := c.MarshalBinarySig()
+	if err != nil {
+		return false
+	}
+
+	return VerifySlice(c.ECPubKey.Bytes, data, c.Sig)
+}
+
+// Validate checks the signature of the commit, and that it was made within
+// window of now.
+func (c *CommitEntry) Validate(now time.Time, window time.Duration) error {
+	if !c.VerifySignature() {
+		return errors.New("Invalid signature on entry commit")
+	}
+	return CheckCommitTimestamp(c.Timestamp, now, window)
+}
+
+// CommitChain pays for a new chain and its first entry before they are
+// revealed.
+type CommitChain struct {
+	Timestamp        uint64 // 8  Seconds since 1970
+	ChainID          *Hash  // 32
+	EntryHash        *Hash  // 32 Sha of the binary first entry
+	EntryChainIDHash *Hash  // 32 Sha(ChainID + EntryHash)
+	Credits          uint32 // 4  Credits paid for the chain and entry
+	ECPubKey         *Hash  // 32 Entry Credit public key
+	Sig              []byte // 64 Signature of the first 108 bytes
+}
+
+// MarshalBinarySig returns the part of the commit covered by the signature
+func (c *CommitChain) MarshalBinarySig() ([]byte, error) {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.BigEndian, c.Timestamp)
+	buf.Write(c.ChainID.Bytes)
+	buf.Write(c.EntryHash.Bytes)
+	buf.Write(c.EntryChainIDHash.Bytes)
+	binary.Write(&buf, binary.BigEndian, c.Credits)
+
+	return buf.Bytes(), nil
+}
+
+func (c *CommitChain) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+
+	data, err := c.MarshalBinarySig()
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(data)
+
+	buf.Write(c.ECPubKey.Bytes)
+	buf.Write(c.Sig)
+
+	return buf.Bytes(), nil
+}
+
+func (c *CommitChain) MarshalledSize() int {
+	return CommitChainSize
+}
+
+func (c *CommitChain) UnmarshalBinary(data []byte) (err error) {
+	if len(data) != CommitChainSize {
+		return fmt.Errorf("Chain commit must be %d bytes, not %d", CommitChainSize, len(data))
+	}
+
+	c.Timestamp, data = binary.BigEndian.Uint64(data[0:8]), data[8:]
+	c.ChainID, data = UnmarshalHash(data)
+	c.EntryHash, data = UnmarshalHash(data)
+	c.EntryChainIDHash, data = UnmarshalHash(data)
+	c.Credits, data = binary.BigEndian.Uint32(data[0:4]), data[4:]
+	c.ECPubKey, data = UnmarshalHash(data)
+
+	c.Sig = make([]byte, SIG_LENGTH)
+	copy(c.Sig, data)
+
+	return nil
+}
+
+// Sign fills in the public key and signature of the commit
+func (c *CommitChain) Sign(key Signer) error {
+	data, err := c.MarshalBinarySig()
+	if err != nil {
+		return err
+	}
+
+	sig := key.Sign(data)
+	c.ECPubKey = &Hash{Bytes: sig.Key()}
+	c.Sig = sig.Sig[:]
+
+	return nil
+}
+
+// VerifySignature returns true iff Sig is a valid signature of the commit
+// by ECPubKey.
+func (c *CommitChain) VerifySignature() bool {
+	if c.ChainID == nil || c.EntryHash == nil || c.EntryChainIDHash == nil || c.ECPubKey == nil {
+		return false
+	}
+
+	data, err := c.MarshalBinarySig()
+	if err != nil {
+		return false
+	}
+
+	return VerifySlice(c.ECPubKey.Bytes, data, c.Sig)
+}
+
+// Validate checks the signature of the commit, the binding of the first entry
+// to the chain, and that the commit was made within window of now.
+func (c *CommitChain) Validate(now time.Time, window time.Duration) error {
+	if !c.VerifySignature() {
+		return errors.New("Invalid signature on chain commit")
+	}
+	if !c.EntryChainIDHash.IsSameAs(GetEntryChainIDHash(c.ChainID, c.EntryHash)) {
+		return errors.New("EntryChainIDHash does not match the ChainID and EntryHash")
+	}
+	return CheckCommitTimestamp(c.Timestamp, now, window)
+}
+
+// GetEntryChainIDHash returns the hash binding a first entry to its chain,
+// as used in CommitChain.
+func GetEntryChainIDHash(chainID *Hash, entryHash *Hash) *Hash {
+	data := make([]byte, 0, HASH_LENGTH*2)
+	data = append(data, chainID.Bytes...)
+	data = append(data, entryHash.Bytes...)
+	return Sha(data)
+}
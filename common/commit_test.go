@@ -0,0 +1,121 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestCommitEntry(t *testing.T) {
+	priv := new(PrivateKey)
+	if err := priv.GenerateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := new(CommitEntry)
+	c.Timestamp = 1428000000
+	c.EntryHash = Sha([]byte("entry"))
+	c.Credits = 1
+	if err := c.Sign(priv); err != nil {
+		t.Fatal(err)
+	}
+	if !c.VerifySignature() {
+		t.Fatalf("signature of a signed commit does not verify")
+	}
+
+	data, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != CommitEntrySize {
+		t.Fatalf("commit is %v bytes, expected %v", len(data), CommitEntrySize)
+	}
+
+	c2 := new(CommitEntry)
+	if err := c2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !c2.VerifySignature() {
+		t.Errorf("signature does not verify after unmarshalling")
+	}
+	data2, _ := c2.MarshalBinary()
+	if !bytes.Equal(data, data2) {
+		t.Errorf("commit does not marshal back to the same binary")
+	}
+
+	c2.Credits++
+	if c2.VerifySignature() {
+		t.Errorf("signature verifies for a changed commit")
+	}
+}
+
+func TestCommitChain(t *testing.T) {
+	priv := new(PrivateKey)
+	if err := priv.GenerateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	c := new(CommitChain)
+	c.Timestamp = 1428000000
+	c.ChainID = Sha([]byte("chain"))
+	c.EntryHash = Sha([]byte("entry"))
+	c.EntryChainIDHash = GetEntryChainIDHash(c.ChainID, c.EntryHash)
+	c.Credits = 11
+	if err := c.Sign(priv); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c2 := new(CommitChain)
+	if err := c2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !c2.VerifySignature() {
+		t.Errorf("signature does not verify after unmarshalling")
+	}
+
+	c2.ChainID = Sha([]byte("other chain"))
+	if c2.VerifySignature() {
+		t.Errorf("signature verifies for a changed commit")
+	}
+}
+
+func TestCommitValidate(t *testing.T) {
+	priv := new(PrivateKey)
+	if err := priv.GenerateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1428000000, 0)
+	c := new(CommitEntry)
+	c.EntryHash = Sha([]byte("entry"))
+	c.Credits = 1
+
+	for _, tc := range []struct {
+		offset time.Duration
+		valid  bool
+	}{
+		{0, true},
+		{-59 * time.Minute, true},
+		{59 * time.Minute, true},
+		{-61 * time.Minute, false},
+		{61 * time.Minute, false},
+	} {
+		c.Timestamp = uint64(now.Add(tc.offset).Unix())
+		c.Sign(priv)
+		if err := c.Validate(now, time.Hour); (err == nil) != tc.valid {
+			t.Errorf("commit %v from now: %v", tc.offset, err)
+		}
+	}
+
+	c.Timestamp = uint64(now.Unix())
+	c.Sign(priv)
+	c.Timestamp++
+	if err := c.Validate(now, time.Hour); err == nil {
+		t.Errorf("commit with a changed timestamp validated")
+	}
+}
@@ -50,6 +50,16 @@ const (
 	TYPE_REMOVE_FED_SERVER
 	TYPE_ADD_FED_SERVER_KEY
 	TYPE_ADD_BTC_ANCHOR_KEY //8
+	TYPE_SET_EC_PRICE
+)
+
+//---------------------------------------------------------------
+// Node modes, set by NodeMode in factomd.conf
+//---------------------------------------------------------------
+const (
+	FULL_NODE   = "FULL"
+	SERVER_NODE = "SERVER"
+	LIGHT_NODE  = "LIGHT"
 )
 
 // Chain Values.  Not exactly constants, but nice to have.
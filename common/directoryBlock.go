@@ -15,9 +15,11 @@ import (
 
 const DBlockVersion = 0
 
+// DChain is the Directory Block chain being built. Only the block being built
+// is kept, the blocks before it are read from the database, which keeps the
+// recent ones in its cache (see database/cachedb).
 type DChain struct {
 	ChainID         *Hash
-	Blocks          []*DirectoryBlock
 	BlockMutex      sync.Mutex
 	NextBlock       *DirectoryBlock
 	NextBlockHeight uint32
@@ -199,7 +201,6 @@ func (b *DBlockHeader) UnmarshalBinary(data []byte) (err error) {
 	b.PrevBlockHash, data = UnmarshalHash(data)
 
 	b.BlockHeight, data = binary.BigEndian.Uint32(data[0:4]), data[4:]
-	b.StartTime, data = binary.BigEndian.Uint64(data[0:8]), data[8:]
 	b.EntryCount, data = binary.BigEndian.Uint32(data[0:4]), data[4:]
 
 	return nil
@@ -291,26 +292,6 @@ func (c *DChain) AddFBlockMRToDBEntry(dbEntry *DBEntry) (err error) {
 	return nil
 }
 
-// Add DBlock to the chain in memory
-func (c *DChain) AddDBlockToDChain(b *DirectoryBlock) (err error) {
-
-	// Increase the slice capacity if needed
-	if b.Header.BlockHeight >= uint32(cap(c.Blocks)) {
-		temp := make([]*DirectoryBlock, len(c.Blocks), b.Header.BlockHeight*2)
-		copy(temp, c.Blocks)
-		c.Blocks = temp
-	}
-
-	// Increase the slice length if needed
-	if b.Header.BlockHeight >= uint32(len(c.Blocks)) {
-		c.Blocks = c.Blocks[0 : b.Header.BlockHeight+1]
-	}
-
-	c.Blocks[b.Header.BlockHeight] = b
-
-	return nil
-}
-
 func (b *DirectoryBlock) MarshalBinary() (data []byte, err error) {
 	var buf bytes.Buffer
 
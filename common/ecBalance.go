@@ -0,0 +1,169 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// ECBalanceTree is the sorted Merkle tree of the entry credit balances of all
+// public keys. Its root is the BalanceMR of the entry credit block after which
+// the balances hold.
+type ECBalanceTree struct {
+	balances []ECBalance // sorted by public key
+}
+
+// ECBalanceProof shows that a public key has a balance in the tree with a
+// given root
+type ECBalanceProof struct {
+	PublicKey *Hash
+	Credits   int
+
+	// Index is the position of the balance in the tree, and Branch the
+	// hashes next to it on the way up to the root
+	Index  uint32
+	Branch []*Hash
+
+	Root *Hash
+
+	// DBHeight is the height of the entry credit block whose BalanceMR is
+	// the Root
+	DBHeight uint32
+}
+
+// NewECBalanceTree builds a tree holding balances
+func NewECBalanceTree(balances []ECBalance) *ECBalanceTree {
+	t := new(ECBalanceTree)
+	t.balances = make([]ECBalance, len(balances))
+	copy(t.balances, balances)
+	sort.Sort(byPublicKey(t.balances))
+
+	return t
+}
+
+// Copy returns a tree with the same balances that can be updated separately
+func (t *ECBalanceTree) Copy() *ECBalanceTree {
+	return NewECBalanceTree(t.balances)
+}
+
+// Balances returns the balances in the tree, sorted by public key
+func (t *ECBalanceTree) Balances() []ECBalance {
+	return t.balances
+}
+
+// Balance returns the balance of a public key, 0 if it is not in the tree. It
+// is an ECBalanceFunc.
+func (t *ECBalanceTree) Balance(pubKey *Hash) (credits int, err error) {
+	if i, ok := t.find(pubKey); ok {
+		return t.balances[i].Credits, nil
+	}
+	return 0, nil
+}
+
+// Update sets the balances of public keys, adding the keys not in the tree yet
+func (t *ECBalanceTree) Update(balances []ECBalance) {
+	for _, b := range balances {
+		i, ok := t.find(b.PublicKey)
+		if ok {
+			t.balances[i].Credits = b.Credits
+			continue
+		}
+
+		t.balances = append(t.balances, ECBalance{})
+		copy(t.balances[i+1:], t.balances[i:])
+		t.balances[i] = b
+	}
+}
+
+// Root returns the Merkle root of the tree
+func (t *ECBalanceTree) Root() *Hash {
+	return BuildBalanceMR(t.balances)
+}
+
+// Proof returns the proof of the balance of a public key, or nil if the key is
+// not in the tree
+func (t *ECBalanceTree) Proof(pubKey *Hash) *ECBalanceProof {
+	index, ok := t.find(pubKey)
+	if !ok {
+		return nil
+	}
+
+	hashes := make([]*Hash, len(t.balances))
+	for i := range t.balances {
+		data, _ := t.balances[i].MarshalBinary()
+		hashes[i] = Sha(data)
+	}
+	merkles := BuildMerkleTreeStore(hashes)
+
+	proof := &ECBalanceProof{
+		PublicKey: t.balances[index].PublicKey,
+		Credits:   t.balances[index].Credits,
+		Index:     uint32(index),
+		Branch:    make([]*Hash, 0, 32),
+		Root:      merkles[len(merkles)-1],
+	}
+
+	// Walk up the levels of the tree, which BuildMerkleTreeStore lays out one
+	// after the other. A node without a right sibling is hashed with itself.
+	offset, width := 0, nextPowerOfTwo(len(hashes))
+	for width > 1 {
+		sibling := merkles[offset+(index^1)]
+		if sibling == nil {
+			sibling = merkles[offset+index]
+		}
+		proof.Branch = append(proof.Branch, sibling)
+
+		offset += width
+		width /= 2
+		index /= 2
+	}
+
+	return proof
+}
+
+// find returns the position of a public key in the tree, or where it would be
+// inserted
+func (t *ECBalanceTree) find(pubKey *Hash) (int, bool) {
+	i := sort.Search(len(t.balances), func(i int) bool {
+		return bytes.Compare(t.balances[i].PublicKey.Bytes, pubKey.Bytes) >= 0
+	})
+	return i, i < len(t.balances) && t.balances[i].PublicKey.IsSameAs(pubKey)
+}
+
+// VerifyECBalanceProof checks that a proof leads from the balance to root
+func VerifyECBalanceProof(root *Hash, proof *ECBalanceProof) error {
+	if proof == nil || proof.PublicKey == nil {
+		return errors.New("Missing balance proof")
+	}
+
+	balance := &ECBalance{PublicKey: proof.PublicKey, Credits: proof.Credits}
+	data, err := balance.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	hash := Sha(data)
+
+	index := proof.Index
+	for _, sibling := range proof.Branch {
+		if sibling == nil {
+			return errors.New("Missing hash in balance proof")
+		}
+		if index&1 == 0 {
+			hash = hashMerkleBranches(hash, sibling)
+		} else {
+			hash = hashMerkleBranches(sibling, hash)
+		}
+		index /= 2
+	}
+
+	if index != 0 || !hash.IsSameAs(root) {
+		return fmt.Errorf("Balance proof of %s does not match root %s",
+			proof.PublicKey.String(), root.String())
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package common
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEChainMarshal(t *testing.T) {
+	c := new(EChain)
+	c.Name = [][]byte{[]byte("one"), []byte("two")}
+	c.ChainID, _ = GetChainID(c.Name)
+	c.FirstEntryHash = Sha([]byte("entry"))
+	c.CreatedHeight = 5
+	c.EBlockCount = 3
+	c.EntryCount = 12
+	c.LastHeight = 9
+
+	data, err := c.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c2 := new(EChain)
+	if err := c2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if !c2.ChainID.IsSameAs(c.ChainID) || !c2.FirstEntryHash.IsSameAs(c.FirstEntryHash) ||
+		len(c2.Name) != 2 || !bytes.Equal(c2.Name[1], c.Name[1]) ||
+		c2.CreatedHeight != 5 || c2.EBlockCount != 3 || c2.EntryCount != 12 ||
+		c2.LastHeight != 9 || c2.FirstEntry != nil {
+		t.Errorf("chain changed in marshalling: %+v", c2)
+	}
+
+	c.FirstEntry = &Entry{ChainID: c.ChainID, ExtIDs: c.Name, Data: []byte("data")}
+	data, err = c.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c2.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+	if c2.FirstEntry == nil || !bytes.Equal(c2.FirstEntry.Data, c.FirstEntry.Data) {
+		t.Errorf("first entry lost in marshalling")
+	}
+
+	if err := c2.UnmarshalBinary(data[:len(data)-1]); err == nil {
+		t.Errorf("truncated chain was unmarshalled")
+	}
+}
+
+func TestIsEndOfMinuteMarker(t *testing.T) {
+	b := new(EBlock)
+	b.AddEndOfMinuteMarker(3)
+	if !IsEndOfMinuteMarker(b.EBEntries[0].EntryHash) {
+		t.Errorf("minute marker not recognised")
+	}
+	if IsEndOfMinuteMarker(Sha([]byte("entry"))) {
+		t.Errorf("entry hash taken for a minute marker")
+	}
+}
@@ -65,6 +65,10 @@ func (e *Entry) MarshalBinary() ([]byte, error) {
 }
 
 func (e *Entry) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < 37 {
+		return fmt.Errorf("Entry is too short")
+	}
+
 	// Get the Version byte
 	e.Version, data = data[0], data[1:]
 	// Get the ChainID
@@ -73,36 +77,35 @@ func (e *Entry) UnmarshalBinary(data []byte) (err error) {
 	e.ExIDSize,    data = binary.BigEndian.Uint16(data[0:2]), data[2:]
 	e.PayloadSize, data = binary.BigEndian.Uint16(data[0:2]), data[2:]
 
-	if len(data) > 10240 || uint16(len(data)) != e.PayloadSize+37 {
+	if e.PayloadSize > MAX_ENTRY_SIZE || len(data) != int(e.PayloadSize) {
 		return fmt.Errorf("Data is too long, or Lengths don't add up")
 	} else if e.ExIDSize > e.PayloadSize {
 		return fmt.Errorf("External IDs are longer than the payload size")
 	}
 
-	var size, cnt uint16
-	datas := data
-	for size < e.ExIDSize {
-		cnt++
-		eid_len, datas := binary.BigEndian.Uint16(datas[0:2]), datas[2:]
-		size += eid_len
-		if size > e.ExIDSize {
+	// Each External ID is a 2 byte length followed by the ID itself, and
+	// together they have to fill ExIDSize exactly.
+	e.ExtIDs = make([][]byte, 0)
+	exIDs := data[:e.ExIDSize]
+	for len(exIDs) > 0 {
+		if len(exIDs) < 2 {
 			return fmt.Errorf("Invalid External IDs")
 		}
-		datas = datas[eid_len:]
-	} // we only get out of this nice when size == e.ExIDSize.
-	// Otherwise we get an error.
-	
-	e.ExtIDs = make([][]byte, cnt, cnt)
-	for i := uint16(0); i < cnt; i++ {
-		eid_len, data := binary.BigEndian.Uint16(data[0:2]), data[2:]
-		e.ExtIDs[i] = make([]byte, eid_len, eid_len)
-		copy(e.ExtIDs[i], data[0:eid_len])
-		data = data[eid_len:]
+		eid_len := int(binary.BigEndian.Uint16(exIDs[0:2]))
+		exIDs = exIDs[2:]
+		if eid_len > len(exIDs) {
+			return fmt.Errorf("Invalid External IDs")
+		}
+
+		exID := make([]byte, eid_len, eid_len)
+		copy(exID, exIDs[:eid_len])
+		e.ExtIDs = append(e.ExtIDs, exID)
+		exIDs = exIDs[eid_len:]
 	}
 
 	data_len := e.PayloadSize - e.ExIDSize
 	e.Data = make([]byte, data_len, data_len)
-	copy(e.Data, data)
+	copy(e.Data, data[e.ExIDSize:])
 
 	return nil
 }
@@ -20,13 +20,21 @@ const (
 	Separator       = "/"
 )
 
-// Used for communication via the APIs
+// Used for communication via the APIs, and as the chain record kept in the
+// database
 type EChain struct {
 
 	ChainID *Hash
 	Name       [][]byte
 	FirstEntry *Entry
 
+	// Chain record, maintained as EBlocks are stored
+	FirstEntryHash *Hash
+	CreatedHeight  uint32 // DBlock height of the first EBlock
+	EBlockCount    uint32
+	EntryCount     uint32 // Entries, not counting minute markers
+	LastHeight     uint32 // DBlock height of the newest EBlock
+
 	//Not Marshalized
 	//Blocks       []*EBlock
 	NextBlock       *EBlock
@@ -128,7 +136,6 @@ func (b *EBlockHeader) MarshalledSize() int {
 }
 
 func (b *EBlockHeader) UnmarshalBinary(data []byte) (err error) {
-fmt.Println("Here Unmarshal EBblock header")
 	b.Version, data = data[0], data[1:]
 
 	b.ChainID,data = UnmarshalHash(data)
@@ -143,6 +150,108 @@ fmt.Println("Here Unmarshal EBblock header")
 	return nil
 }
 
+func (c *EChain) EncodableFields() map[string]reflect.Value {
+	fields := map[string]reflect.Value{
+		`ChainID`:        reflect.ValueOf(c.ChainID),
+		`Name`:           reflect.ValueOf(c.Name),
+		`FirstEntryHash`: reflect.ValueOf(c.FirstEntryHash),
+		`CreatedHeight`:  reflect.ValueOf(c.CreatedHeight),
+		`EBlockCount`:    reflect.ValueOf(c.EBlockCount),
+		`EntryCount`:     reflect.ValueOf(c.EntryCount),
+		`LastHeight`:     reflect.ValueOf(c.LastHeight),
+	}
+	return fields
+}
+
+func (c *EChain) MarshalBinary() (data []byte, err error) {
+	var buf bytes.Buffer
+
+	buf.Write(c.ChainID.Bytes)
+
+	binary.Write(&buf, binary.BigEndian, uint16(len(c.Name)))
+	for _, name := range c.Name {
+		binary.Write(&buf, binary.BigEndian, uint16(len(name)))
+		buf.Write(name)
+	}
+
+	if c.FirstEntryHash == nil {
+		buf.Write(NewHash().Bytes)
+	} else {
+		buf.Write(c.FirstEntryHash.Bytes)
+	}
+
+	binary.Write(&buf, binary.BigEndian, c.CreatedHeight)
+	binary.Write(&buf, binary.BigEndian, c.EBlockCount)
+	binary.Write(&buf, binary.BigEndian, c.EntryCount)
+	binary.Write(&buf, binary.BigEndian, c.LastHeight)
+
+	// The first entry is only carried while a new chain is revealed
+	if c.FirstEntry == nil {
+		binary.Write(&buf, binary.BigEndian, uint16(0))
+	} else {
+		data, err = c.FirstEntry.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		binary.Write(&buf, binary.BigEndian, uint16(len(data)))
+		buf.Write(data)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (c *EChain) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < HASH_LENGTH+2 {
+		return fmt.Errorf("Chain is too short")
+	}
+
+	c.ChainID, data = UnmarshalHash(data)
+
+	count, data := binary.BigEndian.Uint16(data[0:2]), data[2:]
+	c.Name = make([][]byte, count)
+	for i := range c.Name {
+		if len(data) < 2 {
+			return fmt.Errorf("Invalid chain name")
+		}
+		size := int(binary.BigEndian.Uint16(data[0:2]))
+		data = data[2:]
+		if len(data) < size {
+			return fmt.Errorf("Invalid chain name")
+		}
+		c.Name[i] = make([]byte, size)
+		copy(c.Name[i], data[:size])
+		data = data[size:]
+	}
+
+	if len(data) < HASH_LENGTH+18 {
+		return fmt.Errorf("Chain is too short")
+	}
+
+	c.FirstEntryHash, data = UnmarshalHash(data)
+	if c.FirstEntryHash.IsSameAs(NewHash()) {
+		c.FirstEntryHash = nil
+	}
+
+	c.CreatedHeight, data = binary.BigEndian.Uint32(data[0:4]), data[4:]
+	c.EBlockCount, data = binary.BigEndian.Uint32(data[0:4]), data[4:]
+	c.EntryCount, data = binary.BigEndian.Uint32(data[0:4]), data[4:]
+	c.LastHeight, data = binary.BigEndian.Uint32(data[0:4]), data[4:]
+
+	size, data := int(binary.BigEndian.Uint16(data[0:2])), data[2:]
+	c.FirstEntry = nil
+	if size > 0 {
+		if len(data) < size {
+			return fmt.Errorf("Invalid first entry")
+		}
+		c.FirstEntry = new(Entry)
+		if err = c.FirstEntry.UnmarshalBinary(data[:size]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func CreateBlock(chain *EChain, prev *EBlock, capacity uint) (b *EBlock, err error) {
 	if prev == nil && chain.NextBlockHeight != 0 {
 		return nil, errors.New("Previous block cannot be nil")
@@ -190,16 +299,38 @@ func (b *EBlock) AddEBEntry(e *Entry) (err error) {
 }
 
 func (b *EBlock) AddEndOfMinuteMarker(eomType byte) (err error) {
+	ebEntry := NewEBEntry(endOfMinuteMarker(eomType))
+
+	b.EBEntries = append(b.EBEntries, ebEntry)
+
+	return
+}
+
+// endOfMinuteMarker returns the EBEntry hash marking the end of a minute
+func endOfMinuteMarker(eomType byte) *Hash {
 	bytes := make([]byte, 32)
 	bytes[31] = eomType
 
 	h, _ := NewShaHash(bytes)
+	return h
+}
 
-	ebEntry := NewEBEntry(h)
-
-	b.EBEntries = append(b.EBEntries, ebEntry)
-
-	return
+var endOfMinuteMarkers = func() map[HashF]bool {
+	markers := make(map[HashF]bool)
+	for i := 0; i < 256; i++ {
+		var key HashF
+		key.From(endOfMinuteMarker(byte(i)))
+		markers[key] = true
+	}
+	return markers
+}()
+
+// IsEndOfMinuteMarker returns true if h is an end of minute marker rather
+// than the hash of an entry.
+func IsEndOfMinuteMarker(h *Hash) bool {
+	var key HashF
+	key.From(h)
+	return endOfMinuteMarkers[key]
 }
 
 func (block *EBlock) BuildMerkleRoot() (err error) {
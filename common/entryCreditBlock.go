@@ -4,6 +4,8 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"sort"
 	"sync"
 )
 
@@ -48,6 +50,44 @@ type CBInfo struct {
 	ChainID    *Hash
 }
 
+// CBEntryInfo is an entry credit block entry together with the block and
+// minute it was recorded in
+type CBEntryInfo struct {
+	CBHash   *Hash
+	DBHeight uint32
+	Minute   byte
+	Entry    CBEntry
+}
+
+func (e *CBEntryInfo) MarshalBinary() (data []byte, err error) {
+	var buf bytes.Buffer
+
+	buf.Write(e.CBHash.Bytes)
+	binary.Write(&buf, binary.BigEndian, e.DBHeight)
+	buf.Write([]byte{e.Minute})
+
+	data, err = e.Entry.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(data)
+
+	return buf.Bytes(), nil
+}
+
+func (e *CBEntryInfo) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < HASH_LENGTH+5 {
+		return errors.New("Entry credit block entry info is too short")
+	}
+
+	e.CBHash, data = UnmarshalHash(data)
+	e.DBHeight, data = binary.BigEndian.Uint32(data[0:4]), data[4:]
+	e.Minute, data = data[0], data[1:]
+
+	e.Entry, err = UnmarshalCBEntry(data)
+	return err
+}
+
 func CreateCBlock(chain *CChain, prev *CBlock, cap uint) (b *CBlock, err error) {
 	if prev == nil && chain.NextBlockHeight != 0 {
 		return nil, errors.New("Previous block cannot be nil")
@@ -66,19 +106,23 @@ func CreateCBlock(chain *CChain, prev *CBlock, cap uint) (b *CBlock, err error)
 		b.Header.BodyHash = NewHash()
 	} else {
 		if prev.MerkleRoot == nil {
-			prev.BuildMerkleRoot()
+			if err := prev.BuildMerkleRoot(); err != nil {
+				return nil, err
+			}
 		}
 		b.Header.PrevKeyMR = prev.MerkleRoot
 
 		if prev.CBHash == nil {
-			prev.BuildCBHash()
+			if err := prev.BuildCBHash(); err != nil {
+				return nil, err
+			}
 		}
 		b.Header.PrevHash = prev.CBHash
 	}
 
+	// The SegmentsMR and BalanceMR are set by BuildHeaderMRs once the
+	// entries are in, and the block cannot be marshalled before
 	b.Header.DBHeight = chain.NextBlockHeight
-	b.Header.SegmentsMR = NewHash()
-	b.Header.BalanceMR = NewHash()
 	b.Chain = chain
 	b.CBEntries = make([]CBEntry, 0, cap)
 
@@ -89,7 +133,10 @@ func (b *CBlock) BuildMerkleRoot() (err error) {
 
 	// Create the Entry Block Key Merkle Root from the hash of Header and the Body Merkle Root
 	hashes := make([]*Hash, 0, 2)
-	binaryEBHeader, _ := b.Header.MarshalBinary()
+	binaryEBHeader, err := b.Header.MarshalBinary()
+	if err != nil {
+		return err
+	}
 	hashes = append(hashes, Sha(binaryEBHeader))
 	hashes = append(hashes, b.Header.BodyHash)
 	merkle := BuildMerkleTreeStore(hashes)
@@ -100,7 +147,10 @@ func (b *CBlock) BuildMerkleRoot() (err error) {
 
 func (b *CBlock) BuildCBHash() (err error) {
 
-	binaryEB, _ := b.MarshalBinary()
+	binaryEB, err := b.MarshalBinary()
+	if err != nil {
+		return err
+	}
 	b.CBHash = Sha(binaryEB)
 
 	return
@@ -117,6 +167,157 @@ func (b *CBlock) BuildCBBodyHash() (bodyHash *Hash, err error) {
 	return bodyHash, nil
 }
 
+// BuildSegmentsMR computes the Merkle root over the minute segments of the
+// block. A segment ends with an end of minute marker or just before a server
+// index entry. A block without entries has a zero SegmentsMR.
+func (b *CBlock) BuildSegmentsMR() (segmentsMR *Hash, err error) {
+	segments := make([]*Hash, 0, 10)
+	var buf bytes.Buffer
+
+	endSegment := func() {
+		if buf.Len() > 0 {
+			segments = append(segments, Sha(buf.Bytes()))
+			buf.Reset()
+		}
+	}
+
+	for _, e := range b.CBEntries {
+		if e.Type() == TYPE_SERVER_INDEX {
+			endSegment()
+		}
+
+		data, err := e.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+
+		if e.Type() == TYPE_MINUTE_NUMBER {
+			endSegment()
+		}
+	}
+	endSegment()
+
+	if len(segments) == 0 {
+		return NewHash(), nil
+	}
+	merkle := BuildMerkleTreeStore(segments)
+	return merkle[len(merkle)-1], nil
+}
+
+// ECBalanceFunc returns the entry credit balance of a public key before a
+// block
+type ECBalanceFunc func(pubKey *Hash) (credits int, err error)
+
+// Balances applies the purchases and payments of the block to the balances
+// before it, and returns the balances of every public key in the block after
+// it, sorted by public key.
+func (b *CBlock) Balances(prior ECBalanceFunc) (balances []ECBalance, err error) {
+	credits := make(map[HashF]int)
+	for _, e := range b.CBEntries {
+		pubKey := e.PublicKey()
+		if pubKey == nil {
+			continue
+		}
+
+		var key HashF
+		key.From(pubKey)
+		balance, ok := credits[key]
+		if !ok {
+			balance, err = prior(pubKey)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		if e.Type() == TYPE_BUY {
+			balance += e.Credits()
+		} else {
+			balance -= e.Credits()
+		}
+		credits[key] = balance
+	}
+
+	balances = make([]ECBalance, 0, len(credits))
+	for key, balance := range credits {
+		pubKey := key.Hash()
+		balances = append(balances, ECBalance{PublicKey: &pubKey, Credits: balance})
+	}
+	sort.Sort(byPublicKey(balances))
+
+	return balances, nil
+}
+
+// BuildBalanceMR computes the Merkle root over balances sorted by public key.
+// No balances give a zero BalanceMR.
+func BuildBalanceMR(balances []ECBalance) *Hash {
+	if len(balances) == 0 {
+		return NewHash()
+	}
+
+	hashes := make([]*Hash, len(balances))
+	for i := range balances {
+		data, _ := balances[i].MarshalBinary()
+		hashes[i] = Sha(data)
+	}
+	merkle := BuildMerkleTreeStore(hashes)
+	return merkle[len(merkle)-1]
+}
+
+// ApplyBalances returns the balance tree after the block, leaving tree, the
+// balances before the block, as it is
+func (b *CBlock) ApplyBalances(tree *ECBalanceTree) (next *ECBalanceTree, err error) {
+	balances, err := b.Balances(tree.Balance)
+	if err != nil {
+		return nil, err
+	}
+
+	next = tree.Copy()
+	next.Update(balances)
+	return next, nil
+}
+
+// BuildHeaderMRs sets the SegmentsMR and BalanceMR of the header from the
+// entries and the balance tree before the block. It has to be called once all
+// of the entries are in the block, and before the block is hashed.
+func (b *CBlock) BuildHeaderMRs(tree *ECBalanceTree) (err error) {
+	b.Header.SegmentsMR, err = b.BuildSegmentsMR()
+	if err != nil {
+		return err
+	}
+
+	next, err := b.ApplyBalances(tree)
+	if err != nil {
+		return err
+	}
+	b.Header.BalanceMR = next.Root()
+
+	return nil
+}
+
+// VerifySegmentsMR checks the SegmentsMR of the header against the entries of
+// the block. A zero SegmentsMR is only right for a block without entries.
+func (b *CBlock) VerifySegmentsMR() error {
+	segmentsMR, err := b.BuildSegmentsMR()
+	if err != nil {
+		return err
+	}
+	if !segmentsMR.IsSameAs(b.Header.SegmentsMR) {
+		return fmt.Errorf("Entry Credit Block at height %d has a bad SegmentsMR", b.Header.DBHeight)
+	}
+	return nil
+}
+
+// VerifyBalanceMR checks the BalanceMR of the header against balanceMR, the
+// root of the balance tree after the block. A zero BalanceMR is only right
+// when there are no balances.
+func (b *CBlock) VerifyBalanceMR(balanceMR *Hash) error {
+	if !balanceMR.IsSameAs(b.Header.BalanceMR) {
+		return fmt.Errorf("Entry Credit Block at height %d has a bad BalanceMR", b.Header.DBHeight)
+	}
+	return nil
+}
+
 func (b *CBlock) AddCBEntry(e CBEntry) (err error) {
 	b.CBEntries = append(b.CBEntries, e)
 	return
@@ -147,7 +348,10 @@ func (b *CBlock) AddServerIndexEntry(serverIndex byte) (err error) {
 func (b *CBlock) MarshalBinary() (data []byte, err error) {
 	var buf bytes.Buffer
 
-	data, _ = b.Header.MarshalBinary()
+	data, err = b.Header.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
 	buf.Write(data)
 
 	for i := 0; i < b.Header.EntryCount; i++ {
@@ -178,18 +382,7 @@ func (b *CBlock) UnmarshalBinary(data []byte) (err error) {
 
 	b.CBEntries = make([]CBEntry, b.Header.EntryCount)
 	for i := 0; i < b.Header.EntryCount; i++ {
-		if data[0] == TYPE_BUY {
-			b.CBEntries[i] = new(BuyCBEntry)
-		} else if data[0] == TYPE_PAY_CHAIN {
-			b.CBEntries[i] = new(PayChainCBEntry)
-		} else if data[0] == TYPE_PAY_ENTRY {
-			b.CBEntries[i] = new(PayEntryCBEntry)
-		} else if data[0] == TYPE_SERVER_INDEX {
-			b.CBEntries[i] = new(ServerIndexEntry)
-		} else if data[0] == TYPE_MINUTE_NUMBER {
-			b.CBEntries[i] = new(EndOfMinuteEntry)
-		}
-		err = b.CBEntries[i].UnmarshalBinary(data)
+		b.CBEntries[i], err = UnmarshalCBEntry(data)
 		if err != nil {
 			return
 		}
@@ -199,9 +392,55 @@ func (b *CBlock) UnmarshalBinary(data []byte) (err error) {
 	return nil
 }
 
+// UnmarshalCBEntry unmarshals an entry credit block entry of any type
+func UnmarshalCBEntry(data []byte) (e CBEntry, err error) {
+	if len(data) == 0 {
+		return nil, errors.New("Missing Entry Credit Block entry")
+	}
+
+	if data[0] == TYPE_BUY {
+		e = new(BuyCBEntry)
+	} else if data[0] == TYPE_PAY_CHAIN {
+		e = new(PayChainCBEntry)
+	} else if data[0] == TYPE_PAY_ENTRY {
+		e = new(PayEntryCBEntry)
+	} else if data[0] == TYPE_SERVER_INDEX {
+		e = new(ServerIndexEntry)
+	} else if data[0] == TYPE_MINUTE_NUMBER {
+		e = new(EndOfMinuteEntry)
+	} else {
+		return nil, fmt.Errorf("Unknown Entry Credit Block entry type %d", data[0])
+	}
+
+	err = e.UnmarshalBinary(data)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Minutes returns the minute of each entry in the block, counting the end of
+// minute markers before it. The markers themselves belong to the minute they
+// close.
+func (b *CBlock) Minutes() []byte {
+	minutes := make([]byte, len(b.CBEntries))
+	var minute byte
+	for i, e := range b.CBEntries {
+		minutes[i] = minute
+		if eom, ok := e.(*EndOfMinuteEntry); ok {
+			minute = eom.EOM_Type
+		}
+	}
+	return minutes
+}
+
 
 
 func (b *CBlockHeader) MarshalBinary() (data []byte, err error) {
+	if b.SegmentsMR == nil || b.BalanceMR == nil {
+		return nil, errors.New("The SegmentsMR and BalanceMR of the Entry Credit Block are not built")
+	}
+
 	var buf bytes.Buffer
 
 	buf.Write(b.ChainID.Bytes)
@@ -209,13 +448,13 @@ func (b *CBlockHeader) MarshalBinary() (data []byte, err error) {
 	buf.Write(b.PrevKeyMR.Bytes)
 	buf.Write(b.PrevHash.Bytes)
 
-	binary.Write(&buf, binary.BigEndian, b.DBHeight)
+	binary.Write(&buf, binary.BigEndian, uint32(b.DBHeight))
 
 	buf.Write(b.SegmentsMR.Bytes)
 	buf.Write(b.BalanceMR.Bytes)
 
-	binary.Write(&buf, binary.BigEndian, b.EntryCount)
-	binary.Write(&buf, binary.BigEndian, b.BodySize)
+	binary.Write(&buf, binary.BigEndian, uint32(b.EntryCount))
+	binary.Write(&buf, binary.BigEndian, uint32(b.BodySize))
 
 	return buf.Bytes(), err
 }
@@ -310,6 +549,28 @@ type ECBalance struct {
 	Credits   int
 }
 
+func (b *ECBalance) MarshalBinary() (data []byte, err error) {
+	var buf bytes.Buffer
+
+	buf.Write(b.PublicKey.Bytes)
+	binary.Write(&buf, binary.BigEndian, int32(b.Credits))
+
+	return buf.Bytes(), nil
+}
+
+// array sorting implementation
+type byPublicKey []ECBalance
+
+func (f byPublicKey) Len() int {
+	return len(f)
+}
+func (f byPublicKey) Less(i, j int) bool {
+	return bytes.Compare(f[i].PublicKey.Bytes, f[j].PublicKey.Bytes) < 0
+}
+func (f byPublicKey) Swap(i, j int) {
+	f[i], f[j] = f[j], f[i]
+}
+
 func NewPayEntryCBEntry(pubKey *Hash, entryHash *Hash, credits int,
 	timeStamp int64, sig []byte) *PayEntryCBEntry {
 	e := &PayEntryCBEntry{}
@@ -370,7 +631,7 @@ func (e *BuyCBEntry) MarshalBinary() (data []byte, err error) {
 		return
 	}
 	buf.Write(data)
-	binary.Write(&buf, binary.BigEndian, e.Credits())
+	binary.Write(&buf, binary.BigEndian, int32(e.credits))
 
 	data, err = e.FactomTxHash.MarshalBinary()
 	if err != nil {
@@ -397,8 +658,7 @@ func (e *BuyCBEntry) UnmarshalBinary(data []byte) (err error) {
 
 	e.publicKey, data = UnmarshalHash(data)
 
-	buf, data := bytes.NewBuffer(data[:4]), data[4:]
-	binary.Read(buf, binary.BigEndian, &e.credits)
+	e.credits, data = int(int32(binary.BigEndian.Uint32(data[0:4]))), data[4:]
 
 	e.FactomTxHash = new(Hash)
 	e.FactomTxHash, data = UnmarshalHash(data)
@@ -429,7 +689,7 @@ func (e *PayEntryCBEntry) MarshalBinary() (data []byte, err error) {
 	}
 	buf.Write(data)
 
-	binary.Write(&buf, binary.BigEndian, e.credits)
+	binary.Write(&buf, binary.BigEndian, int32(e.credits))
 
 	data, err = e.EntryHash.MarshalBinary()
 	if err != nil {
@@ -467,15 +727,12 @@ func (e *PayEntryCBEntry) UnmarshalBinary(data []byte) (err error) {
 
 	e.publicKey, data = UnmarshalHash(data)
 
-	buf, data := bytes.NewBuffer(data[:4]), data[4:]
-	binary.Read(buf, binary.BigEndian, &e.credits)
+	e.credits, data = int(int32(binary.BigEndian.Uint32(data[0:4]))), data[4:]
 
 	e.EntryHash = new(Hash)
 	e.EntryHash, data = UnmarshalHash(data)
 
-	buf = bytes.NewBuffer(data[:8])
-	binary.Read(buf, binary.BigEndian, &e.TimeStamp)
-	data = data[8:]
+	e.TimeStamp, data = int64(binary.BigEndian.Uint64(data[0:8])), data[8:]
 
 	length := binary.BigEndian.Uint32(data[0:4])
 	data = data[4:]
@@ -507,7 +764,7 @@ func (e *PayChainCBEntry) MarshalBinary() (data []byte, err error) {
 	}
 	buf.Write(data)
 
-	binary.Write(&buf, binary.BigEndian, e.credits)
+	binary.Write(&buf, binary.BigEndian, int32(e.credits))
 
 	data, err = e.EntryHash.MarshalBinary()
 	if err != nil {
@@ -557,8 +814,7 @@ func (e *PayChainCBEntry) UnmarshalBinary(data []byte) (err error) {
 
 	e.publicKey, data = UnmarshalHash(data)
 
-	buf, data := bytes.NewBuffer(data[:4]), data[4:]
-	binary.Read(buf, binary.BigEndian, &e.credits)
+	e.credits, data = int(int32(binary.BigEndian.Uint32(data[0:4]))), data[4:]
 
 	e.EntryHash,        data = UnmarshalHash(data)
 	e.ChainIDHash,      data = UnmarshalHash(data)
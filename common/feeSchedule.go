@@ -0,0 +1,145 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package common
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const (
+	// DefaultCreditsPerKB is the default price of each started KB of an
+	// entry, its header included
+	DefaultCreditsPerKB = uint32(1)
+
+	// DefaultCreditsPerChain is the default price of a new chain, on top of
+	// its first entry
+	DefaultCreditsPerChain = uint32(10)
+)
+
+// FeeSchedule is the price of entries and chains in Entry Credits
+type FeeSchedule struct {
+	CreditsPerKB    uint32
+	CreditsPerChain uint32
+}
+
+var (
+	feeSchedule = FeeSchedule{
+		CreditsPerKB:    DefaultCreditsPerKB,
+		CreditsPerChain: DefaultCreditsPerChain,
+	}
+	feeScheduleLock sync.RWMutex
+)
+
+// GetFeeSchedule returns the fee schedule in use
+func GetFeeSchedule() FeeSchedule {
+	feeScheduleLock.RLock()
+	defer feeScheduleLock.RUnlock()
+
+	return feeSchedule
+}
+
+// SetFeeSchedule changes the fee schedule used for building and checking
+// payments. Entries cannot be free.
+func SetFeeSchedule(f FeeSchedule) error {
+	if f.CreditsPerKB == 0 {
+		return errors.New("The price of an entry cannot be 0 credits per KB")
+	}
+
+	feeScheduleLock.Lock()
+	defer feeScheduleLock.Unlock()
+
+	feeSchedule = f
+	return nil
+}
+
+// EntryCost returns the number of Entry Credits needed to pay for an entry of
+// size bytes, including its header.
+func (f FeeSchedule) EntryCost(size int) uint32 {
+	return f.CreditsPerKB * uint32(size/1000+1)
+}
+
+// ChainCost returns the number of Entry Credits needed to pay for a new chain
+// with a first entry of size bytes.
+func (f FeeSchedule) ChainCost(size int) uint32 {
+	return f.CreditsPerChain + f.EntryCost(size)
+}
+
+// EntryCredits returns the price of an entry of size bytes in the fee schedule
+// in use.
+func EntryCredits(size int) uint32 {
+	return GetFeeSchedule().EntryCost(size)
+}
+
+// ChainCredits returns the price of a new chain with a first entry of size
+// bytes in the fee schedule in use.
+func ChainCredits(size int) uint32 {
+	return GetFeeSchedule().ChainCost(size)
+}
+
+// CheckPayment makes sure a PayEntryCBEntry or PayChainCBEntry pays enough for
+// an entry of size bytes in the fee schedule in use.
+func CheckPayment(e CBEntry, size int) error {
+	return GetFeeSchedule().CheckPayment(e, size)
+}
+
+// CheckPayment makes sure a PayEntryCBEntry or PayChainCBEntry pays enough for
+// an entry of size bytes in the fee schedule f.
+func (f FeeSchedule) CheckPayment(e CBEntry, size int) error {
+	var cost uint32
+	switch e.Type() {
+	case TYPE_PAY_ENTRY:
+		cost = f.EntryCost(size)
+	case TYPE_PAY_CHAIN:
+		cost = f.ChainCost(size)
+	default:
+		return fmt.Errorf("Entry credit block entry type %d is not a payment", e.Type())
+	}
+
+	if e.Credits() < 0 || uint32(e.Credits()) < cost {
+		return fmt.Errorf("Payment of %d credits, the entry costs %d", e.Credits(), cost)
+	}
+	return nil
+}
+
+// PaymentEntryHash returns the hash of the entry a PayEntryCBEntry or
+// PayChainCBEntry pays for, and nil for the other entries
+func PaymentEntryHash(e CBEntry) *Hash {
+	switch p := e.(type) {
+	case *PayEntryCBEntry:
+		return p.EntryHash
+	case *PayChainCBEntry:
+		return p.EntryHash
+	}
+	return nil
+}
+
+// NewFeeScheduleMsg returns an admin message setting the fee schedule
+func NewFeeScheduleMsg(f FeeSchedule) (*Msg, error) {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.BigEndian, f.CreditsPerKB)
+	binary.Write(&buf, binary.BigEndian, f.CreditsPerChain)
+
+	return getMsg("SetECPrice", buf.Bytes())
+}
+
+// FeeSchedule returns the last fee schedule set by the messages of the block.
+// ok is false if the block does not change the fee schedule.
+func (b *AdminBlock) FeeSchedule() (f FeeSchedule, ok bool) {
+	for _, m := range b.Msgs {
+		if m.cmd != TYPE_SET_EC_PRICE || len(m.operands) != 8 {
+			continue
+		}
+
+		f.CreditsPerKB = binary.BigEndian.Uint32(m.operands[0:4])
+		f.CreditsPerChain = binary.BigEndian.Uint32(m.operands[4:8])
+		ok = true
+	}
+	return f, ok
+}
@@ -0,0 +1,60 @@
+package common
+
+import (
+	"testing"
+)
+
+func TestFeeSchedule(t *testing.T) {
+	defer SetFeeSchedule(GetFeeSchedule())
+
+	if EntryCredits(100) != 1 || EntryCredits(1000) != 2 || ChainCredits(100) != 11 {
+		t.Errorf("wrong default prices")
+	}
+
+	if err := SetFeeSchedule(FeeSchedule{}); err == nil {
+		t.Errorf("free entries allowed")
+	}
+	if err := SetFeeSchedule(FeeSchedule{CreditsPerKB: 3, CreditsPerChain: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if EntryCredits(1500) != 6 || ChainCredits(1500) != 26 {
+		t.Errorf("prices do not follow the fee schedule")
+	}
+
+	pubKey := Sha([]byte("key"))
+	pay := NewPayEntryCBEntry(pubKey, Sha([]byte("entry")), 5, 0, nil)
+	if err := CheckPayment(pay, 1500); err == nil {
+		t.Errorf("underpaid entry accepted")
+	}
+	if err := CheckPayment(pay, 500); err != nil {
+		t.Error(err)
+	}
+	payChain := NewPayChainCBEntry(pubKey, Sha([]byte("entry")), 23, Sha([]byte("chain")), Sha([]byte("both")), nil)
+	if err := CheckPayment(payChain, 500); err != nil {
+		t.Error(err)
+	}
+	if err := CheckPayment(payChain, 1500); err == nil {
+		t.Errorf("underpaid chain accepted")
+	}
+}
+
+func TestFeeScheduleMsg(t *testing.T) {
+	m, err := NewFeeScheduleMsg(FeeSchedule{CreditsPerKB: 2, CreditsPerChain: 15})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _ := CreateAdminBlock(&AdminChain{}, nil)
+	if _, ok := b.FeeSchedule(); ok {
+		t.Errorf("fee schedule in an empty block")
+	}
+	b.AddABMsg(*m)
+
+	data, _ := b.MarshalBinary()
+	b2 := new(AdminBlock)
+	b2.UnmarshalBinary(data)
+	f, ok := b2.FeeSchedule()
+	if !ok || f.CreditsPerKB != 2 || f.CreditsPerChain != 15 {
+		t.Errorf("fee schedule changed in marshalling: %+v", f)
+	}
+}
@@ -8,7 +8,7 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
-	
+	"fmt"
 )
 
 type Hash struct {
@@ -58,6 +58,15 @@ func (h *Hash) UnMarshalBinary(data []byte) (hash *Hash, err error) {
     return hash, nil
 }
    
+func (h *Hash) UnmarshalBinary(data []byte) (err error) {
+	if len(data) < HASH_LENGTH {
+		return fmt.Errorf("Hash must be %d bytes, not %d", HASH_LENGTH, len(data))
+	}
+	h.Bytes = make([]byte, HASH_LENGTH)
+	copy(h.Bytes, data[:HASH_LENGTH])
+	return nil
+}
+
 func (h *Hash) MarshalledSize() int {
     return HASH_LENGTH
 } 
@@ -0,0 +1,381 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package cachedb keeps the most recently used blocks and entries of a
+// database in memory, decoded, so the API does not read and unmarshal them
+// again on every request. Blocks and entries found by hash never change. The
+// heads and the blocks found by height are dropped when a block is written
+// through the cache, and everything is dropped on a rollback.
+package cachedb
+
+import (
+	"container/list"
+	"encoding/binary"
+	"sync"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// DefaultSize is the number of blocks and entries kept when none is given
+const DefaultSize = 10000
+
+// the kinds of object kept, the first byte of a key
+const (
+	kindDBlock uint8 = iota
+	kindDBlockHeight
+	kindDBlockHead
+	kindABlock
+	kindCBlock
+	kindCBlockHeight
+	kindEBlock
+	kindEBlockMR
+	kindEBlockHeight
+	kindEBlockHead
+	kindEntry
+)
+
+// Stats reports on the use of a cache
+type Stats struct {
+	// Hits and Misses count the lookups answered from memory and from the
+	// database
+	Hits   uint64
+	Misses uint64
+
+	// Len is the number of objects kept, up to Size
+	Len  int
+	Size int
+}
+
+// CacheDb is a database.Db keeping the objects it reads from another one. The
+// objects it returns are shared, and must not be changed.
+type CacheDb struct {
+	database.Db
+
+	lock  sync.Mutex
+	size  int
+	lru   *list.List // of *item, most recently used first
+	items map[string]*list.Element
+
+	// gen counts the invalidations, so that an object read before one is
+	// not kept after it
+	gen uint64
+
+	hits   uint64
+	misses uint64
+}
+
+// item is an object kept in the cache
+type item struct {
+	key   string
+	value interface{}
+}
+
+var _ database.Db = (*CacheDb)(nil)
+
+// NewCacheDb returns a CacheDb keeping up to size of the objects read from db
+func NewCacheDb(db database.Db, size int) *CacheDb {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &CacheDb{
+		Db:    db,
+		size:  size,
+		lru:   list.New(),
+		items: make(map[string]*list.Element),
+	}
+}
+
+// Stats reports the hits and misses since the cache was made
+func (db *CacheDb) Stats() Stats {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	return Stats{
+		Hits:   db.hits,
+		Misses: db.misses,
+		Len:    db.lru.Len(),
+		Size:   db.size,
+	}
+}
+
+// Purge drops everything kept
+func (db *CacheDb) Purge() {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	db.lru.Init()
+	db.items = make(map[string]*list.Element)
+	db.gen++
+}
+
+func (db *CacheDb) FetchDBlockByHash(dBlockHash *common.Hash) (*common.DirectoryBlock, error) {
+	key := hashKey(kindDBlock, dBlockHash)
+	v, gen, ok := db.get(key)
+	if ok {
+		return v.(*common.DirectoryBlock), nil
+	}
+
+	block, err := db.Db.FetchDBlockByHash(dBlockHash)
+	if err == nil && block != nil {
+		db.put(key, block, gen)
+	}
+	return block, err
+}
+
+func (db *CacheDb) FetchDBlockByHeight(dBlockHeight uint64) (*common.DirectoryBlock, error) {
+	key := heightKey(kindDBlockHeight, nil, dBlockHeight)
+	v, gen, ok := db.get(key)
+	if ok {
+		return v.(*common.DirectoryBlock), nil
+	}
+
+	block, err := db.Db.FetchDBlockByHeight(dBlockHeight)
+	if err == nil && block != nil {
+		db.put(key, block, gen)
+	}
+	return block, err
+}
+
+func (db *CacheDb) FetchDBlockHead() (*common.DirectoryBlock, error) {
+	key := string([]byte{kindDBlockHead})
+	v, gen, ok := db.get(key)
+	if ok {
+		return v.(*common.DirectoryBlock), nil
+	}
+
+	block, err := db.Db.FetchDBlockHead()
+	if err == nil && block != nil {
+		db.put(key, block, gen)
+	}
+	return block, err
+}
+
+func (db *CacheDb) FetchABlockByHash(aBlockHash *common.Hash) (*common.AdminBlock, error) {
+	key := hashKey(kindABlock, aBlockHash)
+	v, gen, ok := db.get(key)
+	if ok {
+		return v.(*common.AdminBlock), nil
+	}
+
+	block, err := db.Db.FetchABlockByHash(aBlockHash)
+	if err == nil && block != nil {
+		db.put(key, block, gen)
+	}
+	return block, err
+}
+
+func (db *CacheDb) FetchCBlockByHash(cBlockHash *common.Hash) (*common.CBlock, error) {
+	key := hashKey(kindCBlock, cBlockHash)
+	v, gen, ok := db.get(key)
+	if ok {
+		return v.(*common.CBlock), nil
+	}
+
+	block, err := db.Db.FetchCBlockByHash(cBlockHash)
+	if err == nil && block != nil {
+		db.put(key, block, gen)
+	}
+	return block, err
+}
+
+func (db *CacheDb) FetchCBlockByHeight(cBlockHeight uint64) (*common.CBlock, error) {
+	key := heightKey(kindCBlockHeight, nil, cBlockHeight)
+	v, gen, ok := db.get(key)
+	if ok {
+		return v.(*common.CBlock), nil
+	}
+
+	block, err := db.Db.FetchCBlockByHeight(cBlockHeight)
+	if err == nil && block != nil {
+		db.put(key, block, gen)
+	}
+	return block, err
+}
+
+func (db *CacheDb) FetchEBlockByHash(eBlockHash *common.Hash) (*common.EBlock, error) {
+	key := hashKey(kindEBlock, eBlockHash)
+	v, gen, ok := db.get(key)
+	if ok {
+		return v.(*common.EBlock), nil
+	}
+
+	block, err := db.Db.FetchEBlockByHash(eBlockHash)
+	if err == nil && block != nil {
+		db.put(key, block, gen)
+	}
+	return block, err
+}
+
+func (db *CacheDb) FetchEBlockByMR(eBMR *common.Hash) (*common.EBlock, error) {
+	key := hashKey(kindEBlockMR, eBMR)
+	v, gen, ok := db.get(key)
+	if ok {
+		return v.(*common.EBlock), nil
+	}
+
+	block, err := db.Db.FetchEBlockByMR(eBMR)
+	if err == nil && block != nil {
+		db.put(key, block, gen)
+	}
+	return block, err
+}
+
+func (db *CacheDb) FetchEBlockByHeight(chainID *common.Hash, eBlockHeight uint64) (*common.EBlock, error) {
+	key := heightKey(kindEBlockHeight, chainID, eBlockHeight)
+	v, gen, ok := db.get(key)
+	if ok {
+		return v.(*common.EBlock), nil
+	}
+
+	block, err := db.Db.FetchEBlockByHeight(chainID, eBlockHeight)
+	if err == nil && block != nil {
+		db.put(key, block, gen)
+	}
+	return block, err
+}
+
+func (db *CacheDb) FetchEBlockHead(chainID *common.Hash) (*common.EBlock, error) {
+	key := hashKey(kindEBlockHead, chainID)
+	v, gen, ok := db.get(key)
+	if ok {
+		return v.(*common.EBlock), nil
+	}
+
+	block, err := db.Db.FetchEBlockHead(chainID)
+	if err == nil && block != nil {
+		db.put(key, block, gen)
+	}
+	return block, err
+}
+
+func (db *CacheDb) FetchEntryByHash(entrySha *common.Hash) (*common.Entry, error) {
+	key := hashKey(kindEntry, entrySha)
+	v, gen, ok := db.get(key)
+	if ok {
+		return v.(*common.Entry), nil
+	}
+
+	entry, err := db.Db.FetchEntryByHash(entrySha)
+	if err == nil && entry != nil {
+		db.put(key, entry, gen)
+	}
+	return entry, err
+}
+
+// ProcessDBlockBatch writes the Directory Block and drops the head and the
+// block kept at its height
+func (db *CacheDb) ProcessDBlockBatch(block *common.DirectoryBlock) error {
+	err := db.Db.ProcessDBlockBatch(block)
+	if block != nil {
+		db.remove(string([]byte{kindDBlockHead}),
+			heightKey(kindDBlockHeight, nil, uint64(block.Header.BlockHeight)))
+	}
+	return err
+}
+
+// ProcessCBlockBatch writes the Entry Credit Block and drops the block kept
+// at its height
+func (db *CacheDb) ProcessCBlockBatch(block *common.CBlock) error {
+	err := db.Db.ProcessCBlockBatch(block)
+	if block != nil {
+		db.remove(heightKey(kindCBlockHeight, nil, uint64(block.Header.DBHeight)))
+	}
+	return err
+}
+
+// ProcessEBlockBatch writes the Entry Block and drops the head of its chain
+// and the block kept at its height
+func (db *CacheDb) ProcessEBlockBatch(eblock *common.EBlock) error {
+	err := db.Db.ProcessEBlockBatch(eblock)
+	if eblock != nil {
+		chainID := eblock.Header.ChainID
+		db.remove(hashKey(kindEBlockHead, chainID),
+			heightKey(kindEBlockHeight, chainID, uint64(eblock.Header.EBHeight)))
+	}
+	return err
+}
+
+// RebuildIndexes rebuilds the indexes of the database and drops everything
+// kept
+func (db *CacheDb) RebuildIndexes(progress func(table string, done int)) error {
+	defer db.Purge()
+	return db.Db.RebuildIndexes(progress)
+}
+
+// RollbackClose drops everything kept and rolls back the database
+func (db *CacheDb) RollbackClose() error {
+	db.Purge()
+	return db.Db.RollbackClose()
+}
+
+// get looks up an object, and returns the generation to put it with if it is
+// not kept
+func (db *CacheDb) get(key string) (value interface{}, gen uint64, ok bool) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if e, ok := db.items[key]; ok {
+		db.lru.MoveToFront(e)
+		db.hits++
+		return e.Value.(*item).value, db.gen, true
+	}
+	db.misses++
+	return nil, db.gen, false
+}
+
+// put keeps an object read in generation gen, unless something has been
+// dropped since
+func (db *CacheDb) put(key string, value interface{}, gen uint64) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	if gen != db.gen {
+		return
+	}
+	if e, ok := db.items[key]; ok {
+		e.Value.(*item).value = value
+		db.lru.MoveToFront(e)
+		return
+	}
+
+	db.items[key] = db.lru.PushFront(&item{key: key, value: value})
+	for db.lru.Len() > db.size {
+		e := db.lru.Back()
+		db.lru.Remove(e)
+		delete(db.items, e.Value.(*item).key)
+	}
+}
+
+// remove drops the objects kept under keys
+func (db *CacheDb) remove(keys ...string) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	for _, key := range keys {
+		if e, ok := db.items[key]; ok {
+			db.lru.Remove(e)
+			delete(db.items, key)
+		}
+	}
+	db.gen++
+}
+
+// hashKey makes the key of an object found by hash
+func hashKey(kind uint8, hash *common.Hash) string {
+	var key []byte = []byte{kind}
+	key = append(key, hash.Bytes...)
+	return string(key)
+}
+
+// heightKey makes the key of an object found by height, in a chain or not
+func heightKey(kind uint8, chainID *common.Hash, height uint64) string {
+	var key []byte = []byte{kind}
+	if chainID != nil {
+		key = append(key, chainID.Bytes...)
+	}
+	h := make([]byte, 8)
+	binary.BigEndian.PutUint64(h, height)
+	return string(append(key, h...))
+}
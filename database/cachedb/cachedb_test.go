@@ -0,0 +1,111 @@
+package cachedb
+
+import (
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// counter is a database of Directory Blocks counting the reads that reach it
+type counter struct {
+	database.Db
+	dBlocks []*common.DirectoryBlock // by height
+	reads   int
+}
+
+func (c *counter) FetchDBlockByHeight(height uint64) (*common.DirectoryBlock, error) {
+	c.reads++
+	if height >= uint64(len(c.dBlocks)) {
+		return nil, nil
+	}
+	return c.dBlocks[height], nil
+}
+
+func (c *counter) FetchDBlockHead() (*common.DirectoryBlock, error) {
+	c.reads++
+	if len(c.dBlocks) == 0 {
+		return nil, nil
+	}
+	return c.dBlocks[len(c.dBlocks)-1], nil
+}
+
+func (c *counter) ProcessDBlockBatch(b *common.DirectoryBlock) error {
+	c.dBlocks = append(c.dBlocks, b)
+	return nil
+}
+
+func (c *counter) RollbackClose() error {
+	c.dBlocks = c.dBlocks[:len(c.dBlocks)-1]
+	return nil
+}
+
+func newDBlock(height uint32) *common.DirectoryBlock {
+	b := new(common.DirectoryBlock)
+	b.Header = new(common.DBlockHeader)
+	b.Header.BlockHeight = height
+	return b
+}
+
+func TestCache(t *testing.T) {
+	c := new(counter)
+	db := NewCacheDb(c, 2)
+	for h := uint32(0); h < 3; h++ {
+		db.ProcessDBlockBatch(newDBlock(h))
+	}
+
+	for i := 0; i < 2; i++ {
+		if b, _ := db.FetchDBlockByHeight(0); b == nil || b.Header.BlockHeight != 0 {
+			t.Fatalf("wrong DBlock %v", b)
+		}
+	}
+	if c.reads != 1 {
+		t.Errorf("read %d times", c.reads)
+	}
+
+	// A missing block is not kept
+	db.FetchDBlockByHeight(5)
+	db.FetchDBlockByHeight(5)
+	if c.reads != 3 {
+		t.Errorf("missing block kept")
+	}
+
+	// Height 0 is dropped for height 2, the least recently used
+	db.FetchDBlockByHeight(1)
+	db.FetchDBlockByHeight(2)
+	db.FetchDBlockByHeight(0)
+	if c.reads != 6 {
+		t.Errorf("not evicted, read %d times", c.reads)
+	}
+
+	stats := db.Stats()
+	if stats.Hits != 1 || stats.Misses != 6 || stats.Len != 2 || stats.Size != 2 {
+		t.Errorf("wrong stats %+v", stats)
+	}
+}
+
+func TestCacheInvalidation(t *testing.T) {
+	c := new(counter)
+	db := NewCacheDb(c, 10)
+	db.ProcessDBlockBatch(newDBlock(0))
+
+	if head, _ := db.FetchDBlockHead(); head.Header.BlockHeight != 0 {
+		t.Fatalf("wrong head %d", head.Header.BlockHeight)
+	}
+
+	// A new block replaces the head
+	db.ProcessDBlockBatch(newDBlock(1))
+	if head, _ := db.FetchDBlockHead(); head.Header.BlockHeight != 1 {
+		t.Errorf("old head %d kept", head.Header.BlockHeight)
+	}
+	db.FetchDBlockByHeight(1)
+
+	// A rollback drops everything
+	db.RollbackClose()
+	if head, _ := db.FetchDBlockHead(); head.Header.BlockHeight != 0 {
+		t.Errorf("head %d kept after a rollback", head.Header.BlockHeight)
+	}
+	if b, _ := db.FetchDBlockByHeight(1); b != nil {
+		t.Errorf("DBlock kept after a rollback")
+	}
+}
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"io"
+
 	"github.com/FactomProject/FactomCode/common"
 )
 
@@ -46,7 +48,7 @@ type Db interface {
 	FetchChainByName(chainName [][]byte) (chain *common.EChain, err error)
 
 	//FetchAllChains gets all of the chains
-	FetchAllChains() (chains []common.EChain, err error)
+	FetchAllChains() (chains []*common.EChain, err error)
 
 	// FetchEntryInfoBranchByHash gets an EntryInfo obj
 	//FetchEntryInfoByHash(entryHash *common.Hash) (entryInfo *common.EntryInfo, err error)
@@ -63,6 +65,9 @@ type Db interface {
 	// FetchEBlockByHeight gets an entry block by height from the database.
 	FetchEBlockByHeight(chainID * common.Hash, eBlockHeight uint64) (eBlock *common.EBlock, err error)
 
+	// FetchEBlockHead gets the newest entry block of a chain from the database.
+	FetchEBlockHead(chainID *common.Hash) (eBlock *common.EBlock, err error)
+
 	// FetchEBHashByMR gets an entry by hash from the database.
 	FetchEBHashByMR(eBMR *common.Hash) (eBlockHash *common.Hash, err error)
 
@@ -95,6 +100,9 @@ type Db interface {
 	
 	// FetchDBlockByHeight gets an directory block by height from the database.
 	FetchDBlockByHeight(dBlockHeight uint64) (dBlock *common.DirectoryBlock, err error) 
+
+	// FetchDBlockHead gets the newest directory block from the database.
+	FetchDBlockHead() (dBlock *common.DirectoryBlock, err error)
 	
 	// ProcessCBlockBatche inserts the CBlock and update all it's cbentries in DB
 	ProcessCBlockBatch(block *common.CBlock) (err error)
@@ -102,9 +110,72 @@ type Db interface {
 	// FetchCBlockByHash gets an Entry Credit block by hash from the database.
 	FetchCBlockByHash(cBlockHash *common.Hash) (cBlock *common.CBlock, err error)
 
+	// FetchCBlockByHeight gets an Entry Credit block by height from the database.
+	FetchCBlockByHeight(cBlockHeight uint64) (cBlock *common.CBlock, err error)
+
+	// ProcessABlockBatch inserts the Admin Block
+	ProcessABlockBatch(block *common.AdminBlock) (err error)
+
+	// FetchABlockByHash gets an Admin Block by hash from the database.
+	FetchABlockByHash(aBlockHash *common.Hash) (aBlock *common.AdminBlock, err error)
+
+	// FetchABlockByHeight gets an Admin Block by Directory Block height from
+	// the database.
+	FetchABlockByHeight(dBlockHeight uint64) (aBlock *common.AdminBlock, err error)
+
+	// FetchCBEntriesByPubKey gets all of the entry credit transactions of a
+	// public key, oldest first.
+	FetchCBEntriesByPubKey(pubKey *common.Hash) (cbEntries []*common.CBEntryInfo, err error)
+
+	// FetchECBalance gets the entry credit balance of a public key after the
+	// latest entry credit block.
+	FetchECBalance(pubKey *common.Hash) (credits int, err error)
+
+	// FetchECBalanceProof gets the balance of a public key with a proof that it
+	// is in the balance tree committed to by the latest entry credit block.
+	FetchECBalanceProof(pubKey *common.Hash) (proof *common.ECBalanceProof, err error)
+
+	// InsertCommit records a commit by the hash of its entry and its
+	// timestamp. It returns false if the commit has been recorded before.
+	InsertCommit(entryHash *common.Hash, timestamp uint64) (inserted bool, err error)
+
+	// PruneCommits removes the commits with a timestamp before the given one
+	PruneCommits(before uint64) (pruned int, err error)
+
+	// Snapshot returns a view of the database as it is now, for a group of
+	// reads that must agree with each other
+	Snapshot() (view DbView, err error)
+
+	// RebuildIndexes builds again the tables built from the blocks and
+	// entries, deleting the rows left over once all of them are built, and
+	// calling progress with the rows done of each table
+	RebuildIndexes(progress func(table string, done int)) error
+
+	// StorageStats counts the keys and bytes of each table, reading the
+	// whole database
+	StorageStats() (stats *StorageStats, err error)
+
+	// Compact compacts the whole database on disk
+	Compact() error
+
+	// Backup writes every key and value of a snapshot of the database to
+	// w, while reads and writes go on
+	Backup(w io.Writer) (info *BackupInfo, err error)
+
 	// Initialize External ID map for explorer search
 	InitializeExternalIDMap() (extIDMap map[string]bool, err error)
 
+	// Subscribe registers an observer that is notified after blocks and
+	// entries have been written to the database, and on rollback
+	Subscribe(o Observer) *Subscription
+
+	// SubscribeChan is like Subscribe, but delivers the events on the
+	// subscription's channel, buffering up to size of them
+	SubscribeChan(size int) *Subscription
+
+	// Unsubscribe ends a subscription
+	Unsubscribe(s *Subscription)
+
 	/*
 		// ProcessFBlockBatche inserts the FBlock
 		ProcessFBlockBatch(block *factoid.FBlock) error
@@ -116,3 +187,64 @@ type Db interface {
 		FetchAllFBlocks() (fBlocks []factoid.FBlock, err error)
 	*/
 }
+
+// DbView is a point in time view of a database. Its reads do not see the
+// writes made after it was taken. A view must be released when done with.
+type DbView interface {
+	// FetchDBlockByHeight gets a directory block by height.
+	FetchDBlockByHeight(dBlockHeight uint64) (dBlock *common.DirectoryBlock, err error)
+
+	// FetchDBlockHead gets the newest directory block.
+	FetchDBlockHead() (dBlock *common.DirectoryBlock, err error)
+
+	// FetchCBlockByHash gets an Entry Credit block by hash.
+	FetchCBlockByHash(cBlockHash *common.Hash) (cBlock *common.CBlock, err error)
+
+	// FetchCBlockByHeight gets an Entry Credit block by height.
+	FetchCBlockByHeight(cBlockHeight uint64) (cBlock *common.CBlock, err error)
+
+	// FetchEBlockByMR gets an entry block by merkle root.
+	FetchEBlockByMR(eBMR *common.Hash) (eBlock *common.EBlock, err error)
+
+	// FetchEBlockByHeight gets an entry block of a chain by height.
+	FetchEBlockByHeight(chainID *common.Hash, eBlockHeight uint64) (eBlock *common.EBlock, err error)
+
+	// FetchEBlockHead gets the newest entry block of a chain.
+	FetchEBlockHead(chainID *common.Hash) (eBlock *common.EBlock, err error)
+
+	// FetchEntryByHash gets an entry by hash.
+	FetchEntryByHash(entrySha *common.Hash) (entry *common.Entry, err error)
+
+	// FetchChainByHash gets a chain by chainID.
+	FetchChainByHash(chainID *common.Hash) (chain *common.EChain, err error)
+
+	// Release frees the view
+	Release()
+}
+
+// StorageStats reports on the tables of a database and its storage engine
+type StorageStats struct {
+	Tables []TableStats
+
+	// Engine is the compaction report of the storage engine, per level
+	Engine string
+}
+
+// TableStats reports on a table of a database
+type TableStats struct {
+	Name string
+	Keys int
+
+	// Bytes is the size of the keys and values, and DiskBytes the
+	// approximate size on disk, after compression
+	Bytes     int64
+	DiskBytes int64
+}
+
+// BackupInfo describes the contents of a backup
+type BackupInfo struct {
+	Keys int64
+
+	// Hash is the sha256 of the keys and values, in order
+	Hash *common.Hash
+}
@@ -0,0 +1,154 @@
+package dbgen
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// benchBlock makes a Directory Block past the first, whose Entry Blocks are
+// not the first of their chains
+func benchBlock(b *testing.B, cfg Config) *Block {
+	g, err := New(cfg)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var block *Block
+	for i := 0; i < 2; i++ {
+		if block, err = g.Next(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	return block
+}
+
+// BenchmarkMarshal marshals each kind of block and an entry
+func BenchmarkMarshal(b *testing.B) {
+	cfg := DefaultConfig
+	cfg.ChainsPerBlock = cfg.Chains
+	block := benchBlock(b, cfg)
+
+	for _, obj := range []struct {
+		name string
+		obj  common.BinaryMarshallable
+	}{
+		{"DBlock", block.DBlock},
+		{"ABlock", block.ABlock},
+		{"CBlock", block.CBlock},
+		{"EBlock", block.EBlocks[0]},
+		{"Entry", block.Entries[0][0]},
+	} {
+		b.Run(obj.name, func(b *testing.B) {
+			data, _ := obj.obj.MarshalBinary()
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := obj.obj.MarshalBinary(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkUnmarshal unmarshals each kind of block and an entry
+func BenchmarkUnmarshal(b *testing.B) {
+	cfg := DefaultConfig
+	cfg.ChainsPerBlock = cfg.Chains
+	block := benchBlock(b, cfg)
+
+	for _, obj := range []struct {
+		name string
+		obj  common.BinaryMarshallable
+		new  func() common.BinaryMarshallable
+	}{
+		{"DBlock", block.DBlock, func() common.BinaryMarshallable { return new(common.DirectoryBlock) }},
+		{"ABlock", block.ABlock, func() common.BinaryMarshallable { return new(common.AdminBlock) }},
+		{"CBlock", block.CBlock, func() common.BinaryMarshallable { return new(common.CBlock) }},
+		{"EBlock", block.EBlocks[0], func() common.BinaryMarshallable { return new(common.EBlock) }},
+		{"Entry", block.Entries[0][0], func() common.BinaryMarshallable { return new(common.Entry) }},
+	} {
+		b.Run(obj.name, func(b *testing.B) {
+			data, err := obj.obj.MarshalBinary()
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := obj.new().UnmarshalBinary(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkMerkle builds Merkle trees of a number of hashes
+func BenchmarkMerkle(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 10000} {
+		hashes := make([]*common.Hash, n)
+		for i := range hashes {
+			hashes[i] = common.Sha([]byte(fmt.Sprint(i)))
+		}
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				common.BuildMerkleTreeStore(hashes)
+			}
+		})
+	}
+}
+
+// BenchmarkBlockMerkle builds the Merkle roots of the blocks
+func BenchmarkBlockMerkle(b *testing.B) {
+	cfg := DefaultConfig
+	cfg.ChainsPerBlock = cfg.Chains
+	block := benchBlock(b, cfg)
+
+	b.Run("DBlockBodyMR", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			block.DBlock.BuildBodyMR()
+		}
+	})
+	b.Run("DBlockKeyMR", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			block.DBlock.BuildKeyMerkleRoot()
+		}
+	})
+	b.Run("EBlockMR", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			block.EBlocks[0].BuildMerkleRoot()
+		}
+	})
+	b.Run("CBlockSegmentsMR", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := block.CBlock.BuildSegmentsMR(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("CBlockBalanceMR", func(b *testing.B) {
+		tree := common.NewECBalanceTree(nil)
+		for i := 0; i < b.N; i++ {
+			if _, err := block.CBlock.ApplyBalances(tree); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkNext makes Directory Blocks of the default config
+func BenchmarkNext(b *testing.B) {
+	g, err := New(DefaultConfig)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := g.Next(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,411 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package dbgen makes a chain of Directory Blocks for tests and benchmarks.
+// Each Directory Block has an Admin Block, an Entry Credit Block paying for
+// its entries, and Entry Blocks of entries in a number of chains. The blocks
+// are made with the constructors of common, and link and hash as the blocks of
+// a node do, so the database checks them as it would any other. The same
+// Config always makes the same blocks.
+package dbgen
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// startTime is the time of the first Directory Block, in seconds. Each block
+// is ten minutes after the one before.
+const startTime = 1430000000
+
+// buyCredits is the number of credits a public key buys when it runs low
+const buyCredits = 10000
+
+// Config is the shape of the blocks made
+type Config struct {
+	// Seed seeds the random numbers the blocks are made from
+	Seed int64
+
+	// Chains is the number of Entry chains, and ChainsPerBlock the number
+	// of them with an Entry Block in each Directory Block. A chain is made
+	// the first time it has an Entry Block.
+	Chains         int
+	ChainsPerBlock int
+
+	// EntriesPerEBlock is the number of entries in each Entry Block. They
+	// are spread over the ten minutes of the block.
+	EntriesPerEBlock int
+
+	// Entries have from MinEntrySize to MaxEntrySize bytes of data, and
+	// ExtIDs External IDs of 32 bytes. The first entry of a chain has its
+	// name for External IDs.
+	MinEntrySize int
+	MaxEntrySize int
+	ExtIDs       int
+
+	// ECKeys is the number of public keys paying for the entries. A key
+	// buys credits in the Entry Credit Block when it runs low.
+	ECKeys int
+}
+
+// DefaultConfig is a small network with a few busy chains
+var DefaultConfig = Config{
+	Seed:             1,
+	Chains:           100,
+	ChainsPerBlock:   10,
+	EntriesPerEBlock: 10,
+	MinEntrySize:     100,
+	MaxEntrySize:     1000,
+	ExtIDs:           2,
+	ECKeys:           20,
+}
+
+// Block is a Directory Block with the blocks and entries it refers to
+type Block struct {
+	DBlock  *common.DirectoryBlock
+	ABlock  *common.AdminBlock
+	CBlock  *common.CBlock
+	EBlocks []*common.EBlock
+
+	// Entries are the entries of each Entry Block, in the same order
+	Entries [][]*common.Entry
+}
+
+// Generator makes the blocks of a Config one Directory Block at a time
+type Generator struct {
+	cfg  Config
+	rand *rand.Rand
+
+	dChain *common.DChain
+	aChain *common.AdminChain
+	cChain *common.CChain
+	chains []*common.EChain
+
+	// the blocks at the head of each chain, by chain
+	dBlock  *common.DirectoryBlock
+	aBlock  *common.AdminBlock
+	cBlock  *common.CBlock
+	eBlocks []*common.EBlock
+
+	keys     []*common.Hash
+	balances *common.ECBalanceTree
+}
+
+// New returns a Generator of the blocks of cfg, starting at height 0
+func New(cfg Config) (*Generator, error) {
+	if cfg.Chains < 1 || cfg.ChainsPerBlock < 0 || cfg.ChainsPerBlock > cfg.Chains ||
+		cfg.EntriesPerEBlock < 1 || cfg.ECKeys < 1 || cfg.ExtIDs < 0 ||
+		cfg.MinEntrySize < 0 || cfg.MaxEntrySize < cfg.MinEntrySize {
+		return nil, fmt.Errorf("Invalid generator config %+v", cfg)
+	}
+	if cfg.MaxEntrySize+cfg.ExtIDs*34 > int(common.MAX_ENTRY_SIZE) {
+		return nil, fmt.Errorf("Entries of %d bytes are over the entry size limit", cfg.MaxEntrySize)
+	}
+
+	g := &Generator{
+		cfg:      cfg,
+		rand:     rand.New(rand.NewSource(cfg.Seed)),
+		dChain:   &common.DChain{ChainID: &common.Hash{Bytes: common.D_CHAINID}},
+		aChain:   &common.AdminChain{ChainID: &common.Hash{Bytes: common.ADMIN_CHAINID}},
+		cChain:   &common.CChain{ChainID: &common.Hash{Bytes: common.EC_CHAINID}},
+		chains:   make([]*common.EChain, cfg.Chains),
+		eBlocks:  make([]*common.EBlock, cfg.Chains),
+		balances: common.NewECBalanceTree(nil),
+	}
+
+	for i := range g.chains {
+		name := [][]byte{[]byte("dbgen"), []byte(fmt.Sprint(cfg.Seed)), []byte(fmt.Sprint(i))}
+		chainID, err := common.GetChainID(name)
+		if err != nil {
+			return nil, err
+		}
+		g.chains[i] = &common.EChain{ChainID: chainID, Name: name}
+	}
+
+	g.keys = make([]*common.Hash, cfg.ECKeys)
+	for i := range g.keys {
+		g.keys[i] = common.Sha(g.bytes(32))
+	}
+
+	return g, nil
+}
+
+// Height is the height of the next Directory Block
+func (g *Generator) Height() uint32 {
+	return g.dChain.NextBlockHeight
+}
+
+// Next makes the next Directory Block and the blocks and entries it refers to
+func (g *Generator) Next() (*Block, error) {
+	height := g.dChain.NextBlockHeight
+	b := new(Block)
+
+	aBlock, err := g.nextABlock(height)
+	if err != nil {
+		return nil, err
+	}
+	b.ABlock = aBlock
+
+	// The payments for the entries of each minute, by minute
+	payments := make([][]common.CBEntry, 10)
+
+	for _, i := range g.pickChains() {
+		eBlock, entries, err := g.nextEBlock(i, height, payments)
+		if err != nil {
+			return nil, err
+		}
+		b.EBlocks = append(b.EBlocks, eBlock)
+		b.Entries = append(b.Entries, entries)
+	}
+
+	cBlock, err := g.nextCBlock(height, payments)
+	if err != nil {
+		return nil, err
+	}
+	b.CBlock = cBlock
+
+	dBlock, err := common.CreateDBlock(g.dChain, g.dBlock, uint(len(b.EBlocks)+2))
+	if err != nil {
+		return nil, err
+	}
+	dBlock.DBEntries = append(dBlock.DBEntries,
+		&common.DBEntry{ChainID: aBlock.ChainID, MerkleRoot: aBlock.ABHash})
+	dBlock.DBEntries = append(dBlock.DBEntries, common.NewDBEntryFromCBlock(cBlock))
+	for _, eBlock := range b.EBlocks {
+		dBlock.DBEntries = append(dBlock.DBEntries, common.NewDBEntry(eBlock))
+	}
+	dBlock.Header.EntryCount = uint32(len(dBlock.DBEntries))
+	dBlock.Header.BodyMR, err = dBlock.BuildBodyMR()
+	if err != nil {
+		return nil, err
+	}
+	dBlock.BuildKeyMerkleRoot()
+	dBlock.DBHash, err = common.CreateHash(dBlock)
+	if err != nil {
+		return nil, err
+	}
+	b.DBlock = dBlock
+
+	g.dBlock = dBlock
+	g.dChain.NextBlockHeight++
+	return b, nil
+}
+
+// nextABlock makes the Admin Block of a Directory Block
+func (g *Generator) nextABlock(height uint32) (*common.AdminBlock, error) {
+	g.aChain.NextBlockHeight = height
+	block, err := common.CreateAdminBlock(g.aChain, g.aBlock)
+	if err != nil {
+		return nil, err
+	}
+	block.Chain = g.aChain
+	block.BuildABHash()
+
+	g.aBlock = block
+	return block, nil
+}
+
+// pickChains picks the chains with an Entry Block in the next Directory
+// Block, in order
+func (g *Generator) pickChains() []int {
+	picked := make([]bool, g.cfg.Chains)
+	for _, i := range g.rand.Perm(g.cfg.Chains)[:g.cfg.ChainsPerBlock] {
+		picked[i] = true
+	}
+
+	chains := make([]int, 0, g.cfg.ChainsPerBlock)
+	for i, p := range picked {
+		if p {
+			chains = append(chains, i)
+		}
+	}
+	return chains
+}
+
+// nextEBlock makes the next Entry Block of chain i and its entries, adding the
+// payments for them to the minutes they are in
+func (g *Generator) nextEBlock(i int, height uint32, payments [][]common.CBEntry) (*common.EBlock, []*common.Entry, error) {
+	chain := g.chains[i]
+	prev := g.eBlocks[i]
+	block, err := common.CreateBlock(chain, prev, uint(g.cfg.EntriesPerEBlock+10))
+	if err != nil {
+		return nil, nil, err
+	}
+	block.Header.DBHeight = height
+
+	entries := make([]*common.Entry, 0, g.cfg.EntriesPerEBlock)
+	minute := 0
+	for j := 0; j < g.cfg.EntriesPerEBlock; j++ {
+		// An entry in a later minute ends the minute before
+		if m := j * 10 / g.cfg.EntriesPerEBlock; m != minute {
+			block.AddEndOfMinuteMarker(byte(minute + 1))
+			minute = m
+		}
+
+		first := prev == nil && j == 0
+		entry := g.entry(chain, first)
+		data, err := entry.MarshalBinary()
+		if err != nil {
+			return nil, nil, err
+		}
+		block.AddEBEntry(entry)
+		entries = append(entries, entry)
+
+		entryHash := common.Sha(data)
+		payments[minute] = append(payments[minute],
+			g.payment(chain, entryHash, len(data), first, height, minute))
+	}
+	block.AddEndOfMinuteMarker(byte(minute + 1))
+
+	hashes := make([]*common.Hash, len(block.EBEntries))
+	for k, e := range block.EBEntries {
+		hashes[k] = e.EntryHash
+	}
+	merkle := common.BuildMerkleTreeStore(hashes)
+	block.Header.BodyMR = merkle[len(merkle)-1]
+	block.Header.EntryCount = uint32(len(block.EBEntries))
+	block.BuildMerkleRoot()
+	block.EBHash, err = common.CreateHash(block)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	g.eBlocks[i] = block
+	chain.NextBlockHeight++
+	return block, entries, nil
+}
+
+// entry makes an entry of chain, the first entry of it if first
+func (g *Generator) entry(chain *common.EChain, first bool) *common.Entry {
+	entry := &common.Entry{ChainID: chain.ChainID}
+	if first {
+		entry.ExtIDs = chain.Name
+	} else {
+		for k := 0; k < g.cfg.ExtIDs; k++ {
+			entry.ExtIDs = append(entry.ExtIDs, g.bytes(32))
+		}
+	}
+	entry.Data = g.bytes(g.cfg.MinEntrySize + g.rand.Intn(g.cfg.MaxEntrySize-g.cfg.MinEntrySize+1))
+	return entry
+}
+
+// payment pays for an entry of size bytes, or a new chain, from one of the
+// public keys
+func (g *Generator) payment(chain *common.EChain, entryHash *common.Hash, size int, first bool,
+	height uint32, minute int) common.CBEntry {
+	pubKey := g.keys[g.rand.Intn(len(g.keys))]
+	sig := g.bytes(common.SIG_LENGTH)
+
+	if first {
+		credits := int(common.ChainCredits(size))
+		return common.NewPayChainCBEntry(pubKey, entryHash, credits, chain.ChainID,
+			common.GetEntryChainIDHash(chain.ChainID, entryHash), sig)
+	}
+
+	credits := int(common.EntryCredits(size))
+	timestamp := startTime + 600*int64(height) + 60*int64(minute)
+	return common.NewPayEntryCBEntry(pubKey, entryHash, credits, timestamp, sig)
+}
+
+// nextCBlock makes the Entry Credit Block with the payments of each minute.
+// The keys that would run out of credits buy some at the start of the block.
+func (g *Generator) nextCBlock(height uint32, payments [][]common.CBEntry) (*common.CBlock, error) {
+	g.cChain.NextBlockHeight = int(height)
+	block, err := common.CreateCBlock(g.cChain, g.cBlock, 10)
+	if err != nil {
+		return nil, err
+	}
+
+	spent := make(map[*common.Hash]int)
+	for _, minute := range payments {
+		for _, p := range minute {
+			spent[p.PublicKey()] += p.Credits()
+		}
+	}
+
+	block.AddServerIndexEntry(0)
+	for _, pubKey := range g.keys {
+		balance, _ := g.balances.Balance(pubKey)
+		for ; balance < spent[pubKey]; balance += buyCredits {
+			block.AddCBEntry(common.NewBuyCBEntry(pubKey, common.Sha(g.bytes(32)), buyCredits))
+		}
+	}
+	for m, minute := range payments {
+		for _, p := range minute {
+			block.AddCBEntry(p)
+		}
+		block.AddEndOfMinuteMarker(byte(m + 1))
+	}
+
+	block.Header.EntryCount = len(block.CBEntries)
+	block.Header.BodySize = block.MarshalledSize() - block.Header.MarshalledSize()
+	block.Header.BodyHash, err = block.BuildCBBodyHash()
+	if err != nil {
+		return nil, err
+	}
+	if err = block.BuildHeaderMRs(g.balances); err != nil {
+		return nil, err
+	}
+	if g.balances, err = block.ApplyBalances(g.balances); err != nil {
+		return nil, err
+	}
+	block.BuildMerkleRoot()
+	block.BuildCBHash()
+
+	g.cBlock = block
+	return block, nil
+}
+
+// bytes returns n random bytes
+func (g *Generator) bytes(n int) []byte {
+	b := make([]byte, n)
+	g.rand.Read(b)
+	return b
+}
+
+// Write stores a Block in db the way a node syncing it does: the Admin and
+// Entry Credit Blocks, the entries and Entry Block of each chain, and then
+// the Directory Block.
+func Write(db database.Db, b *Block) error {
+	if err := db.ProcessABlockBatch(b.ABlock); err != nil {
+		return err
+	}
+	if err := db.ProcessCBlockBatch(b.CBlock); err != nil {
+		return err
+	}
+
+	for i, eBlock := range b.EBlocks {
+		for _, entry := range b.Entries[i] {
+			data, err := entry.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			if err := db.InsertEntry(common.Sha(data), &data, entry, &entry.ChainID.Bytes); err != nil {
+				return err
+			}
+		}
+		if err := db.ProcessEBlockBatch(eBlock); err != nil {
+			return err
+		}
+	}
+
+	return db.ProcessDBlockBatch(b.DBlock)
+}
+
+// Generate makes the next n Directory Blocks and writes them to db
+func (g *Generator) Generate(db database.Db, n int) error {
+	for i := 0; i < n; i++ {
+		b, err := g.Next()
+		if err != nil {
+			return err
+		}
+		if err := Write(db, b); err != nil {
+			return fmt.Errorf("Cannot write Directory Block %d: %v", b.DBlock.Header.BlockHeight, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package dbgen
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/database/dbsync"
+	"github.com/FactomProject/FactomCode/database/ldb"
+)
+
+func TestDeterministic(t *testing.T) {
+	hashes := func(cfg Config) []string {
+		g, err := New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var h []string
+		for i := 0; i < 5; i++ {
+			b, err := g.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+			h = append(h, b.DBlock.DBHash.String())
+		}
+		return h
+	}
+
+	cfg := DefaultConfig
+	first, again := hashes(cfg), hashes(cfg)
+	for i := range first {
+		if first[i] != again[i] {
+			t.Fatalf("Directory Block %d made differently", i)
+		}
+	}
+
+	cfg.Seed++
+	if hashes(cfg)[0] == first[0] {
+		t.Errorf("same blocks from another seed")
+	}
+
+	cfg.MaxEntrySize = int(^uint16(0))
+	if _, err := New(cfg); err == nil {
+		t.Errorf("entries over the size limit allowed")
+	}
+}
+
+// TestGenerate writes blocks to a database, which takes them as it would
+// those of a node
+func TestGenerate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbgen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := ldb.OpenLevelDB(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	cfg := DefaultConfig
+	cfg.Chains = 5
+	cfg.ChainsPerBlock = 3
+	cfg.EntriesPerEBlock = 4
+	g, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Generate(db, 20); err != nil {
+		t.Fatal(err)
+	}
+
+	head, err := db.FetchDBlockHead()
+	if err != nil || head.Header.BlockHeight != 19 || g.Height() != 20 {
+		t.Fatalf("wrong head: %v", err)
+	}
+	missing, err := dbsync.Check(db)
+	if err != nil || len(missing) != 0 {
+		t.Errorf("%d missing: %v", len(missing), err)
+	}
+
+	chains, err := db.FetchAllChains()
+	if err != nil || len(chains) != cfg.Chains {
+		t.Fatalf("%d chains: %v", len(chains), err)
+	}
+	var entries uint32
+	for i := range chains {
+		if len(chains[i].Name) != 3 {
+			t.Errorf("chain %s has no name", chains[i].ChainID.String())
+		}
+		entries += chains[i].EntryCount
+	}
+	if entries != uint32(20*cfg.ChainsPerBlock*cfg.EntriesPerEBlock) {
+		t.Errorf("%d entries in the chains", entries)
+	}
+
+	for _, pubKey := range g.keys {
+		credits, err := db.FetchECBalance(pubKey)
+		if err != nil || credits < 0 {
+			t.Errorf("balance of %d: %v", credits, err)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package dbsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// Missing is a block or entry that is referenced in the database but is not
+// in it
+type Missing struct {
+	// Kind is "dblock", "ablock", "ecblock", "eblock" or "entry"
+	Kind string
+
+	// Hash is the hash or key merkle root it is referenced by, nil for a
+	// Directory Block
+	Hash *common.Hash
+
+	// DBHeight is the height of the Directory Block it belongs to, and
+	// ChainID the chain of an Entry Block or entry
+	DBHeight uint32
+	ChainID  *common.Hash
+}
+
+func (m *Missing) String() string {
+	switch {
+	case m.Hash == nil:
+		return fmt.Sprintf("height %d: missing %s", m.DBHeight, m.Kind)
+	case m.ChainID == nil:
+		return fmt.Sprintf("height %d: missing %s %s", m.DBHeight, m.Kind, m.Hash.String())
+	}
+	return fmt.Sprintf("height %d chain %s: missing %s %s",
+		m.DBHeight, m.ChainID.String(), m.Kind, m.Hash.String())
+}
+
+// Check walks the Directory Blocks up to the head of db and reports the
+// blocks and entries they refer to that are not stored, lowest height first.
+func Check(db database.Db) ([]*Missing, error) {
+	head, err := db.FetchDBlockHead()
+	if err != nil || head == nil {
+		return nil, err
+	}
+
+	missing := make([]*Missing, 0)
+	for h := uint32(0); h <= head.Header.BlockHeight; h++ {
+		block, _ := db.FetchDBlockByHeight(uint64(h))
+		if block == nil {
+			missing = append(missing, &Missing{Kind: "dblock", DBHeight: h})
+			continue
+		}
+
+		for _, dbEntry := range block.DBEntries {
+			m, err := checkDBEntry(db, dbEntry, h)
+			if err != nil {
+				return nil, err
+			}
+			missing = append(missing, m...)
+		}
+	}
+
+	return missing, nil
+}
+
+// checkDBEntry reports the block a DBEntry refers to if it is missing, or the
+// missing entries of an Entry Block
+func checkDBEntry(db database.Db, dbEntry *common.DBEntry, height uint32) ([]*Missing, error) {
+	switch {
+	case bytes.Equal(dbEntry.ChainID.Bytes, common.ADMIN_CHAINID):
+		block, err := db.FetchABlockByHash(dbEntry.MerkleRoot)
+		if err != nil || block != nil {
+			return nil, err
+		}
+		return []*Missing{{Kind: "ablock", Hash: dbEntry.MerkleRoot, DBHeight: height}}, nil
+
+	case bytes.Equal(dbEntry.ChainID.Bytes, common.EC_CHAINID):
+		block, err := db.FetchCBlockByHash(dbEntry.MerkleRoot)
+		if err != nil || block != nil {
+			return nil, err
+		}
+		return []*Missing{{Kind: "ecblock", Hash: dbEntry.MerkleRoot, DBHeight: height}}, nil
+
+	case isSystemChain(dbEntry.ChainID):
+		return nil, nil
+	}
+
+	block, err := db.FetchEBlockByMR(dbEntry.MerkleRoot)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return []*Missing{{Kind: "eblock", Hash: dbEntry.MerkleRoot, DBHeight: height, ChainID: dbEntry.ChainID}}, nil
+	}
+
+	var missing []*Missing
+	for _, ebEntry := range block.EBEntries {
+		if common.IsEndOfMinuteMarker(ebEntry.EntryHash) {
+			continue
+		}
+		entry, err := db.FetchEntryByHash(ebEntry.EntryHash)
+		if err != nil {
+			return nil, err
+		}
+		if entry == nil {
+			missing = append(missing, &Missing{Kind: "entry", Hash: ebEntry.EntryHash,
+				DBHeight: height, ChainID: dbEntry.ChainID})
+		}
+	}
+	return missing, nil
+}
+
+// Repair downloads the missing blocks and entries from the source, checks
+// them against the hashes and merkle roots they are referenced by, and stores
+// them. It goes on after a failure, and returns the number repaired and the
+// first error.
+//
+// An Entry Credit Block older than the newest one is stored without being
+// applied to the balances again, and is checked against the BalanceMR kept for
+// its height when it was first processed. The chain records are counted again
+// once Directory Blocks, Entry Blocks or entries are repaired, as the blocks
+// after them were counted without them.
+func (s *Syncer) Repair(ctx context.Context, missing []*Missing) (repaired int, err error) {
+	chains := false
+	defer func() {
+		if !chains {
+			return
+		}
+		if e := s.db.RebuildIndexes(nil); e != nil && err == nil {
+			err = fmt.Errorf("Chain records not counted again: %v", e)
+		}
+	}()
+
+	for _, m := range missing {
+		if ctx.Err() != nil {
+			return repaired, ctx.Err()
+		}
+
+		var e error
+		switch m.Kind {
+		case "dblock":
+			e = s.repairDBlock(ctx, m.DBHeight)
+		case "ablock":
+			e = s.syncABlock(ctx, m.Hash, m.DBHeight)
+		case "ecblock":
+			e = s.syncCBlock(ctx, m.Hash, m.DBHeight)
+		case "eblock":
+			e = s.syncEBlock(ctx, m.ChainID, m.Hash, m.DBHeight)
+		case "entry":
+			e = s.syncEntry(ctx, m.Hash, m.ChainID)
+		default:
+			e = fmt.Errorf("Unknown kind of data %s", m.Kind)
+		}
+
+		if e != nil {
+			if err == nil {
+				err = fmt.Errorf("%s: %v", m.String(), e)
+			}
+			continue
+		}
+		if m.Kind == "dblock" || m.Kind == "eblock" || m.Kind == "entry" {
+			chains = true
+		}
+		repaired++
+	}
+
+	return repaired, err
+}
+
+// repairDBlock downloads a missing Directory Block, checking it against the
+// stored blocks before and after it
+func (s *Syncer) repairDBlock(ctx context.Context, height uint32) error {
+	var prev *common.DirectoryBlock
+	if height > 0 {
+		prev, _ = s.db.FetchDBlockByHeight(uint64(height - 1))
+		if prev != nil {
+			prev.BuildKeyMerkleRoot()
+		}
+	}
+	next, _ := s.db.FetchDBlockByHeight(uint64(height + 1))
+
+	_, err := s.syncDBlock(ctx, height, prev, next)
+	return err
+}
@@ -0,0 +1,428 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package dbsync fills a database with the block chain of another node. The
+// Directory Blocks are downloaded by height from the node's wsapi, then the
+// Admin, Entry Credit and Entry Blocks and the entries they refer to. Every
+// hash link and merkle root is checked before anything is stored, each block
+// against the block before it in its chain, and a Directory Block is stored
+// last, so an interrupted sync resumes from the local head.
+package dbsync
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// Source is the node the block chain is downloaded from. A
+// *factomclient.Client is a Source.
+type Source interface {
+	// DBlockHeight returns the number of Directory Blocks of the node
+	DBlockHeight(ctx context.Context) (int, error)
+
+	// RawData returns the binary form of a block or entry, nil if the node
+	// does not have it. See factomapi.GetRawData.
+	RawData(ctx context.Context, kind string, key string) ([]byte, error)
+}
+
+// Syncer downloads the block chain of a Source into a database
+type Syncer struct {
+	db     database.Db
+	source Source
+
+	// Progress is called after each Directory Block is stored, if set
+	Progress func(height uint32)
+}
+
+// NewSyncer returns a Syncer storing the blocks of source in db
+func NewSyncer(db database.Db, source Source) *Syncer {
+	return &Syncer{db: db, source: source}
+}
+
+// Sync downloads the Directory Blocks after the local head up to the head of
+// the source, and returns the number stored.
+func (s *Syncer) Sync(ctx context.Context) (synced int, err error) {
+	prev, err := s.db.FetchDBlockHead()
+	if err != nil {
+		return 0, err
+	}
+
+	next := uint32(0)
+	if prev != nil {
+		prev.BuildKeyMerkleRoot()
+		next = prev.Header.BlockHeight + 1
+	}
+
+	count, err := s.source.DBlockHeight(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for h := next; h < uint32(count); h++ {
+		if err := ctx.Err(); err != nil {
+			return synced, err
+		}
+
+		block, err := s.syncDBlock(ctx, h, prev, nil)
+		if err != nil {
+			return synced, err
+		}
+		synced++
+		prev = block
+
+		if s.Progress != nil {
+			s.Progress(h)
+		}
+	}
+
+	return synced, nil
+}
+
+// syncDBlock downloads, checks and stores the Directory Block at height and
+// the blocks it refers to. It must link to prev and next, the stored blocks
+// before and after it, at least one of which is needed past the first height.
+func (s *Syncer) syncDBlock(ctx context.Context, height uint32, prev *common.DirectoryBlock, next *common.DirectoryBlock) (*common.DirectoryBlock, error) {
+	if height > 0 && prev == nil && next == nil {
+		return nil, fmt.Errorf("DBlock %d cannot be checked without the DBlocks next to it", height)
+	}
+
+	data, err := s.fetch(ctx, "dblockbyheight", strconv.FormatUint(uint64(height), 10))
+	if err != nil {
+		return nil, err
+	}
+
+	block := new(common.DirectoryBlock)
+	if err := unmarshal(block, data); err != nil {
+		return nil, err
+	}
+	block.DBHash = common.Sha(data)
+	block.BuildKeyMerkleRoot()
+
+	if err := verifyDBlock(block, height); err != nil {
+		return nil, err
+	}
+	if prev != nil {
+		err = verifyLink(prev, block)
+	} else if height == 0 && !block.Header.PrevKeyMR.IsSameAs(common.NewHash()) {
+		err = errors.New("The first DBlock links to a previous DBlock")
+	}
+	if err == nil && next != nil {
+		err = verifyLink(block, next)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, dbEntry := range block.DBEntries {
+		switch {
+		case bytes.Equal(dbEntry.ChainID.Bytes, common.ADMIN_CHAINID):
+			err = s.syncABlock(ctx, dbEntry.MerkleRoot, height)
+		case bytes.Equal(dbEntry.ChainID.Bytes, common.EC_CHAINID):
+			err = s.syncCBlock(ctx, dbEntry.MerkleRoot, height)
+		case isSystemChain(dbEntry.ChainID):
+			// The factoid blocks are kept by the factoid component
+		default:
+			err = s.syncEBlock(ctx, dbEntry.ChainID, dbEntry.MerkleRoot, height)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.db.ProcessDBlockBatch(block); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// verifyDBlock checks that a Directory Block is at height and matches its
+// BodyMR
+func verifyDBlock(block *common.DirectoryBlock, height uint32) error {
+	if block.Header.BlockHeight != height {
+		return fmt.Errorf("Asked for DBlock %d, got %d", height, block.Header.BlockHeight)
+	}
+
+	bodyMR, err := block.BuildBodyMR()
+	if err != nil {
+		return err
+	}
+	if !bodyMR.IsSameAs(block.Header.BodyMR) {
+		return fmt.Errorf("DBlock %d does not match its BodyMR", height)
+	}
+	return nil
+}
+
+// verifyLink checks that a Directory Block links to the one before it, whose
+// KeyMR and DBHash must be set
+func verifyLink(prev *common.DirectoryBlock, block *common.DirectoryBlock) error {
+	if block.Header.BlockHeight != prev.Header.BlockHeight+1 ||
+		!block.Header.PrevKeyMR.IsSameAs(prev.KeyMR) ||
+		!block.Header.PrevBlockHash.IsSameAs(prev.DBHash) {
+		return fmt.Errorf("DBlock %d does not link to DBlock %d",
+			block.Header.BlockHeight, prev.Header.BlockHeight)
+	}
+	return nil
+}
+
+// syncABlock downloads, checks and stores an Admin Block
+func (s *Syncer) syncABlock(ctx context.Context, hash *common.Hash, height uint32) error {
+	data, err := s.fetch(ctx, "ablock", hash.String())
+	if err != nil {
+		return err
+	}
+	if !common.Sha(data).IsSameAs(hash) {
+		return fmt.Errorf("ABlock %s does not match its hash", hash.String())
+	}
+
+	block := new(common.AdminBlock)
+	if err := unmarshal(block, data); err != nil {
+		return err
+	}
+	if block.DBHeight != height {
+		return fmt.Errorf("ABlock %s is not at height %d", hash.String(), height)
+	}
+
+	prevHash, err := s.prevBlockHash(common.ADMIN_CHAINID, height)
+	if err != nil {
+		return fmt.Errorf("ABlock %s cannot be checked: %v", hash.String(), err)
+	}
+	if !block.PrevHash3.IsSameAs(prevHash) {
+		return fmt.Errorf("ABlock %s does not link to the ABlock before it", hash.String())
+	}
+	block.ABHash = hash
+
+	return s.db.ProcessABlockBatch(block)
+}
+
+// syncCBlock downloads, checks and stores an Entry Credit Block. The database
+// checks its merkle roots against the balances.
+func (s *Syncer) syncCBlock(ctx context.Context, hash *common.Hash, height uint32) error {
+	data, err := s.fetch(ctx, "ecblock", hash.String())
+	if err != nil {
+		return err
+	}
+	if !common.Sha(data).IsSameAs(hash) {
+		return fmt.Errorf("ECBlock %s does not match its hash", hash.String())
+	}
+
+	block := new(common.CBlock)
+	if err := unmarshal(block, data); err != nil {
+		return err
+	}
+	if block.Header.DBHeight != int(height) {
+		return fmt.Errorf("ECBlock %s is not at height %d", hash.String(), height)
+	}
+	if err := s.verifyCBlockLink(block, hash, height); err != nil {
+		return err
+	}
+	block.CBHash = hash
+
+	return s.db.ProcessCBlockBatch(block)
+}
+
+// syncEBlock downloads, checks and stores an Entry Block and its entries. The
+// entries go first, so the chain record gets its name from the first entry.
+func (s *Syncer) syncEBlock(ctx context.Context, chainID *common.Hash, mr *common.Hash, height uint32) error {
+	data, err := s.fetch(ctx, "eblock", mr.String())
+	if err != nil {
+		return err
+	}
+
+	block := new(common.EBlock)
+	if err := unmarshal(block, data); err != nil {
+		return err
+	}
+	if err := verifyEBlock(block, chainID, mr, height); err != nil {
+		return err
+	}
+	if err := s.verifyEBlockLink(block, mr); err != nil {
+		return err
+	}
+	block.EBHash = common.Sha(data)
+
+	for _, ebEntry := range block.EBEntries {
+		if common.IsEndOfMinuteMarker(ebEntry.EntryHash) {
+			continue
+		}
+		if err := s.syncEntry(ctx, ebEntry.EntryHash, chainID); err != nil {
+			return err
+		}
+	}
+
+	return s.db.ProcessEBlockBatch(block)
+}
+
+// verifyEBlock checks that an Entry Block is in chainID at height, matches its
+// BodyMR and has the key merkle root mr
+func verifyEBlock(block *common.EBlock, chainID *common.Hash, mr *common.Hash, height uint32) error {
+	if len(block.EBEntries) == 0 {
+		return fmt.Errorf("EBlock %s is empty", mr.String())
+	}
+	if !block.Header.ChainID.IsSameAs(chainID) || block.Header.DBHeight != height {
+		return fmt.Errorf("EBlock %s is not in chain %s at height %d", mr.String(), chainID.String(), height)
+	}
+
+	hashes := make([]*common.Hash, len(block.EBEntries))
+	for i, e := range block.EBEntries {
+		hashes[i] = e.EntryHash
+	}
+	merkle := common.BuildMerkleTreeStore(hashes)
+	if !merkle[len(merkle)-1].IsSameAs(block.Header.BodyMR) {
+		return fmt.Errorf("EBlock %s does not match its BodyMR", mr.String())
+	}
+
+	block.BuildMerkleRoot()
+	if !block.MerkleRoot.IsSameAs(mr) {
+		return fmt.Errorf("EBlock %s does not match its key merkle root", mr.String())
+	}
+	return nil
+}
+
+// verifyEBlockLink checks that an Entry Block links to the Entry Block before
+// it in its chain, which must be stored
+func (s *Syncer) verifyEBlockLink(block *common.EBlock, mr *common.Hash) error {
+	prevKeyMR, prevHash := common.NewHash(), common.NewHash()
+	if block.Header.EBHeight > 0 {
+		prev, err := s.db.FetchEBlockByHeight(block.Header.ChainID, uint64(block.Header.EBHeight-1))
+		if err != nil {
+			return err
+		}
+		if prev == nil {
+			return fmt.Errorf("EBlock %s cannot be checked without the EBlock before it", mr.String())
+		}
+
+		data, err := prev.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		prevHash = common.Sha(data)
+		prev.BuildMerkleRoot()
+		prevKeyMR = prev.MerkleRoot
+	}
+
+	if !block.Header.PrevKeyMR.IsSameAs(prevKeyMR) || !block.Header.PrevHash.IsSameAs(prevHash) {
+		return fmt.Errorf("EBlock %s does not link to the EBlock before it", mr.String())
+	}
+	return nil
+}
+
+// verifyCBlockLink checks that an Entry Credit Block links to the one listed
+// by the Directory Blocks below height, which must be stored
+func (s *Syncer) verifyCBlockLink(block *common.CBlock, hash *common.Hash, height uint32) error {
+	prevHash, err := s.prevBlockHash(common.EC_CHAINID, height)
+	if err != nil {
+		return fmt.Errorf("ECBlock %s cannot be checked: %v", hash.String(), err)
+	}
+
+	prevKeyMR := common.NewHash()
+	if !prevHash.IsSameAs(common.NewHash()) {
+		prev, err := s.db.FetchCBlockByHash(prevHash)
+		if err != nil {
+			return err
+		}
+		if prev == nil {
+			return fmt.Errorf("ECBlock %s cannot be checked without the ECBlock before it", hash.String())
+		}
+		if err := prev.BuildMerkleRoot(); err != nil {
+			return err
+		}
+		prevKeyMR = prev.MerkleRoot
+	}
+
+	if !block.Header.PrevKeyMR.IsSameAs(prevKeyMR) || !block.Header.PrevHash.IsSameAs(prevHash) {
+		return fmt.Errorf("ECBlock %s does not link to the ECBlock before it", hash.String())
+	}
+	return nil
+}
+
+// prevBlockHash returns the hash of the block of a chain listed by the newest
+// Directory Block below height, and a zero hash if there is none. The
+// Directory Blocks below height must be stored.
+func (s *Syncer) prevBlockHash(chainID []byte, height uint32) (*common.Hash, error) {
+	for h := height; h > 0; h-- {
+		dBlock, _ := s.db.FetchDBlockByHeight(uint64(h - 1))
+		if dBlock == nil {
+			return nil, fmt.Errorf("DBlock %d is not stored", h-1)
+		}
+		for _, dbEntry := range dBlock.DBEntries {
+			if bytes.Equal(dbEntry.ChainID.Bytes, chainID) {
+				return dbEntry.MerkleRoot, nil
+			}
+		}
+	}
+	return common.NewHash(), nil
+}
+
+// syncEntry downloads, checks and stores an entry
+func (s *Syncer) syncEntry(ctx context.Context, hash *common.Hash, chainID *common.Hash) error {
+	data, err := s.fetch(ctx, "entry", hash.String())
+	if err != nil {
+		return err
+	}
+	if !common.Sha(data).IsSameAs(hash) {
+		return fmt.Errorf("Entry %s does not match its hash", hash.String())
+	}
+
+	entry := new(common.Entry)
+	if err := unmarshal(entry, data); err != nil {
+		return err
+	}
+
+	return s.db.InsertEntry(hash, &data, entry, &chainID.Bytes)
+}
+
+// fetch downloads the binary form of a block or entry the source must have
+func (s *Syncer) fetch(ctx context.Context, kind string, key string) ([]byte, error) {
+	data, err := s.source.RawData(ctx, kind, key)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("Source does not have %s %s", kind, key)
+	}
+	return data, nil
+}
+
+// unmarshal decodes data, which has not been checked yet and may be cut short
+func unmarshal(obj common.BinaryMarshallable, data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Bad binary data: %v", r)
+		}
+	}()
+
+	if err := obj.UnmarshalBinary(data); err != nil {
+		return err
+	}
+
+	// Decoding ignores trailing data, marshalling again catches it
+	again, err := obj.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(again, data) {
+		return errors.New("Bad binary data: does not marshal back the same")
+	}
+	return nil
+}
+
+// isSystemChain tells if a ChainID is one of the chains of the protocol, all
+// zero but for the last byte
+func isSystemChain(chainID *common.Hash) bool {
+	if len(chainID.Bytes) != common.HASH_LENGTH {
+		return false
+	}
+	for _, b := range chainID.Bytes[:common.HASH_LENGTH-1] {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
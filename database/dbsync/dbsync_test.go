@@ -0,0 +1,315 @@
+package dbsync
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// peer serves the binary blocks and entries it has been given
+type peer struct {
+	height int
+	data   map[string][]byte
+}
+
+func (p *peer) DBlockHeight(ctx context.Context) (int, error) {
+	return p.height, nil
+}
+
+func (p *peer) RawData(ctx context.Context, kind string, key string) ([]byte, error) {
+	return p.data[kind+"/"+key], nil
+}
+
+func (p *peer) put(kind string, key string, obj common.BinaryMarshallable) *common.Hash {
+	data, _ := obj.MarshalBinary()
+	p.data[kind+"/"+key] = data
+	return common.Sha(data)
+}
+
+// store keeps what is stored in it
+type store struct {
+	database.Db
+	dBlocks []*common.DirectoryBlock // by height
+	aBlocks map[string]*common.AdminBlock
+	cBlocks map[string]*common.CBlock
+	eBlocks map[string]*common.EBlock // by key merkle root
+	entries map[string]*common.Entry
+	rebuilt int // times the indexes were rebuilt
+}
+
+func newStore() *store {
+	return &store{
+		aBlocks: make(map[string]*common.AdminBlock),
+		cBlocks: make(map[string]*common.CBlock),
+		eBlocks: make(map[string]*common.EBlock),
+		entries: make(map[string]*common.Entry),
+	}
+}
+
+func (s *store) FetchDBlockHead() (*common.DirectoryBlock, error) {
+	if len(s.dBlocks) == 0 {
+		return nil, nil
+	}
+	return s.dBlocks[len(s.dBlocks)-1], nil
+}
+
+func (s *store) FetchDBlockByHeight(height uint64) (*common.DirectoryBlock, error) {
+	if height >= uint64(len(s.dBlocks)) || s.dBlocks[height] == nil {
+		return nil, fmt.Errorf("DBlock not found for height: %d", height)
+	}
+	return s.dBlocks[height], nil
+}
+
+func (s *store) FetchABlockByHash(hash *common.Hash) (*common.AdminBlock, error) {
+	return s.aBlocks[hash.String()], nil
+}
+
+func (s *store) FetchCBlockByHash(hash *common.Hash) (*common.CBlock, error) {
+	return s.cBlocks[hash.String()], nil
+}
+
+func (s *store) FetchEBlockByMR(mr *common.Hash) (*common.EBlock, error) {
+	return s.eBlocks[mr.String()], nil
+}
+
+func (s *store) FetchEBlockByHeight(chainID *common.Hash, height uint64) (*common.EBlock, error) {
+	for _, b := range s.eBlocks {
+		if b.Header.ChainID.IsSameAs(chainID) && uint64(b.Header.EBHeight) == height {
+			return b, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *store) FetchEntryByHash(hash *common.Hash) (*common.Entry, error) {
+	return s.entries[hash.String()], nil
+}
+
+func (s *store) ProcessDBlockBatch(b *common.DirectoryBlock) error {
+	for uint32(len(s.dBlocks)) <= b.Header.BlockHeight {
+		s.dBlocks = append(s.dBlocks, nil)
+	}
+	s.dBlocks[b.Header.BlockHeight] = b
+	return nil
+}
+
+func (s *store) ProcessABlockBatch(b *common.AdminBlock) error {
+	s.aBlocks[b.ABHash.String()] = b
+	return nil
+}
+
+func (s *store) ProcessCBlockBatch(b *common.CBlock) error {
+	s.cBlocks[b.CBHash.String()] = b
+	return nil
+}
+
+func (s *store) ProcessEBlockBatch(b *common.EBlock) error {
+	s.eBlocks[b.MerkleRoot.String()] = b
+	return nil
+}
+
+func (s *store) InsertEntry(hash *common.Hash, data *[]byte, e *common.Entry, chainID *[]byte) error {
+	s.entries[hash.String()] = e
+	return nil
+}
+
+func (s *store) RebuildIndexes(progress func(table string, done int)) error {
+	s.rebuilt++
+	return nil
+}
+
+// newPeer returns a peer with a chain of two Directory Blocks, the first with
+// an Admin, an Entry Credit and an Entry Block
+func newPeer(t *testing.T) *peer {
+	p := &peer{height: 2, data: make(map[string][]byte)}
+	chainID := common.Sha([]byte("chain"))
+
+	entry := &common.Entry{ChainID: chainID, Data: []byte("data")}
+	data, _ := entry.MarshalBinary()
+	entryHash := common.Sha(data)
+	p.put("entry", entryHash.String(), entry)
+
+	eBlock := &common.EBlock{
+		Header: &common.EBlockHeader{
+			ChainID:    chainID,
+			PrevKeyMR:  common.NewHash(),
+			PrevHash:   common.NewHash(),
+			EntryCount: 1,
+		},
+		EBEntries: []*common.EBEntry{common.NewEBEntry(entryHash)},
+	}
+	merkle := common.BuildMerkleTreeStore([]*common.Hash{entryHash})
+	eBlock.Header.BodyMR = merkle[len(merkle)-1]
+	eBlock.BuildMerkleRoot()
+	p.put("eblock", eBlock.MerkleRoot.String(), eBlock)
+
+	dChain := &common.DChain{ChainID: &common.Hash{Bytes: common.D_CHAINID}}
+	var prev *common.DirectoryBlock
+	var prevABlock *common.AdminBlock
+	for h := uint32(0); h < 2; h++ {
+		dChain.NextBlockHeight = h
+		dBlock, err := common.CreateDBlock(dChain, prev, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		aBlock, _ := common.CreateAdminBlock(&common.AdminChain{NextBlockHeight: h}, prevABlock)
+		aBlock.BuildABHash()
+		prevABlock = aBlock
+		p.put("ablock", aBlock.ABHash.String(), aBlock)
+		dBlock.DBEntries = append(dBlock.DBEntries,
+			&common.DBEntry{ChainID: aBlock.ChainID, MerkleRoot: aBlock.ABHash})
+
+		if h == 0 {
+			cBlock, _ := common.CreateCBlock(&common.CChain{ChainID: &common.Hash{Bytes: common.EC_CHAINID}}, nil, 5)
+			cBlock.BuildHeaderMRs(common.NewECBalanceTree(nil))
+			cBlock.BuildCBHash()
+			p.put("ecblock", cBlock.CBHash.String(), cBlock)
+			dBlock.DBEntries = append(dBlock.DBEntries,
+				&common.DBEntry{ChainID: cBlock.Chain.ChainID, MerkleRoot: cBlock.CBHash})
+			dBlock.DBEntries = append(dBlock.DBEntries,
+				&common.DBEntry{ChainID: chainID, MerkleRoot: eBlock.MerkleRoot})
+		}
+
+		dBlock.Header.EntryCount = uint32(len(dBlock.DBEntries))
+		dBlock.Header.BodyMR, _ = dBlock.BuildBodyMR()
+		dBlock.BuildKeyMerkleRoot()
+		p.put("dblockbyheight", strconv.Itoa(int(h)), dBlock)
+		prev = dBlock
+	}
+
+	return p
+}
+
+func TestSync(t *testing.T) {
+	p := newPeer(t)
+	s := newStore()
+
+	synced, err := NewSyncer(s, p).Sync(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if synced != 2 || len(s.dBlocks) != 2 {
+		t.Fatalf("synced %d DBlocks", synced)
+	}
+	if len(s.aBlocks) != 2 || len(s.cBlocks) != 1 || len(s.eBlocks) != 1 || len(s.entries) != 1 {
+		t.Errorf("wrong blocks stored")
+	}
+
+	// Nothing is left to sync
+	synced, err = NewSyncer(s, p).Sync(context.Background())
+	if synced != 0 || err != nil {
+		t.Errorf("synced %d DBlocks again: %v", synced, err)
+	}
+
+	// Resume after the first DBlock
+	s.dBlocks = s.dBlocks[:1]
+	synced, err = NewSyncer(s, p).Sync(context.Background())
+	if synced != 1 || err != nil || s.dBlocks[1].Header.BlockHeight != 1 {
+		t.Errorf("resumed with %d DBlocks: %v", synced, err)
+	}
+}
+
+func TestSyncRejectsBadData(t *testing.T) {
+	p := newPeer(t)
+
+	// The peer changes an entry
+	for key := range p.data {
+		if key[:6] == "entry/" {
+			p.data[key] = append(p.data[key], 0)
+		}
+	}
+
+	s := newStore()
+	synced, err := NewSyncer(s, p).Sync(context.Background())
+	if err == nil || synced != 0 || len(s.dBlocks) != 0 {
+		t.Errorf("changed entry synced")
+	}
+
+	// The peer makes up an Admin Block that does not link to the one before
+	p = newPeer(t)
+	aBlock, _ := common.CreateAdminBlock(&common.AdminChain{NextBlockHeight: 1}, nil)
+	aBlock.BuildABHash()
+	p.put("ablock", aBlock.ABHash.String(), aBlock)
+	dBlock := new(common.DirectoryBlock)
+	dBlock.UnmarshalBinary(p.data["dblockbyheight/1"])
+	dBlock.DBEntries[0].MerkleRoot = aBlock.ABHash
+	dBlock.Header.BodyMR, _ = dBlock.BuildBodyMR()
+	p.put("dblockbyheight", "1", dBlock)
+
+	s = newStore()
+	synced, err = NewSyncer(s, p).Sync(context.Background())
+	if err == nil || synced != 1 || len(s.aBlocks) != 1 {
+		t.Errorf("unlinked ABlock synced")
+	}
+}
+
+func TestCheckAndRepair(t *testing.T) {
+	p := newPeer(t)
+	s := newStore()
+	if _, err := NewSyncer(s, p).Sync(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	missing, err := Check(s)
+	if err != nil || len(missing) != 0 {
+		t.Fatalf("missing %v in a synced database: %v", missing, err)
+	}
+
+	// Lose the entry, the Admin Block of the second DBlock and the first
+	// DBlock
+	for key := range s.entries {
+		delete(s.entries, key)
+	}
+	for key, b := range s.aBlocks {
+		if b.DBHeight == 1 {
+			delete(s.aBlocks, key)
+		}
+	}
+	first := s.dBlocks[0]
+	s.dBlocks[0] = nil
+
+	missing, err = Check(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 2 || missing[0].Kind != "dblock" || missing[1].Kind != "ablock" {
+		t.Fatalf("wrong missing %v", missing)
+	}
+
+	// The first DBlock is checked against the second when it is repaired
+	repaired, err := NewSyncer(s, p).Repair(context.Background(), missing)
+	if err != nil || repaired != 2 {
+		t.Fatalf("repaired %d: %v", repaired, err)
+	}
+	if !s.dBlocks[0].KeyMR.IsSameAs(first.KeyMR) || len(s.entries) != 1 || len(s.aBlocks) != 2 {
+		t.Errorf("not repaired")
+	}
+	if s.rebuilt != 1 {
+		t.Errorf("chain records counted %d times after an entry was repaired", s.rebuilt)
+	}
+
+	missing, _ = Check(s)
+	if len(missing) != 0 {
+		t.Errorf("still missing %v", missing)
+	}
+
+	// An entry the peer changed is not stored
+	for key := range s.entries {
+		delete(s.entries, key)
+	}
+	for key := range p.data {
+		if key[:6] == "entry/" {
+			p.data[key] = append(p.data[key], 0)
+		}
+	}
+	missing, _ = Check(s)
+	repaired, err = NewSyncer(s, p).Repair(context.Background(), missing)
+	if err == nil || repaired != 0 || len(s.entries) != 0 {
+		t.Errorf("changed entry repaired")
+	}
+}
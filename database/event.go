@@ -0,0 +1,184 @@
+package database
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// EventType identifies the kind of object an Event refers to
+type EventType uint8
+
+const (
+	EventDBlock EventType = iota
+	EventEBlock
+	EventCBlock
+	EventEntry
+	EventRollback
+)
+
+var eventTypeNames = map[EventType]string{
+	EventDBlock:   "dblock",
+	EventEBlock:   "eblock",
+	EventCBlock:   "ecblock",
+	EventEntry:    "entry",
+	EventRollback: "rollback",
+}
+
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseEventType returns the EventType for a name as returned by String
+func ParseEventType(name string) (t EventType, ok bool) {
+	for t, n := range eventTypeNames {
+		if n == name {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// Event describes an object that has been persisted to the database, or a
+// rollback of the changes since the last Sync.
+type Event struct {
+	Type EventType
+
+	// Hash is the DBHash, EBHash, CBHash or entry hash of the stored object
+	Hash *common.Hash
+
+	// KeyMR is the key merkle root of a block, if it is known
+	KeyMR *common.Hash
+
+	// ChainID is the chain of an EBlock or entry
+	ChainID *common.Hash
+
+	// Height is the Directory Block height the object belongs to
+	Height uint32
+}
+
+// Observer is notified of database events. Notify is called from a
+// goroutine belonging to the subscription, so a slow observer only holds up
+// its own events.
+type Observer interface {
+	Notify(e *Event)
+}
+
+// ObserverFunc adapts an ordinary function to the Observer interface
+type ObserverFunc func(e *Event)
+
+func (f ObserverFunc) Notify(e *Event) {
+	f(e)
+}
+
+// ObserverQueueSize is the number of events buffered for an Observer
+// before further events are dropped for it.
+const ObserverQueueSize = 1000
+
+// Subscription is a registration with an EventFeed
+type Subscription struct {
+	queue    chan *Event
+	observer Observer
+	dropped  uint64
+}
+
+// C returns the channel of a subscription created with SubscribeChan. It is
+// closed when the subscription ends.
+func (s *Subscription) C() <-chan *Event {
+	return s.queue
+}
+
+// Dropped returns the number of events the subscriber missed because its
+// queue was full.
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+func (s *Subscription) deliver() {
+	for e := range s.queue {
+		s.observer.Notify(e)
+	}
+}
+
+// EventFeed passes database events on to its subscribers. Publish never
+// blocks: every subscriber has its own queue, and a subscriber whose queue
+// is full misses the event rather than stalling block processing.
+type EventFeed struct {
+	mutex sync.Mutex
+	subs  map[*Subscription]bool
+}
+
+func NewEventFeed() *EventFeed {
+	return &EventFeed{subs: make(map[*Subscription]bool)}
+}
+
+// Subscribe registers o to be notified of every event published after the
+// call.
+func (f *EventFeed) Subscribe(o Observer) *Subscription {
+	s := &Subscription{
+		queue:    make(chan *Event, ObserverQueueSize),
+		observer: o,
+	}
+	go s.deliver()
+
+	f.add(s)
+	return s
+}
+
+// SubscribeChan returns a subscription whose events are read from its C
+// channel, which buffers up to size events.
+func (f *EventFeed) SubscribeChan(size int) *Subscription {
+	s := &Subscription{
+		queue: make(chan *Event, size),
+	}
+
+	f.add(s)
+	return s
+}
+
+func (f *EventFeed) add(s *Subscription) {
+	f.mutex.Lock()
+	f.subs[s] = true
+	f.mutex.Unlock()
+}
+
+// Unsubscribe ends s. Events already queued are still delivered to an
+// Observer.
+func (f *EventFeed) Unsubscribe(s *Subscription) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if f.subs[s] {
+		delete(f.subs, s)
+		close(s.queue)
+	}
+}
+
+// Publish queues e for all subscribers
+func (f *EventFeed) Publish(e *Event) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for s := range f.subs {
+		select {
+		case s.queue <- e:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// Close ends all subscriptions
+func (f *EventFeed) Close() {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for s := range f.subs {
+		delete(f.subs, s)
+		close(s.queue)
+	}
+}
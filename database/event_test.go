@@ -0,0 +1,71 @@
+package database
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEventFeedSlowObserver(t *testing.T) {
+	feed := NewEventFeed()
+
+	block := make(chan struct{})
+	slow := feed.Subscribe(ObserverFunc(func(e *Event) {
+		<-block
+	}))
+
+	received := make(chan *Event, ObserverQueueSize*2)
+	fast := feed.Subscribe(ObserverFunc(func(e *Event) {
+		received <- e
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < ObserverQueueSize*2; i++ {
+			feed.Publish(&Event{Type: EventEntry, Height: uint32(i)})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Publish blocked on a slow observer")
+	}
+
+	for i := 0; i < ObserverQueueSize; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("fast observer got %v events", i)
+		}
+	}
+
+	if slow.Dropped() == 0 {
+		t.Errorf("slow observer did not drop any events")
+	}
+
+	close(block)
+	feed.Unsubscribe(slow)
+	feed.Unsubscribe(fast)
+}
+
+func TestEventFeedChan(t *testing.T) {
+	feed := NewEventFeed()
+	sub := feed.SubscribeChan(1)
+
+	feed.Publish(&Event{Type: EventDBlock})
+	feed.Publish(&Event{Type: EventRollback})
+
+	e := <-sub.C()
+	if e.Type != EventDBlock {
+		t.Errorf("got %v event, expected dblock", e.Type)
+	}
+	if sub.Dropped() != 1 {
+		t.Errorf("dropped %v events, expected 1", sub.Dropped())
+	}
+
+	feed.Close()
+	if _, ok := <-sub.C(); ok {
+		t.Errorf("channel still open after Close")
+	}
+}
@@ -0,0 +1,502 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package btree is a kv.Store in pure Go. The keys and values are kept in a
+// B+tree in memory, and each batch written is appended to a log file the tree
+// is read back from when the store is opened. The log is rewritten with just
+// the keys and values in the tree when it has grown to twice the size it was
+// last rewritten at. All of the store is in memory, which suits small
+// databases and tests better than a full node.
+package btree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/FactomProject/FactomCode/database/kv"
+)
+
+// LogName is the name of the log file in the directory of a store
+const LogName = "btree.log"
+
+// minCompactSize is the smallest log that is rewritten
+const minCompactSize = 16 * 1024 * 1024
+
+// maxRecordSize is the most bytes of rows written in one record when the log
+// is rewritten
+const maxRecordSize = 1024 * 1024
+
+// the operations of the rows of a record
+const (
+	opPut byte = iota
+	opDelete
+)
+
+// Store is a B+tree with a log file
+type Store struct {
+	lock sync.RWMutex
+	t    *tree
+	dir  string
+	file *os.File
+
+	// size of the log, and of the log when last rewritten
+	size          int64
+	compactedSize int64
+
+	// compactErr is the error of the last rewrite of the log
+	compactErr error
+}
+
+var _ kv.Store = (*Store)(nil)
+
+// Open opens the store in dir, making it if there is none
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	s := &Store{t: new(tree), dir: dir}
+	file, err := os.OpenFile(s.logPath(), os.O_RDWR|os.O_CREATE, 0640)
+	if err != nil {
+		return nil, err
+	}
+
+	// A last record cut short by a crash is dropped
+	size, err := s.replay(file)
+	if err == nil {
+		err = file.Truncate(size)
+	}
+	if err == nil {
+		_, err = file.Seek(size, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	s.file = file
+	s.size = size
+	s.compactedSize = size
+	return s, nil
+}
+
+func (s *Store) logPath() string {
+	return filepath.Join(s.dir, LogName)
+}
+
+// replay reads the log into the tree, returning the size of the whole
+// records. Only the last record can have been cut short by a crash, so a bad
+// record anywhere else fails the replay.
+func (s *Store) replay(file *os.File) (int64, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	end := info.Size()
+
+	r := bufio.NewReader(file)
+	var size int64
+	header := make([]byte, 8)
+	for size < end {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return size, nil
+		}
+		n := binary.BigEndian.Uint32(header)
+		if size+int64(len(header))+int64(n) > end {
+			return size, nil
+		}
+		data := make([]byte, n)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return 0, err
+		}
+		if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) {
+			if size+int64(len(header)+len(data)) == end {
+				return size, nil
+			}
+			return 0, fmt.Errorf("btree: bad record at %d in the log", size)
+		}
+
+		t, err := apply(s.t, data)
+		if err != nil {
+			return 0, err
+		}
+		s.t = t
+		size += int64(len(header) + len(data))
+	}
+	return size, nil
+}
+
+func (s *Store) Get(key []byte) ([]byte, error) {
+	t, err := s.tree()
+	if err != nil {
+		return nil, err
+	}
+	return get(t, key)
+}
+
+func (s *Store) Has(key []byte) (bool, error) {
+	t, err := s.tree()
+	if err != nil {
+		return false, err
+	}
+	_, ok := t.get(key)
+	return ok, nil
+}
+
+func (s *Store) NewIterator(r *kv.Range) kv.Iterator {
+	t, err := s.tree()
+	return newIterator(t, r, err)
+}
+
+func (s *Store) Put(key []byte, value []byte) error {
+	b := new(kv.Batch)
+	b.Put(key, value)
+	return s.Write(b)
+}
+
+func (s *Store) Delete(key []byte) error {
+	b := new(kv.Batch)
+	b.Delete(key)
+	return s.Write(b)
+}
+
+// Write appends the batch to the log and puts it in the tree
+func (s *Store) Write(b *kv.Batch) error {
+	var data bytes.Buffer
+	b.Replay(func(key []byte, value []byte) {
+		writeRow(&data, opPut, key, value)
+	}, func(key []byte) {
+		writeRow(&data, opDelete, key, nil)
+	})
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return kv.ErrClosed
+	}
+	t, err := apply(s.t, data.Bytes())
+	if err != nil {
+		return err
+	}
+	n, err := writeRecord(s.file, data.Bytes())
+	if err != nil {
+		// Take off what was written of the record, and close the store if
+		// that cannot be done, so nothing is written after it
+		if terr := s.truncate(); terr != nil {
+			s.file.Close()
+			s.file = nil
+		}
+		return err
+	}
+	s.t = t
+	s.size += n
+
+	// The batch is written, so a failed rewrite is kept for Report and
+	// tried again on the next write
+	if s.size >= minCompactSize && s.size >= 2*s.compactedSize {
+		s.compactErr = s.compact()
+	}
+	return nil
+}
+
+// truncate cuts the log back to the size of the whole records. It is called
+// with the lock held.
+func (s *Store) truncate() error {
+	if err := s.file.Truncate(s.size); err != nil {
+		return err
+	}
+	_, err := s.file.Seek(s.size, io.SeekStart)
+	return err
+}
+
+// Snapshot returns the tree as it is now, which is never changed
+func (s *Store) Snapshot() (kv.Snapshot, error) {
+	t, err := s.tree()
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{t: t}, nil
+}
+
+// Compact rewrites the log with just the keys and values in the tree
+func (s *Store) Compact() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return kv.ErrClosed
+	}
+	return s.compact()
+}
+
+// Report returns the number of keys, levels of the tree and size of the log
+func (s *Store) Report() (string, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.file == nil {
+		return "", kv.ErrClosed
+	}
+	report := fmt.Sprintf("btree: %d keys, %d levels, log %d bytes, %d when last rewritten",
+		s.t.count, s.t.height(), s.size, s.compactedSize)
+	if s.compactErr != nil {
+		report += fmt.Sprintf(", last rewrite failed: %v", s.compactErr)
+	}
+	return report, nil
+}
+
+// Close syncs the log to disk and closes it
+func (s *Store) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.file == nil {
+		return kv.ErrClosed
+	}
+	err := s.file.Sync()
+	if cerr := s.file.Close(); err == nil {
+		err = cerr
+	}
+	s.file = nil
+	return err
+}
+
+func (s *Store) tree() (*tree, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	if s.file == nil {
+		return nil, kv.ErrClosed
+	}
+	return s.t, nil
+}
+
+// compact writes the tree to a new log, and puts it in place of the old one.
+// It is called with the lock held.
+func (s *Store) compact() error {
+	tmpPath := s.logPath() + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0640)
+	if err != nil {
+		return err
+	}
+
+	size, err := writeTree(tmp, s.t)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, s.logPath())
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+
+	s.file.Close()
+	s.file = tmp
+	s.size = size
+	s.compactedSize = size
+	s.compactErr = nil
+	return nil
+}
+
+// writeTree writes the keys and values of a tree as records
+func writeTree(file *os.File, t *tree) (int64, error) {
+	w := bufio.NewWriter(file)
+	var size int64
+	var data bytes.Buffer
+
+	c := new(cursor)
+	for c.first(t.root, nil); c.valid(); c.next() {
+		writeRow(&data, opPut, c.key(), c.value())
+		if data.Len() >= maxRecordSize {
+			n, err := writeRecord(w, data.Bytes())
+			if err != nil {
+				return 0, err
+			}
+			size += n
+			data.Reset()
+		}
+	}
+	if data.Len() > 0 {
+		n, err := writeRecord(w, data.Bytes())
+		if err != nil {
+			return 0, err
+		}
+		size += n
+	}
+	return size, w.Flush()
+}
+
+// writeRecord writes the length, the crc32 and the rows of a record at once
+func writeRecord(w io.Writer, data []byte) (int64, error) {
+	record := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint32(record, uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:], crc32.ChecksumIEEE(data))
+	copy(record[8:], data)
+	_, err := w.Write(record)
+	return int64(len(record)), err
+}
+
+// writeRow writes the operation, and the key and value after their lengths
+func writeRow(buf *bytes.Buffer, op byte, key []byte, value []byte) {
+	var n [binary.MaxVarintLen64]byte
+	buf.WriteByte(op)
+	buf.Write(n[:binary.PutUvarint(n[:], uint64(len(key)))])
+	buf.Write(key)
+	if op == opPut {
+		buf.Write(n[:binary.PutUvarint(n[:], uint64(len(value)))])
+		buf.Write(value)
+	}
+}
+
+// apply returns the tree with the rows of a record put in
+func apply(t *tree, data []byte) (*tree, error) {
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		op, _ := r.ReadByte()
+		key, err := readBytes(r)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case opPut:
+			value, err := readBytes(r)
+			if err != nil {
+				return nil, err
+			}
+			t = t.put(key, value)
+		case opDelete:
+			t = t.delete(key)
+		default:
+			return nil, fmt.Errorf("btree: unknown operation %d in the log", op)
+		}
+	}
+	return t, nil
+}
+
+func readBytes(r *bytes.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		return nil, fmt.Errorf("btree: bad row in the log")
+	}
+	b := make([]byte, n)
+	r.Read(b)
+	return b, nil
+}
+
+func get(t *tree, key []byte) ([]byte, error) {
+	value, ok := t.get(key)
+	if !ok {
+		return nil, kv.ErrNotFound
+	}
+	return value, nil
+}
+
+// snapshot is a tree, which is never changed
+type snapshot struct {
+	t *tree
+}
+
+func (s *snapshot) Get(key []byte) ([]byte, error) {
+	return get(s.t, key)
+}
+
+func (s *snapshot) Has(key []byte) (bool, error) {
+	_, ok := s.t.get(key)
+	return ok, nil
+}
+
+func (s *snapshot) NewIterator(r *kv.Range) kv.Iterator {
+	return newIterator(s.t, r, nil)
+}
+
+func (s *snapshot) Release() {
+}
+
+// iterator goes over a range of a tree
+type iterator struct {
+	t       *tree
+	r       kv.Range
+	c       cursor
+	started bool
+	err     error
+}
+
+func newIterator(t *tree, r *kv.Range, err error) *iterator {
+	it := &iterator{t: t, err: err}
+	if r != nil {
+		it.r = *r
+	}
+	return it
+}
+
+func (it *iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		it.c.first(it.t.root, it.r.Start)
+	} else if it.c.valid() {
+		it.c.next()
+	}
+	return it.inRange()
+}
+
+func (it *iterator) Last() bool {
+	if it.err != nil {
+		return false
+	}
+	it.started = true
+	it.c.last(it.t.root, it.r.Limit)
+	return it.inRange()
+}
+
+// inRange tells if the cursor is at a key of the range, and moves it off the
+// end if it is not
+func (it *iterator) inRange() bool {
+	if !it.c.valid() {
+		return false
+	}
+	key := it.c.key()
+	if (it.r.Limit != nil && bytes.Compare(key, it.r.Limit) >= 0) ||
+		(it.r.Start != nil && bytes.Compare(key, it.r.Start) < 0) {
+		it.c.stack = it.c.stack[:0]
+		return false
+	}
+	return true
+}
+
+func (it *iterator) Key() []byte {
+	if !it.c.valid() {
+		return nil
+	}
+	return it.c.key()
+}
+
+func (it *iterator) Value() []byte {
+	if !it.c.valid() {
+		return nil
+	}
+	return it.c.value()
+}
+
+func (it *iterator) Release() {
+	it.c.stack = nil
+}
+
+func (it *iterator) Error() error {
+	return it.err
+}
@@ -0,0 +1,166 @@
+package btree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/database/kv"
+	"github.com/FactomProject/FactomCode/database/kv/kvtest"
+)
+
+func TestStore(t *testing.T) {
+	kvtest.Run(t, func(dir string) (kv.Store, error) {
+		return Open(dir)
+	})
+}
+
+// TestReplay opens logs with a torn last record, which is dropped, and with a
+// bad record before others, which is refused
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "btree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := s.Put([]byte{byte(i)}, []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Close()
+	path := filepath.Join(dir, LogName)
+	log, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	record := len(log) / 3
+
+	for _, c := range []struct {
+		name string
+		log  []byte
+		keys int
+	}{
+		{"whole", log, 3},
+		{"short header", log[:2*record+4], 2},
+		{"short record", log[:len(log)-1], 2},
+		{"bad last record", flip(log, len(log)-1), 2},
+		{"bad record", flip(log, record+10), -1},
+	} {
+		if err := ioutil.WriteFile(path, c.log, 0640); err != nil {
+			t.Fatal(err)
+		}
+		s, err := Open(dir)
+		if c.keys < 0 {
+			if err == nil {
+				s.Close()
+				t.Errorf("%s: opened", c.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if s.t.count != c.keys || s.size != int64(c.keys*record) {
+			t.Errorf("%s: %d keys in %d bytes", c.name, s.t.count, s.size)
+		}
+		s.Close()
+		if info, _ := os.Stat(path); info.Size() != int64(c.keys*record) {
+			t.Errorf("%s: log of %d bytes left", c.name, info.Size())
+		}
+	}
+}
+
+// flip returns a copy of b with a bit of byte i changed
+func flip(b []byte, i int) []byte {
+	c := append([]byte{}, b...)
+	c[i] ^= 1
+	return c
+}
+
+// TestTree puts and deletes random keys, and checks the tree against a map
+// and that older trees are not changed
+func TestTree(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	tr := new(tree)
+	m := make(map[string]string)
+
+	var old *tree
+	var oldKeys []string
+	for i := 0; i < 20000; i++ {
+		k := fmt.Sprintf("%05d", rnd.Intn(5000))
+		if rnd.Intn(3) == 0 {
+			tr = tr.delete([]byte(k))
+			delete(m, k)
+		} else {
+			tr = tr.put([]byte(k), []byte(fmt.Sprint(i)))
+			m[k] = fmt.Sprint(i)
+		}
+		if i == 10000 {
+			old, oldKeys = tr, sortedKeys(m)
+		}
+	}
+
+	keys := sortedKeys(m)
+	if tr.count != len(keys) {
+		t.Errorf("count %d, %d keys", tr.count, len(keys))
+	}
+	checkKeys(t, tr, keys)
+	checkKeys(t, old, oldKeys)
+	for _, k := range keys {
+		if v, ok := tr.get([]byte(k)); !ok || string(v) != m[k] {
+			t.Fatalf("key %s is %q", k, v)
+		}
+	}
+
+	// The last key before a limit
+	for i := 0; i < 1000; i++ {
+		limit := fmt.Sprintf("%05d", rnd.Intn(5100))
+		want := sort.SearchStrings(keys, limit) - 1
+		it := newIterator(tr, &kv.Range{Limit: []byte(limit)}, nil)
+		if it.Last() != (want >= 0) || (want >= 0 && string(it.Key()) != keys[want]) {
+			t.Fatalf("last before %s is %q", limit, it.Key())
+		}
+	}
+
+	// Deleting all of the keys empties the tree
+	for _, k := range keys {
+		tr = tr.delete([]byte(k))
+	}
+	if tr.root != nil || tr.count != 0 {
+		t.Errorf("tree not empty")
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func checkKeys(t *testing.T, tr *tree, keys []string) {
+	it := newIterator(tr, nil, nil)
+	i := 0
+	for it.Next() {
+		if i >= len(keys) || string(it.Key()) != keys[i] {
+			t.Fatalf("key %d is %q", i, it.Key())
+		}
+		i++
+	}
+	if i != len(keys) {
+		t.Errorf("iterated %d of %d keys", i, len(keys))
+	}
+}
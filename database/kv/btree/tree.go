@@ -0,0 +1,344 @@
+package btree
+
+import (
+	"bytes"
+	"sort"
+)
+
+// order is the most keys in a node before it is split
+const order = 64
+
+// node is a node of the tree, a leaf if it has no children. The child i of an
+// inner node holds the keys from keys[i-1] up to but not including keys[i].
+// Nodes are never changed once in a tree, a change copies the nodes on the
+// path to the key.
+type node struct {
+	keys     [][]byte
+	values   [][]byte // of a leaf
+	children []*node  // of an inner node, one more than the keys
+}
+
+// tree is a B+tree that is not changed. put and delete return a new one.
+// Deletes do not merge nodes, but a node left empty is removed.
+type tree struct {
+	root  *node
+	count int
+}
+
+func (n *node) leaf() bool {
+	return n.children == nil
+}
+
+func (n *node) clone() *node {
+	c := &node{keys: append([][]byte{}, n.keys...)}
+	if n.leaf() {
+		c.values = append([][]byte{}, n.values...)
+	} else {
+		c.children = append([]*node{}, n.children...)
+	}
+	return c
+}
+
+// search returns the index of the first key of the node not before key
+func (n *node) search(key []byte) int {
+	return sort.Search(len(n.keys), func(i int) bool {
+		return bytes.Compare(n.keys[i], key) >= 0
+	})
+}
+
+// child returns the index of the child of an inner node holding key
+func (n *node) child(key []byte) int {
+	return sort.Search(len(n.keys), func(i int) bool {
+		return bytes.Compare(n.keys[i], key) > 0
+	})
+}
+
+func (t *tree) get(key []byte) ([]byte, bool) {
+	n := t.root
+	if n == nil {
+		return nil, false
+	}
+	for !n.leaf() {
+		n = n.children[n.child(key)]
+	}
+	i := n.search(key)
+	if i < len(n.keys) && bytes.Equal(n.keys[i], key) {
+		return n.values[i], true
+	}
+	return nil, false
+}
+
+func (t *tree) put(key []byte, value []byte) *tree {
+	if t.root == nil {
+		return &tree{root: &node{keys: [][]byte{key}, values: [][]byte{value}}, count: 1}
+	}
+
+	root, split, sep, added := t.root.put(key, value)
+	if split != nil {
+		root = &node{keys: [][]byte{sep}, children: []*node{root, split}}
+	}
+	count := t.count
+	if added {
+		count++
+	}
+	return &tree{root: root, count: count}
+}
+
+// put returns a copy of the node with the key put in, and the node split off
+// it with the first key of that, if it was too full
+func (n *node) put(key []byte, value []byte) (c *node, split *node, sep []byte, added bool) {
+	c = n.clone()
+	if c.leaf() {
+		i := c.search(key)
+		if i < len(c.keys) && bytes.Equal(c.keys[i], key) {
+			c.values[i] = value
+			return c, nil, nil, false
+		}
+		c.keys = insertBytes(c.keys, i, key)
+		c.values = insertBytes(c.values, i, value)
+		added = true
+	} else {
+		i := c.child(key)
+		var childSplit *node
+		var childSep []byte
+		c.children[i], childSplit, childSep, added = c.children[i].put(key, value)
+		if childSplit != nil {
+			c.keys = insertBytes(c.keys, i, childSep)
+			c.children = append(c.children, nil)
+			copy(c.children[i+2:], c.children[i+1:])
+			c.children[i+1] = childSplit
+		}
+	}
+
+	if len(c.keys) > order {
+		split, sep = c.split()
+	}
+	return c, split, sep, added
+}
+
+// split moves the upper half of a node to a new one, returning it and the key
+// between them
+func (n *node) split() (*node, []byte) {
+	mid := len(n.keys) / 2
+	right := new(node)
+	if n.leaf() {
+		right.keys = append([][]byte{}, n.keys[mid:]...)
+		right.values = append([][]byte{}, n.values[mid:]...)
+		n.keys = n.keys[:mid:mid]
+		n.values = n.values[:mid:mid]
+		return right, right.keys[0]
+	}
+
+	sep := n.keys[mid]
+	right.keys = append([][]byte{}, n.keys[mid+1:]...)
+	right.children = append([]*node{}, n.children[mid+1:]...)
+	n.keys = n.keys[:mid:mid]
+	n.children = n.children[: mid+1 : mid+1]
+	return right, sep
+}
+
+func (t *tree) delete(key []byte) *tree {
+	if t.root == nil {
+		return t
+	}
+
+	root, removed := t.root.delete(key)
+	if !removed {
+		return t
+	}
+	for root != nil && !root.leaf() && len(root.children) == 1 {
+		root = root.children[0]
+	}
+	return &tree{root: root, count: t.count - 1}
+}
+
+// delete returns a copy of the node without the key, or nil if it is left
+// empty
+func (n *node) delete(key []byte) (*node, bool) {
+	if n.leaf() {
+		i := n.search(key)
+		if i == len(n.keys) || !bytes.Equal(n.keys[i], key) {
+			return n, false
+		}
+		if len(n.keys) == 1 {
+			return nil, true
+		}
+		c := n.clone()
+		c.keys = append(c.keys[:i], c.keys[i+1:]...)
+		c.values = append(c.values[:i], c.values[i+1:]...)
+		return c, true
+	}
+
+	i := n.child(key)
+	child, removed := n.children[i].delete(key)
+	if !removed {
+		return n, false
+	}
+
+	if child != nil {
+		c := n.clone()
+		c.children[i] = child
+		return c, true
+	}
+	if len(n.children) == 1 {
+		return nil, true
+	}
+
+	// The empty child goes, with the key before it, or after it if it is
+	// the first
+	c := n.clone()
+	c.children = append(c.children[:i], c.children[i+1:]...)
+	if i > 0 {
+		i--
+	}
+	c.keys = append(c.keys[:i], c.keys[i+1:]...)
+	return c, true
+}
+
+// height is the number of levels of the tree
+func (t *tree) height() int {
+	h := 0
+	for n := t.root; n != nil; h++ {
+		if n.leaf() {
+			n = nil
+		} else {
+			n = n.children[0]
+		}
+	}
+	return h
+}
+
+func insertBytes(s [][]byte, i int, b []byte) [][]byte {
+	s = append(s, nil)
+	copy(s[i+1:], s[i:])
+	s[i] = b
+	return s
+}
+
+// frame is a node on the path of a cursor, and the index of the child or key
+// the path goes through
+type frame struct {
+	n *node
+	i int
+}
+
+// cursor is a position in a tree, at a key of a leaf. Its leaves are never
+// empty, so it is at a key unless it has gone off either end.
+type cursor struct {
+	stack []frame
+}
+
+func (c *cursor) valid() bool {
+	return len(c.stack) > 0
+}
+
+func (c *cursor) key() []byte {
+	f := c.stack[len(c.stack)-1]
+	return f.n.keys[f.i]
+}
+
+func (c *cursor) value() []byte {
+	f := c.stack[len(c.stack)-1]
+	return f.n.values[f.i]
+}
+
+// first moves to the first key not before key, or the first key if key is
+// nil
+func (c *cursor) first(root *node, key []byte) {
+	c.stack = c.stack[:0]
+	if root == nil {
+		return
+	}
+
+	n := root
+	for !n.leaf() {
+		i := 0
+		if key != nil {
+			i = n.child(key)
+		}
+		c.stack = append(c.stack, frame{n, i})
+		n = n.children[i]
+	}
+
+	i := 0
+	if key != nil {
+		i = n.search(key)
+	}
+	c.stack = append(c.stack, frame{n, i})
+	if i == len(n.keys) {
+		c.nextLeaf()
+	}
+}
+
+// last moves to the last key before limit, or the last key if limit is nil
+func (c *cursor) last(root *node, limit []byte) {
+	c.stack = c.stack[:0]
+	if root == nil {
+		return
+	}
+
+	n := root
+	for !n.leaf() {
+		i := len(n.children) - 1
+		if limit != nil {
+			i = n.search(limit)
+		}
+		c.stack = append(c.stack, frame{n, i})
+		n = n.children[i]
+	}
+
+	i := len(n.keys) - 1
+	if limit != nil {
+		i = n.search(limit) - 1
+	}
+	c.stack = append(c.stack, frame{n, i})
+	if i < 0 {
+		c.prevLeaf()
+	}
+}
+
+func (c *cursor) next() {
+	f := &c.stack[len(c.stack)-1]
+	f.i++
+	if f.i == len(f.n.keys) {
+		c.nextLeaf()
+	}
+}
+
+// nextLeaf moves to the first key of the next leaf
+func (c *cursor) nextLeaf() {
+	c.stack = c.stack[:len(c.stack)-1]
+	for len(c.stack) > 0 {
+		f := &c.stack[len(c.stack)-1]
+		f.i++
+		if f.i < len(f.n.children) {
+			n := f.n.children[f.i]
+			for !n.leaf() {
+				c.stack = append(c.stack, frame{n, 0})
+				n = n.children[0]
+			}
+			c.stack = append(c.stack, frame{n, 0})
+			return
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+}
+
+// prevLeaf moves to the last key of the leaf before
+func (c *cursor) prevLeaf() {
+	c.stack = c.stack[:len(c.stack)-1]
+	for len(c.stack) > 0 {
+		f := &c.stack[len(c.stack)-1]
+		f.i--
+		if f.i >= 0 {
+			n := f.n.children[f.i]
+			for !n.leaf() {
+				c.stack = append(c.stack, frame{n, len(n.children) - 1})
+				n = n.children[len(n.children)-1]
+			}
+			c.stack = append(c.stack, frame{n, len(n.keys) - 1})
+			return
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+	}
+}
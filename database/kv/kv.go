@@ -0,0 +1,154 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package kv is the ordered key value store the blocks and entries of the
+// database are kept in. The keys sort bytewise. The stores are in the
+// packages under it, leveldbkv over goleveldb and btree a B+tree of its own.
+package kv
+
+import (
+	"errors"
+)
+
+// ErrNotFound is returned by Get for a key that is not in the store
+var ErrNotFound = errors.New("kv: not found")
+
+// ErrClosed is returned by a store that has been closed
+var ErrClosed = errors.New("kv: closed")
+
+// Reader reads a store, or a snapshot of it
+type Reader interface {
+	// Get returns the value of a key, or ErrNotFound. The value must not
+	// be changed.
+	Get(key []byte) (value []byte, err error)
+
+	// Has tells if a key is in the store
+	Has(key []byte) (bool, error)
+
+	// NewIterator iterates over the keys in r in order, or all of the keys
+	// if r is nil. The iterator must be released.
+	NewIterator(r *Range) Iterator
+}
+
+// Store is an ordered key value store, safe for concurrent use
+type Store interface {
+	Reader
+
+	Put(key []byte, value []byte) error
+	Delete(key []byte) error
+
+	// Write writes all of the batch, or none of it
+	Write(b *Batch) error
+
+	// Snapshot returns a view of the store as it is now. It must be
+	// released.
+	Snapshot() (Snapshot, error)
+
+	Close() error
+}
+
+// Snapshot is a point in time view of a store
+type Snapshot interface {
+	Reader
+	Release()
+}
+
+// Iterator goes over the keys of a range in order. It starts before the
+// first key.
+type Iterator interface {
+	// Next moves to the next key, and returns false after the last one
+	Next() bool
+
+	// Last moves to the last key, and returns false if there is none
+	Last() bool
+
+	// Key and Value are valid until the iterator moves, and must not be
+	// changed
+	Key() []byte
+	Value() []byte
+
+	Release()
+	Error() error
+}
+
+// Range is the keys from Start up to but not including Limit. A nil Start is
+// before the first key, and a nil Limit after the last.
+type Range struct {
+	Start []byte
+	Limit []byte
+}
+
+// Compacter is a store that can compact itself on disk
+type Compacter interface {
+	Compact() error
+}
+
+// Sizer is a store that knows the approximate size on disk of ranges of keys
+type Sizer interface {
+	SizeOf(ranges []Range) ([]int64, error)
+}
+
+// Reporter is a store that reports on its internals
+type Reporter interface {
+	Report() (string, error)
+}
+
+// Batch is a list of puts and deletes written together
+type Batch struct {
+	rows []row
+	size int
+}
+
+// row is a put, or a delete if delete is true
+type row struct {
+	key    []byte
+	value  []byte
+	delete bool
+}
+
+// Put adds a put of a copy of key and value
+func (b *Batch) Put(key []byte, value []byte) {
+	b.rows = append(b.rows, row{key: clone(key), value: clone(value)})
+	b.size += len(key) + len(value)
+}
+
+// Delete adds a delete of a copy of key
+func (b *Batch) Delete(key []byte) {
+	b.rows = append(b.rows, row{key: clone(key), delete: true})
+	b.size += len(key)
+}
+
+// Len is the number of puts and deletes
+func (b *Batch) Len() int {
+	return len(b.rows)
+}
+
+// Size is the bytes of the keys and values
+func (b *Batch) Size() int {
+	return b.size
+}
+
+// Reset empties the batch
+func (b *Batch) Reset() {
+	b.rows = b.rows[:0]
+	b.size = 0
+}
+
+// Replay calls put and del with the puts and deletes in order
+func (b *Batch) Replay(put func(key []byte, value []byte), del func(key []byte)) {
+	for _, r := range b.rows {
+		if r.delete {
+			del(r.key)
+		} else {
+			put(r.key, r.value)
+		}
+	}
+}
+
+// clone copies b to a slice of its own, with no room to append to
+func clone(b []byte) []byte {
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
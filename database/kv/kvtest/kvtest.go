@@ -0,0 +1,357 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package kvtest checks that a kv.Store behaves as the database expects. The
+// tests of each store run it.
+package kvtest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/database/kv"
+)
+
+// Opener opens the store in dir, making it if there is none
+type Opener func(dir string) (kv.Store, error)
+
+// Run runs all of the checks on stores opened with open
+func Run(t *testing.T, open Opener) {
+	checks := []struct {
+		name string
+		f    func(t *testing.T, open Opener, dir string)
+	}{
+		{"GetPutDelete", testGetPutDelete},
+		{"Batch", testBatch},
+		{"Iterator", testIterator},
+		{"Snapshot", testSnapshot},
+		{"Reopen", testReopen},
+		{"Concurrent", testConcurrent},
+	}
+
+	for _, c := range checks {
+		t.Run(c.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "kvtest")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			c.f(t, open, dir)
+		})
+	}
+}
+
+func mustOpen(t *testing.T, open Opener, dir string) kv.Store {
+	s, err := open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// key makes the key of table and i, which sort by table and then i
+func key(table byte, i int) []byte {
+	return []byte(fmt.Sprintf("%c%08d", table, i))
+}
+
+// fill puts n keys in each of the tables
+func fill(t *testing.T, s kv.Store, tables []byte, n int) {
+	b := new(kv.Batch)
+	for _, table := range tables {
+		for i := 0; i < n; i++ {
+			b.Put(key(table, i), []byte(fmt.Sprint(i)))
+		}
+	}
+	if err := s.Write(b); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testGetPutDelete(t *testing.T, open Opener, dir string) {
+	s := mustOpen(t, open, dir)
+	defer s.Close()
+
+	if _, err := s.Get([]byte("a")); err != kv.ErrNotFound {
+		t.Errorf("missing key: %v", err)
+	}
+	if err := s.Put([]byte("a"), []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := s.Get([]byte("a")); err != nil || string(v) != "1" {
+		t.Errorf("got %q, %v", v, err)
+	}
+	if ok, _ := s.Has([]byte("a")); !ok {
+		t.Errorf("key not there")
+	}
+
+	s.Put([]byte("a"), []byte("2"))
+	if v, _ := s.Get([]byte("a")); string(v) != "2" {
+		t.Errorf("not replaced, got %q", v)
+	}
+
+	// An empty value is a value
+	s.Put([]byte("b"), []byte{})
+	if ok, _ := s.Has([]byte("b")); !ok {
+		t.Errorf("empty value not there")
+	}
+
+	if err := s.Delete([]byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := s.Has([]byte("a")); ok {
+		t.Errorf("key not deleted")
+	}
+	if err := s.Delete([]byte("c")); err != nil {
+		t.Errorf("missing key not deleted: %v", err)
+	}
+}
+
+func testBatch(t *testing.T, open Opener, dir string) {
+	s := mustOpen(t, open, dir)
+	defer s.Close()
+
+	s.Put([]byte("a"), []byte("1"))
+
+	b := new(kv.Batch)
+	b.Put([]byte("b"), []byte("2"))
+	b.Delete([]byte("a"))
+	b.Put([]byte("c"), []byte("3"))
+	b.Put([]byte("b"), []byte("4"))
+	if b.Len() != 4 {
+		t.Errorf("batch of %d", b.Len())
+	}
+	if err := s.Write(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := s.Has([]byte("a")); ok {
+		t.Errorf("key not deleted")
+	}
+	if v, _ := s.Get([]byte("b")); string(v) != "4" {
+		t.Errorf("later put not kept, got %q", v)
+	}
+
+	b.Reset()
+	if b.Len() != 0 || b.Size() != 0 {
+		t.Errorf("batch not reset")
+	}
+}
+
+func testIterator(t *testing.T, open Opener, dir string) {
+	s := mustOpen(t, open, dir)
+	defer s.Close()
+
+	// Enough keys to split the nodes of a tree
+	const n = 1000
+	fill(t, s, []byte{1, 2, 3}, n)
+
+	iter := s.NewIterator(&kv.Range{Start: []byte{2}, Limit: []byte{3}})
+	i := 0
+	for iter.Next() {
+		if !bytes.Equal(iter.Key(), key(2, i)) || string(iter.Value()) != fmt.Sprint(i) {
+			t.Fatalf("key %d is %q", i, iter.Key())
+		}
+		i++
+	}
+	iter.Release()
+	if i != n || iter.Error() != nil {
+		t.Errorf("iterated %d keys: %v", i, iter.Error())
+	}
+
+	iter = s.NewIterator(&kv.Range{Start: []byte{2}, Limit: []byte{3}})
+	if !iter.Last() || !bytes.Equal(iter.Key(), key(2, n-1)) {
+		t.Errorf("last key is %q", iter.Key())
+	}
+	iter.Release()
+
+	// A range from the middle of a table to the middle of the next
+	iter = s.NewIterator(&kv.Range{Start: key(1, n-10), Limit: key(2, 10)})
+	i = 0
+	for iter.Next() {
+		i++
+	}
+	iter.Release()
+	if i != 20 {
+		t.Errorf("iterated %d keys across tables", i)
+	}
+	iter = s.NewIterator(&kv.Range{Start: key(1, n-10), Limit: key(2, 10)})
+	if !iter.Last() || !bytes.Equal(iter.Key(), key(2, 9)) {
+		t.Errorf("last key across tables is %q", iter.Key())
+	}
+	iter.Release()
+
+	// Empty ranges
+	for _, r := range []*kv.Range{
+		{Start: []byte{0}, Limit: []byte{1}},
+		{Start: []byte{4}, Limit: []byte{5}},
+		{Start: key(1, 5), Limit: key(1, 5)},
+	} {
+		iter = s.NewIterator(r)
+		if iter.Next() || iter.Last() {
+			t.Errorf("key %q in empty range %q", iter.Key(), r.Start)
+		}
+		iter.Release()
+	}
+
+	// All of the keys
+	iter = s.NewIterator(nil)
+	i = 0
+	var prev []byte
+	for iter.Next() {
+		if prev != nil && bytes.Compare(prev, iter.Key()) >= 0 {
+			t.Fatalf("%q after %q", iter.Key(), prev)
+		}
+		prev = append(prev[:0], iter.Key()...)
+		i++
+	}
+	iter.Release()
+	if i != 3*n {
+		t.Errorf("iterated %d of all keys", i)
+	}
+
+	// Deleting all but every tenth key of a table
+	b := new(kv.Batch)
+	for i := 0; i < n; i++ {
+		if i%10 != 0 {
+			b.Delete(key(2, i))
+		}
+	}
+	s.Write(b)
+	iter = s.NewIterator(&kv.Range{Start: []byte{2}, Limit: []byte{3}})
+	i = 0
+	for iter.Next() {
+		if !bytes.Equal(iter.Key(), key(2, i*10)) {
+			t.Fatalf("key %d is %q after deletes", i, iter.Key())
+		}
+		i++
+	}
+	iter.Release()
+	if i != n/10 {
+		t.Errorf("iterated %d keys after deletes", i)
+	}
+	iter = s.NewIterator(&kv.Range{Start: []byte{2}, Limit: []byte{3}})
+	if !iter.Last() || !bytes.Equal(iter.Key(), key(2, n-10)) {
+		t.Errorf("last key after deletes is %q", iter.Key())
+	}
+	iter.Release()
+}
+
+func testSnapshot(t *testing.T, open Opener, dir string) {
+	s := mustOpen(t, open, dir)
+	defer s.Close()
+
+	fill(t, s, []byte{1}, 100)
+	snap, err := s.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer snap.Release()
+
+	s.Delete(key(1, 0))
+	s.Put(key(1, 0xffff), []byte("new"))
+	s.Put(key(1, 1), []byte("changed"))
+
+	if v, err := snap.Get(key(1, 0)); err != nil || string(v) != "0" {
+		t.Errorf("deleted key not in the snapshot: %v", err)
+	}
+	if ok, _ := snap.Has(key(1, 0xffff)); ok {
+		t.Errorf("new key in the snapshot")
+	}
+	if v, _ := snap.Get(key(1, 1)); string(v) != "1" {
+		t.Errorf("changed key in the snapshot, got %q", v)
+	}
+
+	iter := snap.NewIterator(&kv.Range{Start: []byte{1}, Limit: []byte{2}})
+	i := 0
+	for iter.Next() {
+		i++
+	}
+	iter.Release()
+	if i != 100 {
+		t.Errorf("iterated %d keys of the snapshot", i)
+	}
+}
+
+func testReopen(t *testing.T, open Opener, dir string) {
+	s := mustOpen(t, open, dir)
+	fill(t, s, []byte{1, 2}, 500)
+	s.Delete(key(1, 7))
+	s.Put(key(2, 7), []byte("changed"))
+	if c, ok := s.(kv.Compacter); ok {
+		if err := c.Compact(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Put(key(2, 8), []byte("after compaction"))
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(key(1, 1)); err == nil {
+		t.Errorf("read after close")
+	}
+
+	s = mustOpen(t, open, dir)
+	defer s.Close()
+
+	if ok, _ := s.Has(key(1, 7)); ok {
+		t.Errorf("deleted key back")
+	}
+	if v, _ := s.Get(key(2, 7)); string(v) != "changed" {
+		t.Errorf("changed key is %q", v)
+	}
+	if v, _ := s.Get(key(2, 8)); string(v) != "after compaction" {
+		t.Errorf("key after compaction is %q", v)
+	}
+
+	iter := s.NewIterator(nil)
+	i := 0
+	for iter.Next() {
+		i++
+	}
+	iter.Release()
+	if i != 999 {
+		t.Errorf("%d keys after reopening", i)
+	}
+}
+
+func testConcurrent(t *testing.T, open Opener, dir string) {
+	s := mustOpen(t, open, dir)
+	defer s.Close()
+
+	fill(t, s, []byte{1}, 100)
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				s.Put(key(byte(2+w), i), []byte("x"))
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if v, err := s.Get(key(1, i)); err != nil || string(v) != fmt.Sprint(i) {
+					t.Errorf("read %q, %v", v, err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	iter := s.NewIterator(nil)
+	i := 0
+	for iter.Next() {
+		i++
+	}
+	iter.Release()
+	if i != 500 {
+		t.Errorf("%d keys after concurrent writes", i)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package leveldbkv is the kv.Store over goleveldb
+package leveldbkv
+
+import (
+	"github.com/FactomProject/FactomCode/database/kv"
+	"github.com/FactomProject/goleveldb/leveldb"
+	"github.com/FactomProject/goleveldb/leveldb/iterator"
+	"github.com/FactomProject/goleveldb/leveldb/opt"
+	"github.com/FactomProject/goleveldb/leveldb/util"
+)
+
+// Store is a leveldb database
+type Store struct {
+	reader
+	lDb *leveldb.DB
+}
+
+// reader reads the database or a snapshot of it
+type reader struct {
+	r interface {
+		Get(key []byte, ro *opt.ReadOptions) (value []byte, err error)
+		Has(key []byte, ro *opt.ReadOptions) (ret bool, err error)
+		NewIterator(slice *util.Range, ro *opt.ReadOptions) iterator.Iterator
+	}
+}
+
+var _ kv.Store = (*Store)(nil)
+
+// Open opens the leveldb database in dir, making it if there is none
+func Open(dir string, opts *opt.Options) (*Store, error) {
+	lDb, err := leveldb.OpenFile(dir, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{reader: reader{lDb}, lDb: lDb}, nil
+}
+
+func (s *Store) Put(key []byte, value []byte) error {
+	return s.lDb.Put(key, value, nil)
+}
+
+func (s *Store) Delete(key []byte) error {
+	return s.lDb.Delete(key, nil)
+}
+
+func (s *Store) Write(b *kv.Batch) error {
+	batch := new(leveldb.Batch)
+	b.Replay(batch.Put, batch.Delete)
+	return s.lDb.Write(batch, nil)
+}
+
+func (s *Store) Snapshot() (kv.Snapshot, error) {
+	snap, err := s.lDb.GetSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{reader: reader{snap}, snap: snap}, nil
+}
+
+func (s *Store) Close() error {
+	return s.lDb.Close()
+}
+
+// Compact compacts the whole database
+func (s *Store) Compact() error {
+	return s.lDb.CompactRange(util.Range{})
+}
+
+// SizeOf returns the approximate sizes on disk of the ranges
+func (s *Store) SizeOf(ranges []kv.Range) ([]int64, error) {
+	lranges := make([]util.Range, len(ranges))
+	for i, r := range ranges {
+		lranges[i] = util.Range{Start: r.Start, Limit: r.Limit}
+	}
+	return s.lDb.SizeOf(lranges)
+}
+
+// Report returns the compactions of each level
+func (s *Store) Report() (string, error) {
+	return s.lDb.GetProperty("leveldb.stats")
+}
+
+// snapshot is a leveldb snapshot
+type snapshot struct {
+	reader
+	snap *leveldb.Snapshot
+}
+
+func (s *snapshot) Release() {
+	s.snap.Release()
+}
+
+func (r reader) Get(key []byte) ([]byte, error) {
+	value, err := r.r.Get(key, nil)
+	if err == leveldb.ErrNotFound {
+		return nil, kv.ErrNotFound
+	}
+	return value, err
+}
+
+func (r reader) Has(key []byte) (bool, error) {
+	return r.r.Has(key, nil)
+}
+
+func (r reader) NewIterator(rng *kv.Range) kv.Iterator {
+	if rng == nil {
+		return r.r.NewIterator(nil, nil)
+	}
+	return r.r.NewIterator(&util.Range{Start: rng.Start, Limit: rng.Limit}, nil)
+}
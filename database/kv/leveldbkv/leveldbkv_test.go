@@ -0,0 +1,14 @@
+package leveldbkv
+
+import (
+	"testing"
+
+	"github.com/FactomProject/FactomCode/database/kv"
+	"github.com/FactomProject/FactomCode/database/kv/kvtest"
+)
+
+func TestStore(t *testing.T) {
+	kvtest.Run(t, func(dir string) (kv.Store, error) {
+		return Open(dir, nil)
+	})
+}
@@ -0,0 +1,167 @@
+package ldb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database/kv"
+)
+
+// ProcessABlockBatch inserts the Admin Block
+func (db *LevelDb) ProcessABlockBatch(block *common.AdminBlock) error {
+	if block == nil {
+		return nil
+	}
+
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	batch := new(kv.Batch)
+
+	binaryBlock, err := block.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	if block.ABHash == nil {
+		block.ABHash = common.Sha(binaryBlock)
+	}
+
+	// Insert the binary admin block
+	var key []byte = []byte{byte(TBL_AB)}
+	key = append(key, block.ABHash.Bytes...)
+	batch.Put(key, binaryBlock)
+
+	// Insert the directory block height cross reference
+	var numKey []byte = []byte{byte(TBL_AB_NUM)}
+	numKey = append(numKey, heightToKey(uint64(block.DBHeight))...)
+	batch.Put(numKey, block.ABHash.Bytes)
+
+	// Record the fee schedule set by the block
+	fees, setsFees := block.FeeSchedule()
+	if setsFees {
+		if fees.CreditsPerKB == 0 {
+			return fmt.Errorf("Admin Block at height %d sets a price of 0 credits per KB", block.DBHeight)
+		}
+		batch.Put(feesKey(block.DBHeight), feesToBytes(fees))
+	}
+
+	err = db.store.Write(batch)
+	if err != nil {
+		log.Printf("batch failed %v\n", err)
+		return err
+	}
+
+	if setsFees {
+		return db.applyFeeSchedule()
+	}
+	return nil
+}
+
+// applyFeeSchedule puts in use the fee schedule set by the newest Admin Block
+// that sets one. The fee schedule is left as it is if none has.
+func (db *LevelDb) applyFeeSchedule() error {
+	var fromkey []byte = []byte{byte(TBL_AB_FEES)}   // Table Name (1 bytes)
+	var tokey []byte = []byte{byte(TBL_AB_FEES + 1)} // Table Name (1 bytes)
+
+	iter := db.store.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
+	defer iter.Release()
+
+	if !iter.Last() {
+		return iter.Error()
+	}
+	value := iter.Value()
+	if len(value) != 8 {
+		return fmt.Errorf("Bad fee schedule at height %d", binary.BigEndian.Uint64(iter.Key()[1:]))
+	}
+	return common.SetFeeSchedule(common.FeeSchedule{
+		CreditsPerKB:    binary.BigEndian.Uint32(value[0:4]),
+		CreditsPerChain: binary.BigEndian.Uint32(value[4:8]),
+	})
+}
+
+// feeScheduleAt returns the fee schedule in force at a Directory Block height:
+// the one set by the newest Admin Block at or below it, or the configured one
+// if none has.
+func (db *LevelDb) feeScheduleAt(r reader, height uint32) (common.FeeSchedule, error) {
+	var fromkey []byte = []byte{byte(TBL_AB_FEES)} // Table Name (1 bytes)
+	tokey := feesKey(height + 1)
+	if height == ^uint32(0) {
+		tokey = []byte{byte(TBL_AB_FEES + 1)}
+	}
+
+	iter := r.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
+	defer iter.Release()
+
+	if !iter.Last() {
+		return db.configuredFees, iter.Error()
+	}
+	value := iter.Value()
+	if len(value) != 8 {
+		return common.FeeSchedule{}, fmt.Errorf("Bad fee schedule at height %d", binary.BigEndian.Uint64(iter.Key()[1:]))
+	}
+	return common.FeeSchedule{
+		CreditsPerKB:    binary.BigEndian.Uint32(value[0:4]),
+		CreditsPerChain: binary.BigEndian.Uint32(value[4:8]),
+	}, nil
+}
+
+func feesKey(height uint32) []byte {
+	var key []byte = []byte{byte(TBL_AB_FEES)}
+	return append(key, heightToKey(uint64(height))...)
+}
+
+func feesToBytes(f common.FeeSchedule) []byte {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data[0:4], f.CreditsPerKB)
+	binary.BigEndian.PutUint32(data[4:8], f.CreditsPerChain)
+	return data
+}
+
+// FetchABlockByHash gets an Admin Block by hash from the database.
+func (db *LevelDb) FetchABlockByHash(aBlockHash *common.Hash) (aBlock *common.AdminBlock, err error) {
+	return db.fetchABlock(db.store, aBlockHash.Bytes)
+}
+
+// FetchABlockByHeight gets an Admin Block by Directory Block height from the
+// database.
+func (db *LevelDb) FetchABlockByHeight(dBlockHeight uint64) (aBlock *common.AdminBlock, err error) {
+	snap, err := db.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	var key []byte = []byte{byte(TBL_AB_NUM)}
+	key = append(key, heightToKey(dBlockHeight)...)
+	aBlockHash, err := snap.Get(key)
+	if err == kv.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return db.fetchABlock(snap, aBlockHash)
+}
+
+// fetchABlock reads an admin block from r
+func (db *LevelDb) fetchABlock(r reader, aBlockHash []byte) (*common.AdminBlock, error) {
+	var key []byte = []byte{byte(TBL_AB)}
+	key = append(key, aBlockHash...)
+	data, err := r.Get(key)
+	if err == kv.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	aBlock := new(common.AdminBlock)
+	if err := aBlock.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	aBlock.ABHash = new(common.Hash)
+	aBlock.ABHash.UnmarshalBinary(aBlockHash)
+	return aBlock, nil
+}
@@ -0,0 +1,254 @@
+package ldb
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/kv"
+)
+
+// A backup is
+//
+//	backupMagic, backupFormat uint32, the db version int32
+//	for each key: uvarint key length, key, uvarint value length, value
+//	uvarint 0
+//	the number of keys uint64, the sha256 of the keys and values
+//
+// with the numbers big endian. The sha256 is of the rows as they are written.
+var backupMagic = []byte("FACTOMDB")
+
+const backupFormat uint32 = 1
+
+// ErrBadBackup is returned when a backup cannot be read, or does not match its
+// hash
+var ErrBadBackup = errors.New("Backup is incomplete or corrupt")
+
+// Backup writes every key and value of a snapshot of the database to w. Reads
+// and writes go on while it runs, and are not in the backup.
+func (db *LevelDb) Backup(w io.Writer) (*database.BackupInfo, error) {
+	snap, err := db.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	bw := bufio.NewWriter(w)
+	bw.Write(backupMagic)
+	binary.Write(bw, binary.BigEndian, backupFormat)
+	binary.Write(bw, binary.BigEndian, db.version)
+
+	h := sha256.New()
+	out := io.MultiWriter(bw, h)
+	var keys int64
+
+	iter := snap.NewIterator(nil)
+	for iter.Next() {
+		if err := writeRow(out, iter.Key(), iter.Value()); err != nil {
+			iter.Release()
+			return nil, err
+		}
+		keys++
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	info := &database.BackupInfo{Keys: keys, Hash: &common.Hash{Bytes: h.Sum(nil)}}
+	writeUvarint(bw, 0)
+	binary.Write(bw, binary.BigEndian, uint64(keys))
+	bw.Write(info.Hash.Bytes)
+	return info, bw.Flush()
+}
+
+// RestoreLevelDB makes a new database at dbpath from a backup, and checks that
+// it holds the keys and values backed up. Nothing is left at dbpath if it
+// fails.
+func RestoreLevelDB(r io.Reader, dbpath string, options *Options) (info *database.BackupInfo, err error) {
+	if _, err := os.Stat(dbpath); err == nil {
+		return nil, fmt.Errorf("%s exists already", dbpath)
+	}
+
+	br := bufio.NewReader(r)
+	var version int32
+	if version, err = readBackupHeader(br); err != nil {
+		return nil, err
+	}
+
+	// The version file is written first, so the database is opened as the
+	// version backed up. It is upgraded once the rows are restored.
+	if err = os.MkdirAll(dbpath, 0750); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(dbpath)
+			os.Remove(dbpath + ".ver")
+		}
+	}()
+	if err = writeVersionFile(dbpath+".ver", version); err != nil {
+		return nil, err
+	}
+
+	db, err := openLevelDb(dbpath, false, options)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	if info, err = db.restore(br); err != nil {
+		return nil, err
+	}
+
+	// Read the restored database back
+	stored, err := db.hashRows()
+	if err != nil {
+		return nil, err
+	}
+	if stored.Keys != info.Keys || !stored.Hash.IsSameAs(info.Hash) {
+		return nil, fmt.Errorf("Restored database has %d keys with hash %s, backup has %d with hash %s",
+			stored.Keys, stored.Hash, info.Keys, info.Hash)
+	}
+
+	if err = db.ready(dbpath + ".ver"); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// restore writes the rows of a backup after its header
+func (db *LevelDb) restore(br *bufio.Reader) (*database.BackupInfo, error) {
+	h := sha256.New()
+	batch := new(kv.Batch)
+	var keys int64
+
+	for {
+		key, err := readBytes(br)
+		if err != nil {
+			return nil, err
+		}
+		if len(key) == 0 {
+			break
+		}
+		value, err := readBytes(br)
+		if err != nil {
+			return nil, err
+		}
+
+		writeRow(h, key, value)
+		batch.Put(key, value)
+		keys++
+
+		if batch.Len() >= dbMaxTransCnt || batch.Size() >= dbMaxTransMem {
+			if err := db.store.Write(batch); err != nil {
+				return nil, err
+			}
+			batch.Reset()
+		}
+	}
+	if err := db.store.Write(batch); err != nil {
+		return nil, err
+	}
+
+	var count uint64
+	sum := make([]byte, sha256.Size)
+	if err := binary.Read(br, binary.BigEndian, &count); err != nil {
+		return nil, ErrBadBackup
+	}
+	if _, err := io.ReadFull(br, sum); err != nil {
+		return nil, ErrBadBackup
+	}
+	if count != uint64(keys) || !bytes.Equal(sum, h.Sum(nil)) {
+		return nil, ErrBadBackup
+	}
+
+	return &database.BackupInfo{Keys: keys, Hash: &common.Hash{Bytes: sum}}, nil
+}
+
+// hashRows counts and hashes the rows of the database as a backup does
+func (db *LevelDb) hashRows() (*database.BackupInfo, error) {
+	h := sha256.New()
+	var keys int64
+
+	iter := db.store.NewIterator(nil)
+	defer iter.Release()
+	for iter.Next() {
+		writeRow(h, iter.Key(), iter.Value())
+		keys++
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+	return &database.BackupInfo{Keys: keys, Hash: &common.Hash{Bytes: h.Sum(nil)}}, nil
+}
+
+func readBackupHeader(br *bufio.Reader) (version int32, err error) {
+	magic := make([]byte, len(backupMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, backupMagic) {
+		return 0, ErrBadBackup
+	}
+
+	var format uint32
+	if err := binary.Read(br, binary.BigEndian, &format); err != nil {
+		return 0, ErrBadBackup
+	}
+	if format != backupFormat {
+		return 0, fmt.Errorf("unsupported backup format %v", format)
+	}
+
+	if err := binary.Read(br, binary.BigEndian, &version); err != nil {
+		return 0, ErrBadBackup
+	}
+	return version, nil
+}
+
+func writeVersionFile(verfile string, version int32) error {
+	fo, err := os.Create(verfile)
+	if err != nil {
+		return err
+	}
+	defer fo.Close()
+	return binary.Write(fo, binary.BigEndian, version)
+}
+
+// writeRow writes a key and its value, each after its length
+func writeRow(w io.Writer, key []byte, value []byte) error {
+	if err := writeUvarint(w, uint64(len(key))); err != nil {
+		return err
+	}
+	if _, err := w.Write(key); err != nil {
+		return err
+	}
+	if err := writeUvarint(w, uint64(len(value))); err != nil {
+		return err
+	}
+	_, err := w.Write(value)
+	return err
+}
+
+func writeUvarint(w io.Writer, x uint64) error {
+	buf := make([]byte, binary.MaxVarintLen64)
+	_, err := w.Write(buf[:binary.PutUvarint(buf, x)])
+	return err
+}
+
+// readBytes reads a key or value after its length
+func readBytes(br *bufio.Reader) ([]byte, error) {
+	n, err := binary.ReadUvarint(br)
+	if err != nil || n > dbMaxTransMem {
+		return nil, ErrBadBackup
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(br, b); err != nil {
+		return nil, ErrBadBackup
+	}
+	return b, nil
+}
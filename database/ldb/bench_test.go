@@ -0,0 +1,339 @@
+package ldb
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/dbgen"
+)
+
+var (
+	benchBlocks  = flag.Int("benchblocks", 100, "Directory Blocks in the database of the benchmarks")
+	benchBackend = flag.String("benchbackend", BackendLevelDB, "backend of the database of the benchmarks")
+)
+
+// benchDB is a database made by dbgen, with the hashes of what is in it. It is
+// made by the first benchmark that needs it, and removed after them all.
+type benchDB struct {
+	db  database.Db
+	dir string
+
+	dBlocks []*common.Hash
+	aBlocks []*common.Hash
+	cBlocks []*common.Hash
+	eBlocks []*common.Hash
+	eMRs    []*common.Hash
+	entries []*common.Hash
+	chains  []*common.EChain
+	pubKeys []*common.Hash
+}
+
+var bench *benchDB
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	code := m.Run()
+	if bench != nil {
+		bench.db.Close()
+		os.RemoveAll(bench.dir)
+	}
+	os.Exit(code)
+}
+
+// openBenchDB opens a new database in a temporary directory with the backend
+// of the benchmarks
+func openBenchDB(b *testing.B) (database.Db, string) {
+	dir, err := ioutil.TempDir("", "ldbbench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	bdb, err := OpenLevelDBWithOptions(dir, true, &Options{Backend: *benchBackend})
+	if err != nil {
+		os.RemoveAll(dir)
+		b.Fatal(err)
+	}
+	return bdb, dir
+}
+
+// getBenchDB returns the database of the benchmarks, making it the first time
+func getBenchDB(b *testing.B) *benchDB {
+	if bench != nil {
+		return bench
+	}
+
+	bdb, dir := openBenchDB(b)
+	d := &benchDB{db: bdb, dir: dir}
+	g, err := dbgen.New(dbgen.DefaultConfig)
+	if err != nil {
+		b.Fatal(err)
+	}
+	chains := make(map[string]bool)
+	for h := 0; h < *benchBlocks; h++ {
+		block, err := g.Next()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if err := dbgen.Write(bdb, block); err != nil {
+			b.Fatal(err)
+		}
+
+		d.dBlocks = append(d.dBlocks, block.DBlock.DBHash)
+		d.aBlocks = append(d.aBlocks, block.ABlock.ABHash)
+		d.cBlocks = append(d.cBlocks, block.CBlock.CBHash)
+		for i, eBlock := range block.EBlocks {
+			d.eBlocks = append(d.eBlocks, eBlock.EBHash)
+			d.eMRs = append(d.eMRs, eBlock.MerkleRoot)
+			for _, ebEntry := range eBlock.EBEntries {
+				if !common.IsEndOfMinuteMarker(ebEntry.EntryHash) {
+					d.entries = append(d.entries, ebEntry.EntryHash)
+				}
+			}
+			if first := block.Entries[i][0]; !chains[first.ChainID.String()] {
+				chains[first.ChainID.String()] = true
+				d.chains = append(d.chains, &common.EChain{ChainID: first.ChainID, Name: first.ExtIDs})
+			}
+		}
+		for _, e := range block.CBlock.CBEntries {
+			if e.Type() == common.TYPE_BUY {
+				d.pubKeys = append(d.pubKeys, e.PublicKey())
+			}
+		}
+	}
+
+	bench = d
+	b.ResetTimer()
+	return d
+}
+
+// BenchmarkWrite writes Directory Blocks of the default config and the blocks
+// and entries they refer to. Each of the Db operations is timed by itself, and
+// the others are written untimed.
+func BenchmarkWrite(b *testing.B) {
+	for _, op := range []string{"Block", "InsertEntry", "ProcessEBlockBatch",
+		"ProcessCBlockBatch", "ProcessABlockBatch", "ProcessDBlockBatch"} {
+		b.Run(op, func(b *testing.B) {
+			bdb, dir := openBenchDB(b)
+			defer os.RemoveAll(dir)
+			defer bdb.Close()
+			g, err := dbgen.New(dbgen.DefaultConfig)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			timed := func(name string, f func() error) {
+				if op != "Block" && op != name {
+					if err := f(); err != nil {
+						b.Fatal(err)
+					}
+					return
+				}
+				b.StartTimer()
+				err := f()
+				b.StopTimer()
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+
+			b.StopTimer()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				block, err := g.Next()
+				if err != nil {
+					b.Fatal(err)
+				}
+
+				timed("ProcessABlockBatch", func() error { return bdb.ProcessABlockBatch(block.ABlock) })
+				timed("ProcessCBlockBatch", func() error { return bdb.ProcessCBlockBatch(block.CBlock) })
+				for j, eBlock := range block.EBlocks {
+					for _, entry := range block.Entries[j] {
+						data, _ := entry.MarshalBinary()
+						hash := common.Sha(data)
+						timed("InsertEntry", func() error {
+							return bdb.InsertEntry(hash, &data, entry, &entry.ChainID.Bytes)
+						})
+					}
+					timed("ProcessEBlockBatch", func() error { return bdb.ProcessEBlockBatch(eBlock) })
+				}
+				timed("ProcessDBlockBatch", func() error { return bdb.ProcessDBlockBatch(block.DBlock) })
+			}
+		})
+	}
+}
+
+// BenchmarkRead runs each of the Db reads against the database of the
+// benchmarks, going round the blocks and entries in it
+func BenchmarkRead(b *testing.B) {
+	for _, op := range []struct {
+		name string
+		f    func(d *benchDB, i int) error
+	}{
+		{"FetchDBlockByHash", func(d *benchDB, i int) error {
+			_, err := d.db.FetchDBlockByHash(d.dBlocks[i%len(d.dBlocks)])
+			return err
+		}},
+		{"FetchDBlockByHeight", func(d *benchDB, i int) error {
+			_, err := d.db.FetchDBlockByHeight(uint64(i % len(d.dBlocks)))
+			return err
+		}},
+		{"FetchDBlockHead", func(d *benchDB, i int) error {
+			_, err := d.db.FetchDBlockHead()
+			return err
+		}},
+		{"FetchABlockByHash", func(d *benchDB, i int) error {
+			_, err := d.db.FetchABlockByHash(d.aBlocks[i%len(d.aBlocks)])
+			return err
+		}},
+		{"FetchABlockByHeight", func(d *benchDB, i int) error {
+			_, err := d.db.FetchABlockByHeight(uint64(i % len(d.aBlocks)))
+			return err
+		}},
+		{"FetchCBlockByHash", func(d *benchDB, i int) error {
+			_, err := d.db.FetchCBlockByHash(d.cBlocks[i%len(d.cBlocks)])
+			return err
+		}},
+		{"FetchCBlockByHeight", func(d *benchDB, i int) error {
+			_, err := d.db.FetchCBlockByHeight(uint64(i % len(d.cBlocks)))
+			return err
+		}},
+		{"FetchEBlockByHash", func(d *benchDB, i int) error {
+			_, err := d.db.FetchEBlockByHash(d.eBlocks[i%len(d.eBlocks)])
+			return err
+		}},
+		{"FetchEBlockByMR", func(d *benchDB, i int) error {
+			_, err := d.db.FetchEBlockByMR(d.eMRs[i%len(d.eMRs)])
+			return err
+		}},
+		{"FetchEBHashByMR", func(d *benchDB, i int) error {
+			_, err := d.db.FetchEBHashByMR(d.eMRs[i%len(d.eMRs)])
+			return err
+		}},
+		{"FetchEBlockByHeight", func(d *benchDB, i int) error {
+			_, err := d.db.FetchEBlockByHeight(d.chains[i%len(d.chains)].ChainID, 0)
+			return err
+		}},
+		{"FetchEBlockHead", func(d *benchDB, i int) error {
+			_, err := d.db.FetchEBlockHead(d.chains[i%len(d.chains)].ChainID)
+			return err
+		}},
+		{"FetchAllEBlocksByChain", func(d *benchDB, i int) error {
+			_, err := d.db.FetchAllEBlocksByChain(d.chains[i%len(d.chains)].ChainID)
+			return err
+		}},
+		{"FetchEntryByHash", func(d *benchDB, i int) error {
+			_, err := d.db.FetchEntryByHash(d.entries[i%len(d.entries)])
+			return err
+		}},
+		{"FetchChainByHash", func(d *benchDB, i int) error {
+			_, err := d.db.FetchChainByHash(d.chains[i%len(d.chains)].ChainID)
+			return err
+		}},
+		{"FetchChainByName", func(d *benchDB, i int) error {
+			_, err := d.db.FetchChainByName(d.chains[i%len(d.chains)].Name)
+			return err
+		}},
+		{"FetchAllChains", func(d *benchDB, i int) error {
+			_, err := d.db.FetchAllChains()
+			return err
+		}},
+		{"FetchCBEntriesByPubKey", func(d *benchDB, i int) error {
+			_, err := d.db.FetchCBEntriesByPubKey(d.pubKeys[i%len(d.pubKeys)])
+			return err
+		}},
+		{"FetchECBalance", func(d *benchDB, i int) error {
+			_, err := d.db.FetchECBalance(d.pubKeys[i%len(d.pubKeys)])
+			return err
+		}},
+		{"FetchECBalanceProof", func(d *benchDB, i int) error {
+			_, err := d.db.FetchECBalanceProof(d.pubKeys[i%len(d.pubKeys)])
+			return err
+		}},
+		{"FetchAllDBlocks", func(d *benchDB, i int) error {
+			_, err := d.db.FetchAllDBlocks()
+			return err
+		}},
+		{"FetchAllCBlocks", func(d *benchDB, i int) error {
+			_, err := d.db.FetchAllCBlocks()
+			return err
+		}},
+		{"Snapshot", func(d *benchDB, i int) error {
+			view, err := d.db.Snapshot()
+			if err == nil {
+				view.Release()
+			}
+			return err
+		}},
+	} {
+		b.Run(op.name, func(b *testing.B) {
+			d := getBenchDB(b)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := op.f(d, i); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCommits inserts commits and prunes them
+func BenchmarkCommits(b *testing.B) {
+	d := getBenchDB(b)
+	for i := 0; i < b.N; i++ {
+		hash := common.Sha([]byte{byte(i), byte(i >> 8), byte(i >> 16), byte(i >> 24)})
+		if _, err := d.db.InsertCommit(hash, uint64(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	if _, err := d.db.PruneCommits(uint64(b.N)); err != nil {
+		b.Fatal(err)
+	}
+}
+
+// BenchmarkWholeDB runs the Db operations that go over all of the database
+func BenchmarkWholeDB(b *testing.B) {
+	b.Run("StorageStats", func(b *testing.B) {
+		d := getBenchDB(b)
+		for i := 0; i < b.N; i++ {
+			if _, err := d.db.StorageStats(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Backup", func(b *testing.B) {
+		d := getBenchDB(b)
+		for i := 0; i < b.N; i++ {
+			if _, err := d.db.Backup(ioutil.Discard); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("InitializeExternalIDMap", func(b *testing.B) {
+		d := getBenchDB(b)
+		for i := 0; i < b.N; i++ {
+			if _, err := d.db.InitializeExternalIDMap(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("RebuildIndexes", func(b *testing.B) {
+		d := getBenchDB(b)
+		for i := 0; i < b.N; i++ {
+			if err := d.db.RebuildIndexes(nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Compact", func(b *testing.B) {
+		d := getBenchDB(b)
+		for i := 0; i < b.N; i++ {
+			if err := d.db.Compact(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
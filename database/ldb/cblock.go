@@ -1,10 +1,12 @@
 package ldb
 
 import (
+	"encoding/binary"
 //	"errors"
+	"fmt"
 	"github.com/FactomProject/FactomCode/common"
-	"github.com/FactomProject/goleveldb/leveldb"
-	"github.com/FactomProject/goleveldb/leveldb/util"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/kv"
 	"log"
 )
 
@@ -12,11 +14,15 @@ import (
 func (db *LevelDb) ProcessCBlockBatch(block *common.CBlock) error {
 
 	if block != nil {
-		if db.lbatch == nil {
-			db.lbatch = new(leveldb.Batch)
-		}
+		db.dbLock.Lock()
+		defer db.dbLock.Unlock()
+
+		// The balance proofs are not read until the new balances are
+		// written
+		db.balanceLock.Lock()
+		defer db.balanceLock.Unlock()
 
-		defer db.lbatch.Reset()
+		batch := new(kv.Batch)
 
 		binaryBlock, err := block.MarshalBinary()
 		if err != nil {
@@ -30,45 +36,372 @@ func (db *LevelDb) ProcessCBlockBatch(block *common.CBlock) error {
 		// Insert the binary factom block
 		var key []byte = []byte{byte(TBL_CB)}
 		key = append(key, block.CBHash.Bytes...)
-		db.lbatch.Put(key, binaryBlock)
+		batch.Put(key, binaryBlock)
+
+		err = block.VerifySegmentsMR()
+		if err != nil {
+			return err
+		}
+
+		// Update the balance tree with the public keys in the block, if it
+		// is newer than the blocks applied already. An older block, such as
+		// one put back by a repair, is checked against the BalanceMR kept
+		// for its height instead.
+		applied, ok, err := db.lastBalanceHeight(db.store)
+		if err != nil {
+			return err
+		}
+		var balances *common.ECBalanceTree
+		old := ok && uint64(block.Header.DBHeight) <= applied
+		if old {
+			err = db.verifyCBlock(db.store, block)
+			if err != nil {
+				return err
+			}
+		} else {
+			tree, err := db.balanceTree()
+			if err != nil {
+				return err
+			}
+			changed, err := block.Balances(tree.Balance)
+			if err != nil {
+				return err
+			}
+			balances = tree.Copy()
+			balances.Update(changed)
+
+			balanceMR := balances.Root()
+			err = block.VerifyBalanceMR(balanceMR)
+			if err != nil {
+				return err
+			}
+
+			for _, b := range changed {
+				var balanceKey []byte = []byte{byte(TBL_EC_BALANCE)}
+				balanceKey = append(balanceKey, b.PublicKey.Bytes...)
+				balance := make([]byte, 4)
+				binary.BigEndian.PutUint32(balance, uint32(int32(b.Credits)))
+				batch.Put(balanceKey, balance)
+			}
+
+			var mrKey []byte = []byte{byte(TBL_EC_BALANCE_MR)}
+			mrKey = append(mrKey, heightToKey(uint64(block.Header.DBHeight))...)
+			batch.Put(mrKey, balanceMR.Bytes)
+		}
+
+		// Insert block height cross reference
+		var numKey []byte = []byte{byte(TBL_CB_NUM)}
+		numKey = append(numKey, heightToKey(uint64(block.Header.DBHeight))...)
+		batch.Put(numKey, block.CBHash.Bytes)
+
+		// Index the transactions by public key
+		minutes := block.Minutes()
+		for i, entry := range block.CBEntries {
+			pubKey := entry.PublicKey()
+			if pubKey == nil {
+				continue
+			}
+
+			info := &common.CBEntryInfo{
+				CBHash:   block.CBHash,
+				DBHeight: uint32(block.Header.DBHeight),
+				Minute:   minutes[i],
+				Entry:    entry,
+			}
+			binaryInfo, err := info.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			batch.Put(pubKeyEntryToKey(pubKey, block.Header.DBHeight, i), binaryInfo)
 
-		err = db.lDb.Write(db.lbatch, db.wo)
+			// Index the payments by the entry they pay for. The
+			// payments are checked against the entries stored
+			// already, the others when the entries come in.
+			if entryHash := common.PaymentEntryHash(entry); entryHash != nil {
+				if err := db.checkPayment(info, entryHash); err != nil {
+					return err
+				}
+				batch.Put(paymentKey(entryHash), binaryInfo)
+			}
+		}
+
+		err = db.store.Write(batch)
 		if err != nil {
 			log.Println("batch failed %v\n", err)
 			return err
 		}
+		if balances != nil {
+			db.ecBalances = balances
+		}
+
+		db.events.Publish(&database.Event{
+			Type:    database.EventCBlock,
+			Hash:    block.CBHash,
+			KeyMR:   block.MerkleRoot,
+			ChainID: block.Header.ChainID,
+			Height:  uint32(block.Header.DBHeight),
+		})
+	}
+	return nil
+}
+
+// checkPayment makes sure a payment pays enough for its entry in the fee
+// schedule of its height, if the entry is stored
+func (db *LevelDb) checkPayment(payment *common.CBEntryInfo, entryHash *common.Hash) error {
+	var key []byte = []byte{byte(TBL_ENTRY)}
+	key = append(key, entryHash.Bytes...)
+	data, err := db.store.Get(key)
+	if err == kv.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
 
+	fees, err := db.feeScheduleAt(db.store, payment.DBHeight)
+	if err != nil {
+		return err
+	}
+	if err := fees.CheckPayment(payment.Entry, len(data)); err != nil {
+		return fmt.Errorf("Entry %s: %v", entryHash.String(), err)
 	}
 	return nil
 }
 
+// fetchPayment reads the payment for an entry, nil if there is none
+func (db *LevelDb) fetchPayment(r reader, entryHash *common.Hash) (*common.CBEntryInfo, error) {
+	data, err := r.Get(paymentKey(entryHash))
+	if err == kv.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	info := new(common.CBEntryInfo)
+	if err := info.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func paymentKey(entryHash *common.Hash) []byte {
+	var key []byte = []byte{byte(TBL_CB_PAYMENT)}
+	return append(key, entryHash.Bytes...)
+}
+
 // FetchCBlockByHash gets an Entry Credit block by hash from the database.
 func (db *LevelDb) FetchCBlockByHash(cBlockHash *common.Hash) (cBlock *common.CBlock, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
+	snap, err := db.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	return db.fetchCBlockByHash(snap, cBlockHash)
+}
 
+// fetchCBlockByHash reads an entry credit block by hash from r
+func (db *LevelDb) fetchCBlockByHash(r reader, cBlockHash *common.Hash) (cBlock *common.CBlock, err error) {
 	var key []byte = []byte{byte(TBL_CB)}
 	key = append(key, cBlockHash.Bytes...)
-	data, err := db.lDb.Get(key, db.ro)
+	data, err := r.Get(key)
+
+	if data != nil {
+		cBlock = new(common.CBlock)
+		cBlock.UnmarshalBinary(data)
+		cBlock.CBHash = cBlockHash
+
+		err = db.verifyCBlock(r, cBlock)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cBlock, nil
+}
+
+// FetchCBlockByHeight gets an Entry Credit block by height from the database.
+func (db *LevelDb) FetchCBlockByHeight(cBlockHeight uint64) (cBlock *common.CBlock, err error) {
+	snap, err := db.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	return db.fetchCBlockByHeight(snap, cBlockHeight)
+}
+
+// fetchCBlockByHeight reads an entry credit block by height from r
+func (db *LevelDb) fetchCBlockByHeight(r reader, cBlockHeight uint64) (cBlock *common.CBlock, err error) {
+	var key []byte = []byte{byte(TBL_CB_NUM)}
+	key = append(key, heightToKey(cBlockHeight)...)
+	cBlockHash, err := r.Get(key)
+
+	if cBlockHash == nil {
+		return nil, nil
+	}
+
+	key = []byte{byte(TBL_CB)}
+	key = append(key, cBlockHash...)
+	data, err := r.Get(key)
 
 	if data != nil {
 		cBlock = new(common.CBlock)
 		cBlock.UnmarshalBinary(data)
+		cBlock.CBHash = new(common.Hash)
+		cBlock.CBHash.UnmarshalBinary(cBlockHash)
+
+		err = db.verifyCBlock(r, cBlock)
+		if err != nil {
+			return nil, err
+		}
 	}
 	return cBlock, nil
 }
 
+// FetchECBalance gets the entry credit balance of a public key after the
+// latest entry credit block.
+func (db *LevelDb) FetchECBalance(pubKey *common.Hash) (credits int, err error) {
+	var key []byte = []byte{byte(TBL_EC_BALANCE)}
+	key = append(key, pubKey.Bytes...)
+	data, err := db.store.Get(key)
+	if err == kv.ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	return int(int32(binary.BigEndian.Uint32(data))), nil
+}
+
+// FetchECBalanceProof gets the balance of a public key with a proof that it
+// is in the balance tree committed to by the latest entry credit block. It
+// returns nil if the key has no balance.
+func (db *LevelDb) FetchECBalanceProof(pubKey *common.Hash) (proof *common.ECBalanceProof, err error) {
+	db.balanceLock.Lock()
+	defer db.balanceLock.Unlock()
+
+	tree, err := db.balanceTree()
+	if err != nil {
+		return nil, err
+	}
+	proof = tree.Proof(pubKey)
+	if proof == nil {
+		return nil, nil
+	}
+
+	height, _, err := db.lastBalanceHeight(db.store)
+	if err != nil {
+		return nil, err
+	}
+	proof.DBHeight = uint32(height)
+
+	return proof, nil
+}
+
+// lastBalanceHeight returns the height of the newest entry credit block whose
+// balances have been applied, and false if there is none
+func (db *LevelDb) lastBalanceHeight(r reader) (height uint64, ok bool, err error) {
+	var fromkey []byte = []byte{byte(TBL_EC_BALANCE_MR)}   // Table Name (1 bytes)
+	var tokey []byte = []byte{byte(TBL_EC_BALANCE_MR + 1)} // Table Name (1 bytes)
+
+	iter := r.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
+	if iter.Last() {
+		height, ok = binary.BigEndian.Uint64(iter.Key()[1:]), true
+	}
+	iter.Release()
+
+	return height, ok, iter.Error()
+}
+
+// balanceTree returns the balance tree after the latest entry credit block,
+// reading it from the database the first time. The balanceLock must be held.
+func (db *LevelDb) balanceTree() (*common.ECBalanceTree, error) {
+	if db.ecBalances != nil {
+		return db.ecBalances, nil
+	}
+
+	var fromkey []byte = []byte{byte(TBL_EC_BALANCE)}   // Table Name (1 bytes)
+	var tokey []byte = []byte{byte(TBL_EC_BALANCE + 1)} // Table Name (1 bytes)
+
+	balances := make([]common.ECBalance, 0, 100)
+
+	iter := db.store.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
+	for iter.Next() {
+		pubKey := new(common.Hash)
+		pubKey.UnmarshalBinary(iter.Key()[1:])
+		credits := int(int32(binary.BigEndian.Uint32(iter.Value())))
+		balances = append(balances, common.ECBalance{PublicKey: pubKey, Credits: credits})
+	}
+	iter.Release()
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	db.ecBalances = common.NewECBalanceTree(balances)
+	return db.ecBalances, nil
+}
+
+// verifyCBlock checks the SegmentsMR of a block, and its BalanceMR against the
+// root of the balance tree computed when the block was processed
+func (db *LevelDb) verifyCBlock(r reader, block *common.CBlock) error {
+	err := block.VerifySegmentsMR()
+	if err != nil {
+		return err
+	}
+
+	var key []byte = []byte{byte(TBL_EC_BALANCE_MR)}
+	key = append(key, heightToKey(uint64(block.Header.DBHeight))...)
+	data, err := r.Get(key)
+	if err == kv.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	balanceMR := new(common.Hash)
+	balanceMR.UnmarshalBinary(data)
+	return block.VerifyBalanceMR(balanceMR)
+}
+
+// FetchCBEntriesByPubKey gets all of the entry credit transactions of a public
+// key, oldest first.
+func (db *LevelDb) FetchCBEntriesByPubKey(pubKey *common.Hash) (cbEntries []*common.CBEntryInfo, err error) {
+	var fromkey []byte = []byte{byte(TBL_CB_PUBKEY)} // Table Name (1 bytes)
+	fromkey = append(fromkey, pubKey.Bytes...)       // Public Key (32 bytes)
+	var tokey []byte = addOneToByteArray(fromkey)
+
+	iter := db.store.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
+	defer iter.Release()
+
+	cbEntries = make([]*common.CBEntryInfo, 0, 10)
+	for iter.Next() {
+		info := new(common.CBEntryInfo)
+		if err := info.UnmarshalBinary(iter.Value()); err != nil {
+			return nil, err
+		}
+		cbEntries = append(cbEntries, info)
+	}
+
+	return cbEntries, iter.Error()
+}
+
+// pubKeyEntryToKey makes the key of a transaction in the public key index.
+// Keys sort by public key, then block height and position in the block.
+func pubKeyEntryToKey(pubKey *common.Hash, height int, index int) []byte {
+	var key []byte = []byte{byte(TBL_CB_PUBKEY)}
+	key = append(key, pubKey.Bytes...)
+	key = append(key, heightToKey(uint64(height))...)
+	key = append(key, heightToKey(uint64(index))...)
+	return key
+}
+
 // FetchAllCBlocks gets all of the entry credit blocks
 func (db *LevelDb) FetchAllCBlocks() (cBlocks []common.CBlock, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
-
 	var fromkey []byte = []byte{byte(TBL_CB)}   // Table Name (1 bytes)						// Timestamp  (8 bytes)
 	var tokey []byte = []byte{byte(TBL_CB + 1)} // Table Name (1 bytes)
 
 	cBlockSlice := make([]common.CBlock, 0, 10)
 
-	iter := db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
+	iter := db.store.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
 
 	for iter.Next() {
 		var cBlock common.CBlock
@@ -0,0 +1,70 @@
+package ldb
+
+import (
+	"encoding/binary"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database/kv"
+	"log"
+)
+
+// InsertCommit records a commit by the hash of its entry and its timestamp. It
+// returns false if the commit has been recorded before.
+func (db *LevelDb) InsertCommit(entryHash *common.Hash, timestamp uint64) (inserted bool, err error) {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	var key []byte = []byte{byte(TBL_COMMIT)}
+	key = append(key, entryHash.Bytes...)
+	key = append(key, heightToKey(timestamp)...)
+
+	seen, err := db.store.Has(key)
+	if err != nil {
+		return false, err
+	}
+	if seen {
+		return false, nil
+	}
+
+	err = db.store.Put(key, []byte{})
+	if err != nil {
+		log.Printf("put failed %v\n", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// PruneCommits removes the commits with a timestamp before the given one
+func (db *LevelDb) PruneCommits(before uint64) (pruned int, err error) {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	var fromkey []byte = []byte{byte(TBL_COMMIT)}   // Table Name (1 bytes)
+	var tokey []byte = []byte{byte(TBL_COMMIT + 1)} // Table Name (1 bytes)
+
+	batch := new(kv.Batch)
+
+	iter := db.store.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
+	for iter.Next() {
+		key := iter.Key()
+		timestamp := binary.BigEndian.Uint64(key[len(key)-8:])
+		if timestamp < before {
+			batch.Delete(append([]byte{}, key...))
+			pruned++
+		}
+	}
+	iter.Release()
+	err = iter.Error()
+	if err != nil {
+		return 0, err
+	}
+
+	if pruned > 0 {
+		err = db.store.Write(batch)
+		if err != nil {
+			log.Printf("batch failed %v\n", err)
+			return 0, err
+		}
+	}
+	return pruned, nil
+}
@@ -0,0 +1,17 @@
+package ldb
+
+import (
+	"github.com/FactomProject/FactomCode/util"
+)
+
+// ConfigOptions returns the options of the [app] section of factomd.conf
+func ConfigOptions(cfg *util.FactomdConfig) *Options {
+	return &Options{
+		BlockCacheSize:  cfg.App.LdbBlockCacheMB * 1024 * 1024,
+		WriteBufferSize: cfg.App.LdbWriteBufferMB * 1024 * 1024,
+		BloomFilterBits: cfg.App.LdbBloomFilterBits,
+		Compression:     cfg.App.LdbCompression,
+		MaxOpenFiles:    cfg.App.LdbMaxOpenFiles,
+		Backend:         cfg.App.DbBackend,
+	}
+}
@@ -1,9 +1,14 @@
 package ldb
 
 import (
+	"bytes"
 	"github.com/FactomProject/FactomCode/database"
 	"github.com/FactomProject/FactomCode/common"	
+	"github.com/FactomProject/FactomCode/database/dbgen"
+	"io/ioutil"
 	"log"
+	"os"
+	"sync/atomic"
 	"testing"
 )
 
@@ -19,10 +24,10 @@ func TestSimpleOperations(t *testing.T) {
 	bName = append(bName, []byte("bookkeeping3"))
 
 	chain.Name = bName
-	chain.GenerateIDFromName()
+	chain.ChainID, _ = common.GetChainID(bName)
 
 	entry := new(common.Entry)
-	entry.ChainID = *chain.ChainID
+	entry.ChainID = chain.ChainID
 	entry.ExtIDs = make([][]byte, 0, 5)
 	entry.ExtIDs = append(entry.ExtIDs, []byte("1001"))
 	entry.ExtIDs = append(entry.ExtIDs, []byte("570b9e3fb2f5ae823685eb4422d4fd83f3f0d9e7ce07d988bd17e665394668c6"))
@@ -31,7 +36,7 @@ func TestSimpleOperations(t *testing.T) {
 	
 	entryBinary, _ := entry.MarshalBinary()
 	entryHash := common.Sha(entryBinary)
-	err := db.InsertEntryAndQueue(entryHash, &entryBinary, entry, &chain.ChainID.Bytes)	
+	err := db.InsertEntry(entryHash, &entryBinary, entry, &chain.ChainID.Bytes)	
 	
 	entry1, _ := db.FetchEntryByHash(entryHash)
 	
@@ -66,3 +71,552 @@ func initDB() {
 	log.Println("Database started from: " + ldbpath)
 
 }
+
+func TestSnapshot(t *testing.T) {
+	tdb, done := openTestDB(t, 1)
+	defer done()
+
+	view, err := tdb.Snapshot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer view.Release()
+
+	head, _ := tdb.FetchDBlockHead()
+	dChain := &common.DChain{ChainID: &common.Hash{Bytes: common.D_CHAINID}, NextBlockHeight: 1}
+	dBlock, _ := common.CreateDBlock(dChain, head, 10)
+	dBlock.Header.BodyMR, _ = dBlock.BuildBodyMR()
+	if err := tdb.ProcessDBlockBatch(dBlock); err != nil {
+		t.Fatal(err)
+	}
+
+	// The view does not see the new block
+	head, err = view.FetchDBlockHead()
+	if err != nil || head.Header.BlockHeight != 0 {
+		t.Errorf("view head moved: %v", err)
+	}
+	if b, _ := view.FetchDBlockByHeight(1); b != nil {
+		t.Errorf("new block in the view")
+	}
+	head, _ = tdb.FetchDBlockHead()
+	if head.Header.BlockHeight != 1 {
+		t.Errorf("new block not written")
+	}
+}
+
+func TestStorageStats(t *testing.T) {
+	tdb, done := openTestDB(t, 3)
+	defer done()
+
+	if err := tdb.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := tdb.StorageStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := make(map[string]int)
+	for _, table := range stats.Tables {
+		keys[table.Name] = table.Keys
+		if table.Keys > 0 && table.Bytes == 0 {
+			t.Errorf("no bytes in %s", table.Name)
+		}
+	}
+	if keys["dblock"] != 3 || keys["dblock_num"] != 3 || keys["entry"] != 0 {
+		t.Errorf("wrong key counts %v", keys)
+	}
+	if stats.Engine == "" {
+		t.Errorf("no compaction stats")
+	}
+}
+
+func TestOpenWithOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ldbtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	options := &Options{BloomFilterBits: 10, Compression: "zip"}
+	if _, err := OpenLevelDBWithOptions(dir, true, options); err == nil {
+		t.Fatalf("unknown compression accepted")
+	}
+
+	options.Compression = "snappy"
+	tdb, err := OpenLevelDBWithOptions(dir, true, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tdb.Close()
+}
+
+func TestBackupRestore(t *testing.T) {
+	tdb, done := openTestDB(t, 3)
+	defer done()
+
+	buf := new(bytes.Buffer)
+	info, err := tdb.Backup(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Keys == 0 {
+		t.Fatalf("nothing backed up")
+	}
+
+	dir, err := ioutil.TempDir("", "ldbtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dbpath := dir + "/restored"
+	backup := buf.Bytes()
+
+	// A cut or changed backup is refused, and leaves nothing behind
+	for _, bad := range [][]byte{backup[:len(backup)-1], append([]byte{}, backup...)} {
+		if len(bad) == len(backup) {
+			bad[20] ^= 1
+		}
+		if _, err := RestoreLevelDB(bytes.NewReader(bad), dbpath, testOptions); err == nil {
+			t.Errorf("bad backup restored")
+		}
+		if _, err := os.Stat(dbpath); err == nil {
+			t.Errorf("bad backup left behind")
+		}
+	}
+
+	restored, err := RestoreLevelDB(bytes.NewReader(backup), dbpath, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Keys != info.Keys || !restored.Hash.IsSameAs(info.Hash) {
+		t.Errorf("restored %d keys, backed up %d", restored.Keys, info.Keys)
+	}
+
+	rdb, err := OpenLevelDBWithOptions(dbpath, false, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdb.Close()
+	head, err := rdb.FetchDBlockHead()
+	if err != nil || head.Header.BlockHeight != 2 {
+		t.Errorf("wrong head restored: %v", err)
+	}
+
+	// A database is not restored over
+	if _, err := RestoreLevelDB(bytes.NewReader(backup), dbpath, testOptions); err == nil {
+		t.Errorf("restored over a database")
+	}
+}
+
+// TestBTreeBackend runs the tests of the database on the btree store
+func TestBTreeBackend(t *testing.T) {
+	testOptions = &Options{Backend: BackendBTree}
+	defer func() { testOptions = nil }()
+
+	t.Run("Snapshot", TestSnapshot)
+	t.Run("StorageStats", TestStorageStats)
+	t.Run("BackupRestore", TestBackupRestore)
+
+	// A store is not opened as another backend
+	dir, err := ioutil.TempDir("", "ldbtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tdb, err := OpenLevelDBWithOptions(dir, true, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tdb.Close()
+	if _, err := OpenLevelDB(dir, false); err == nil {
+		t.Errorf("btree store opened as leveldb")
+	}
+}
+
+// TestReprocessCBlock puts back a lost Entry Credit Block, which is not
+// applied to the balances again
+func TestReprocessCBlock(t *testing.T) {
+	tdb, done := openTestDB(t, 0)
+	defer done()
+
+	g, err := dbgen.New(dbgen.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blocks []*dbgen.Block
+	for i := 0; i < 3; i++ {
+		block, err := g.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := dbgen.Write(tdb, block); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	balances := func() []int {
+		var credits []int
+		for _, e := range blocks[0].CBlock.CBEntries {
+			if pubKey := e.PublicKey(); pubKey != nil {
+				c, err := tdb.FetchECBalance(pubKey)
+				if err != nil {
+					t.Fatal(err)
+				}
+				credits = append(credits, c)
+			}
+		}
+		return credits
+	}
+	before := balances()
+
+	lost := blocks[1].CBlock
+	key := append([]byte{byte(TBL_CB)}, lost.CBHash.Bytes...)
+	if err := tdb.(*LevelDb).store.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := tdb.ProcessCBlockBatch(lost); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := tdb.FetchCBlockByHash(lost.CBHash); err != nil || b == nil {
+		t.Errorf("block not put back: %v", err)
+	}
+	after := balances()
+	for i := range before {
+		if before[i] != after[i] {
+			t.Errorf("balance %d changed from %d to %d", i, before[i], after[i])
+		}
+	}
+}
+
+// TestRebuildIndexes rebuilds lost and stale index rows, and leaves the old
+// ones when a block cannot be read
+func TestRebuildIndexes(t *testing.T) {
+	tdb, done := openTestDB(t, 0)
+	defer done()
+	store := tdb.(*LevelDb).store
+
+	g, err := dbgen.New(dbgen.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Generate(tdb, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	lost := append([]byte{byte(TBL_DB_NUM)}, heightToKey(1)...)
+	stale := append([]byte{byte(TBL_DB_NUM)}, heightToKey(7)...)
+	if err := store.Delete(lost); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(stale, common.NewHash().Bytes); err != nil {
+		t.Fatal(err)
+	}
+	if err := tdb.RebuildIndexes(nil); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := tdb.FetchDBlockByHeight(1); err != nil || b == nil {
+		t.Errorf("lost row not rebuilt: %v", err)
+	}
+	if ok, _ := store.Has(stale); ok {
+		t.Errorf("stale row left")
+	}
+
+	// An Admin Block that cannot be read fails the rebuild
+	b, err := tdb.FetchABlockByHeight(2)
+	if err != nil || b == nil {
+		t.Fatalf("no ABlock: %v", err)
+	}
+	if err := store.Put(append([]byte{byte(TBL_AB)}, b.ABHash.Bytes...), []byte{1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put(stale, common.NewHash().Bytes); err != nil {
+		t.Fatal(err)
+	}
+	if err := tdb.RebuildIndexes(nil); err == nil {
+		t.Fatalf("rebuilt from a bad block")
+	}
+	for h := uint64(0); h < 3; h++ {
+		if b, err := tdb.FetchDBlockByHeight(h); err != nil || b == nil {
+			t.Errorf("DBlock %d lost: %v", h, err)
+		}
+	}
+	if ok, _ := store.Has(stale); !ok {
+		t.Errorf("old rows deleted by a failed rebuild")
+	}
+}
+
+// TestFeeSchedule applies the fee schedule of an Admin Block, also after a
+// reopen, and checks the payments against the schedule of their height
+func TestFeeSchedule(t *testing.T) {
+	defer common.SetFeeSchedule(common.GetFeeSchedule())
+
+	dir, err := ioutil.TempDir("", "ldbtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tdb, err := OpenLevelDBWithOptions(dir, true, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := dbgen.New(dbgen.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := g.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := dbgen.Write(tdb, first); err != nil {
+		t.Fatal(err)
+	}
+
+	// The entries of the next block come in before its Entry Credit Block,
+	// and the price goes up in between
+	block, err := g.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entries := range block.Entries {
+		for _, entry := range entries {
+			data, _ := entry.MarshalBinary()
+			if err := tdb.InsertEntry(common.Sha(data), &data, entry, &entry.ChainID.Bytes); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	fees := common.FeeSchedule{CreditsPerKB: 100, CreditsPerChain: 10}
+	m, err := common.NewFeeScheduleMsg(fees)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block.ABlock.AddABMsg(*m)
+	block.ABlock.ABHash = nil
+	if err := tdb.ProcessABlockBatch(block.ABlock); err != nil {
+		t.Fatal(err)
+	}
+	if f := common.GetFeeSchedule(); f != fees {
+		t.Errorf("fee schedule not applied: %+v", f)
+	}
+	if err := tdb.ProcessCBlockBatch(block.CBlock); err == nil {
+		t.Errorf("underpaid entries accepted")
+	}
+
+	tdb.Close()
+	common.SetFeeSchedule(common.FeeSchedule{CreditsPerKB: 1, CreditsPerChain: 10})
+	tdb, err = OpenLevelDBWithOptions(dir, false, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tdb.Close()
+	if f := common.GetFeeSchedule(); f != fees {
+		t.Errorf("fee schedule not applied on open: %+v", f)
+	}
+
+	// An entry of the first block was paid at the old price, and is still
+	// paid enough
+	entry := first.Entries[0][0]
+	data, _ := entry.MarshalBinary()
+	hash := common.Sha(data)
+	if err := tdb.(*LevelDb).store.Delete(append([]byte{byte(TBL_ENTRY)}, hash.Bytes...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := tdb.InsertEntry(hash, &data, entry, &entry.ChainID.Bytes); err != nil {
+		t.Errorf("entry paid at the old price refused: %v", err)
+	}
+	if err := tdb.ProcessCBlockBatch(first.CBlock); err != nil {
+		t.Errorf("Entry Credit Block of the old price refused: %v", err)
+	}
+}
+
+// TestUpgrade builds the height keys of a version 1 database again when it
+// is opened, or restored from a backup
+func TestUpgrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ldbtest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	tdb, err := OpenLevelDBWithOptions(dir, true, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := dbgen.New(dbgen.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Generate(tdb, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Version 1 keyed the Directory Blocks by 4 byte heights
+	store := tdb.(*LevelDb).store
+	key := append([]byte{byte(TBL_DB_NUM)}, heightToKey(1)...)
+	hash, err := store.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put([]byte{byte(TBL_DB_NUM), 0, 0, 0, 1}, hash); err != nil {
+		t.Fatal(err)
+	}
+	tdb.(*LevelDb).version = 1
+	var backup bytes.Buffer
+	if _, err := tdb.Backup(&backup); err != nil {
+		t.Fatal(err)
+	}
+	tdb.Close()
+	if err := ioutil.WriteFile(dir+".ver", []byte{0, 0, 0, 1}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dir + ".ver")
+
+	tdb, err = OpenLevelDBWithOptions(dir, false, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tdb.Close()
+	if b, err := tdb.FetchDBlockByHeight(1); err != nil || b == nil {
+		t.Errorf("height key not upgraded: %v", err)
+	}
+	if ok, _ := tdb.(*LevelDb).store.Has([]byte{byte(TBL_DB_NUM), 0, 0, 0, 1}); ok {
+		t.Errorf("old height key left")
+	}
+	if v, _ := ioutil.ReadFile(dir + ".ver"); !bytes.Equal(v, []byte{0, 0, 0, 2}) {
+		t.Errorf("version file not upgraded: %v", v)
+	}
+
+	restored := dir + ".restored"
+	if _, err := RestoreLevelDB(&backup, restored, testOptions); err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(restored)
+	defer os.Remove(restored + ".ver")
+	rdb, err := OpenLevelDBWithOptions(restored, false, testOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rdb.Close()
+	if b, err := rdb.FetchDBlockByHeight(1); err != nil || b == nil {
+		t.Errorf("height key of the restored database not upgraded: %v", err)
+	}
+	if ok, _ := rdb.(*LevelDb).store.Has([]byte{byte(TBL_DB_NUM), 0, 0, 0, 1}); ok {
+		t.Errorf("old height key left in the restored database")
+	}
+	if v, _ := ioutil.ReadFile(restored + ".ver"); !bytes.Equal(v, []byte{0, 0, 0, 2}) {
+		t.Errorf("version file of the restored database not upgraded: %v", v)
+	}
+}
+
+// benchDBlocks is the number of Directory Blocks the read benchmarks use
+const benchDBlocks = 1000
+
+// testOptions open the databases of the tests
+var testOptions *Options
+
+// openTestDB opens a new database in a temporary directory with a chain of
+// count Directory Blocks
+func openTestDB(b testing.TB, count int) (database.Db, func()) {
+	dir, err := ioutil.TempDir("", "ldbtest")
+	if err != nil {
+		b.Fatal(err)
+	}
+	bdb, err := OpenLevelDBWithOptions(dir, true, testOptions)
+	if err != nil {
+		os.RemoveAll(dir)
+		b.Fatal(err)
+	}
+
+	dChain := &common.DChain{ChainID: &common.Hash{Bytes: common.D_CHAINID}}
+	var prev *common.DirectoryBlock
+	for h := uint32(0); h < uint32(count); h++ {
+		dChain.NextBlockHeight = h
+		dBlock, err := common.CreateDBlock(dChain, prev, 10)
+		if err != nil {
+			b.Fatal(err)
+		}
+		dBlock.Header.BodyMR, _ = dBlock.BuildBodyMR()
+		if err := bdb.ProcessDBlockBatch(dBlock); err != nil {
+			b.Fatal(err)
+		}
+		prev = dBlock
+	}
+
+	return bdb, func() {
+		bdb.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// BenchmarkParallelReads fetches Directory Blocks by height from all of the
+// CPUs at once
+func BenchmarkParallelReads(b *testing.B) {
+	bdb, done := openTestDB(b, benchDBlocks)
+	defer done()
+
+	var n uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			h := atomic.AddUint64(&n, 1) % benchDBlocks
+			if _, err := bdb.FetchDBlockByHeight(h); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkParallelReadsWithWrites is BenchmarkParallelReads while entries
+// are written and all the Directory Blocks are read over and over
+func BenchmarkParallelReadsWithWrites(b *testing.B) {
+	bdb, done := openTestDB(b, benchDBlocks)
+	defer done()
+
+	stop := make(chan struct{})
+	finished := make(chan struct{}, 2)
+	go func() {
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				finished <- struct{}{}
+				return
+			default:
+			}
+			entry := &common.Entry{ChainID: common.NewHash(), Data: []byte{byte(i), byte(i >> 8)}}
+			data, _ := entry.MarshalBinary()
+			bdb.InsertEntry(common.Sha(data), &data, entry, nil)
+		}
+	}()
+	go func() {
+		for {
+			select {
+			case <-stop:
+				finished <- struct{}{}
+				return
+			default:
+			}
+			bdb.FetchAllDBlocks()
+		}
+	}()
+
+	var n uint64
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			h := atomic.AddUint64(&n, 1) % benchDBlocks
+			if _, err := bdb.FetchDBlockByHeight(h); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.StopTimer()
+
+	close(stop)
+	<-finished
+	<-finished
+}
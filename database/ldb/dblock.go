@@ -1,12 +1,11 @@
 package ldb
 
 import (
-	"bytes"
-	"encoding/binary"
 	"errors"
+	"fmt"
 	"github.com/FactomProject/FactomCode/common"
-	"github.com/FactomProject/goleveldb/leveldb"
-	"github.com/FactomProject/goleveldb/leveldb/util"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/kv"
 	"log"
 )
 
@@ -25,7 +24,7 @@ import (
 
 	fbEntrySlice := make([]*common.DBEntry, 0, 10)
 
-	iter := db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
+	iter := db.store.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
 
 	for iter.Next() {
 		if bytes.Equal(iter.Value(), []byte{byte(STATUS_IN_QUEUE)}) {
@@ -52,11 +51,10 @@ import (
 func (db *LevelDb) ProcessDBlockBatch(dblock *common.DirectoryBlock) error {
 
 	if dblock != nil {
-		if db.lbatch == nil {
-			db.lbatch = new(leveldb.Batch)
-		}
+		db.dbLock.Lock()
+		defer db.dbLock.Unlock()
 
-		defer db.lbatch.Reset()
+		batch := new(kv.Batch)
 
 		binaryDblock, err := dblock.MarshalBinary()
 		if err != nil {
@@ -70,14 +68,12 @@ func (db *LevelDb) ProcessDBlockBatch(dblock *common.DirectoryBlock) error {
 		// Insert the binary directory block
 		var key []byte = []byte{byte(TBL_DB)}
 		key = append(key, dblock.DBHash.Bytes...)
-		db.lbatch.Put(key, binaryDblock)
+		batch.Put(key, binaryDblock)
 
 		// Insert block height cross reference
 		var dbNumkey []byte = []byte{byte(TBL_DB_NUM)}
-		var buf bytes.Buffer
-		binary.Write(&buf, binary.BigEndian, dblock.Header.BlockHeight)
-		dbNumkey = append(dbNumkey, buf.Bytes()...)
-		db.lbatch.Put(dbNumkey, dblock.DBHash.Bytes)
+		dbNumkey = append(dbNumkey, heightToKey(uint64(dblock.Header.BlockHeight))...)
+		batch.Put(dbNumkey, dblock.DBHash.Bytes)
 
 		// Update DBEntry process queue for each dbEntry in dblock
 /*		for i := 0; i < len(dblock.DBEntries); i++ {
@@ -94,16 +90,22 @@ func (db *LevelDb) ProcessDBlockBatch(dblock *common.DirectoryBlock) error {
 				var ebInfoKey []byte = []byte{byte(TBL_EB_INFO)}
 				ebInfoKey = append(ebInfoKey, ebInfo.EBHash.Bytes...)
 				binaryEbInfo, _ := ebInfo.MarshalBinary()
-				db.lbatch.Put(ebInfoKey, binaryEbInfo)
+				batch.Put(ebInfoKey, binaryEbInfo)
 			}
 		}
 */
-		err = db.lDb.Write(db.lbatch, db.wo)
+		err = db.store.Write(batch)
 		if err != nil {
 			log.Println("batch failed %v\n", err)
 			return err
 		}
 
+		db.events.Publish(&database.Event{
+			Type:   database.EventDBlock,
+			Hash:   dblock.DBHash,
+			KeyMR:  dblock.KeyMR,
+			Height: dblock.Header.BlockHeight,
+		})
 	}
 	return nil
 }
@@ -117,17 +119,14 @@ func (db *LevelDb) InsertDBInfo(dbInfo common.DBInfo) (err error) {
 	db.dbLock.Lock()
 	defer db.dbLock.Unlock()
 
-	if db.lbatch == nil {
-		db.lbatch = new(leveldb.Batch)
-	}
-	defer db.lbatch.Reset()
+	batch := new(kv.Batch)
 
 	var key []byte = []byte{byte(TBL_DB_INFO)} // Table Name (1 bytes)
 	key = append(key, dbInfo.DBHash.Bytes...)
 	binaryDBInfo, _ := dbInfo.MarshalBinary()
-	db.lbatch.Put(key, binaryDBInfo)
+	batch.Put(key, binaryDBInfo)
 
-	err = db.lDb.Write(db.lbatch, db.wo)
+	err = db.store.Write(batch)
 	if err != nil {
 		log.Println("batch failed %v\n", err)
 		return err
@@ -138,12 +137,9 @@ func (db *LevelDb) InsertDBInfo(dbInfo common.DBInfo) (err error) {
 
 // FetchDBInfoByHash gets an DBInfo obj
 func (db *LevelDb) FetchDBInfoByHash(dbHash *common.Hash) (dbInfo *common.DBInfo, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
-
 	var key []byte = []byte{byte(TBL_DB_INFO)}
 	key = append(key, dbHash.Bytes...)
-	data, err := db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 
 	if data != nil {
 		dbInfo = new(common.DBInfo)
@@ -155,12 +151,9 @@ func (db *LevelDb) FetchDBInfoByHash(dbHash *common.Hash) (dbInfo *common.DBInfo
 
 // FetchDBlock gets an entry by hash from the database.
 func (db *LevelDb) FetchDBlockByHash(dBlockHash *common.Hash) (dBlock *common.DirectoryBlock, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
-
 	var key []byte = []byte{byte(TBL_DB)}
 	key = append(key, dBlockHash.Bytes...)
-	data, err := db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 
 	if data == nil {
 		return nil, errors.New("DBlock not found for Hash: " + dBlockHash.String())
@@ -180,36 +173,86 @@ func (db *LevelDb) FetchDBlockByHash(dBlockHash *common.Hash) (dBlock *common.Di
 
 // FetchDBlockByHeight gets an directory block by height from the database.
 func (db *LevelDb) FetchDBlockByHeight(dBlockHeight uint64) (dBlock *common.DirectoryBlock, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
+	snap, err := db.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	return db.fetchDBlockByHeight(snap, dBlockHeight)
+}
 
+// fetchDBlockByHeight reads a directory block by height from r
+func (db *LevelDb) fetchDBlockByHeight(r reader, dBlockHeight uint64) (dBlock *common.DirectoryBlock, err error) {
 	var key []byte = []byte{byte(TBL_DB_NUM)}
-	var buf bytes.Buffer
-	binary.Write(&buf, binary.BigEndian, dBlockHeight)
-	key = append(key, buf.Bytes()...)
-	data, err := db.lDb.Get(key, db.ro)
+	key = append(key, heightToKey(dBlockHeight)...)
+	dBlockHash, err := r.Get(key)
+
+	if dBlockHash == nil {
+		return nil, fmt.Errorf("DBlock not found for height: %d", dBlockHeight)
+	}
+
+	key = []byte{byte(TBL_DB)}
+	key = append(key, dBlockHash...)
+	data, err := r.Get(key)
 
 	if data == nil {
-		return nil, errors.New("DBlock not found for height: " + string(dBlockHeight))
+		return nil, fmt.Errorf("DBlock not found for height: %d", dBlockHeight)
 	} else {
 		dBlock = new(common.DirectoryBlock)
 		dBlock.UnmarshalBinary(data)
+		dBlock.DBHash = new(common.Hash)
+		dBlock.DBHash.UnmarshalBinary(dBlockHash)
 	}
 
 	return dBlock, nil
 }
 
+// FetchDBlockHead gets the newest directory block from the database.
+func (db *LevelDb) FetchDBlockHead() (dBlock *common.DirectoryBlock, err error) {
+	snap, err := db.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	return db.fetchDBlockHead(snap)
+}
+
+// fetchDBlockHead reads the newest directory block from r
+func (db *LevelDb) fetchDBlockHead(r reader) (dBlock *common.DirectoryBlock, err error) {
+	var fromkey []byte = []byte{byte(TBL_DB_NUM)} // Table Name (1 bytes)
+	var tokey []byte = []byte{byte(TBL_DB_NUM + 1)} // Table Name (1 bytes)
+
+	iter := r.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
+	if iter.Last() {
+		dBlockHash := make([]byte, len(iter.Value()))
+		copy(dBlockHash, iter.Value())
+
+		var key []byte = []byte{byte(TBL_DB)}
+		key = append(key, dBlockHash...)
+		data, _ := r.Get(key)
+		if data != nil {
+			dBlock = new(common.DirectoryBlock)
+			dBlock.UnmarshalBinary(data)
+			dBlock.DBHash = new(common.Hash)
+			dBlock.DBHash.UnmarshalBinary(dBlockHash)
+		}
+	}
+	iter.Release()
+	err = iter.Error()
+
+	return dBlock, err
+}
+
 // FetchAllDBInfo gets all of the fbInfo
 func (db *LevelDb) FetchAllDBlocks() (dBlocks []common.DirectoryBlock, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
-
 	var fromkey []byte = []byte{byte(TBL_DB)}   // Table Name (1 bytes)						// Timestamp  (8 bytes)
 	var tokey []byte = []byte{byte(TBL_DB + 1)} // Table Name (1 bytes)
 
 	dBlockSlice := make([]common.DirectoryBlock, 0, 10)
 
-	iter := db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
+	iter := db.store.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
 
 	for iter.Next() {
 		var dBlock common.DirectoryBlock
@@ -1,13 +1,11 @@
 package ldb
 
 import (
-	"encoding/binary"
 	"errors"
 	"github.com/FactomProject/FactomCode/common"
-	"github.com/FactomProject/goleveldb/leveldb"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/kv"
 	"log"
-
-	"github.com/FactomProject/goleveldb/leveldb/util"
 )
 
 // FetchEBEntriesFromQueue gets all of the ebentries that have not been processed
@@ -28,7 +26,7 @@ import (
 
 	ebEntrySlice := make([]*common.EBEntry, 0, 10)
 
-	iter := db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
+	iter := db.store.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
 
 	for iter.Next() {
 		if bytes.Equal(iter.Value(), []byte{byte(STATUS_IN_QUEUE)}) {
@@ -52,11 +50,10 @@ import (
 func (db *LevelDb) ProcessEBlockBatch(eblock *common.EBlock) error {
 
 	if eblock != nil {
-		if db.lbatch == nil {
-			db.lbatch = new(leveldb.Batch)
-		}
+		db.dbLock.Lock()
+		defer db.dbLock.Unlock()
 
-		defer db.lbatch.Reset()
+		batch := new(kv.Batch)
 
 		if len(eblock.EBEntries) < 1 {
 			return errors.New("Empty eblock!")
@@ -78,21 +75,24 @@ func (db *LevelDb) ProcessEBlockBatch(eblock *common.EBlock) error {
 		// Insert the binary entry block
 		var key []byte = []byte{byte(TBL_EB)}
 		key = append(key, eblock.EBHash.Bytes...)
-		db.lbatch.Put(key, binaryEblock)
+		batch.Put(key, binaryEblock)
 
 		// Insert the entry block merkle root cross reference
 		key = []byte{byte(TBL_EB_MR)}
 		key = append(key, eblock.MerkleRoot.Bytes...)
 		binaryEBHash, _ := eblock.EBHash.MarshalBinary()
-		db.lbatch.Put(key, binaryEBHash)
+		batch.Put(key, binaryEBHash)
 
 		// Insert the entry block number cross reference
 		key = []byte{byte(TBL_EB_CHAIN_NUM)}
 		key = append(key, eblock.Header.ChainID.Bytes...)
-		bytes := make([]byte, 8)
-		binary.BigEndian.PutUint32(bytes, eblock.Header.EBHeight)
-		key = append(key, bytes...)
-		db.lbatch.Put(key, binaryEBHash)
+		key = append(key, heightToKey(uint64(eblock.Header.EBHeight))...)
+		batch.Put(key, binaryEBHash)
+
+		// Update the chain record
+		if err = db.updateChain(batch, eblock); err != nil {
+			return err
+		}
 
 		// Update entry process queue for each entry in eblock
 		/**************************************
@@ -109,31 +109,121 @@ func (db *LevelDb) ProcessEBlockBatch(eblock *common.EBlock) error {
 				var entryInfoKey []byte = []byte{byte(TBL_ENTRY_INFO)}
 				entryInfoKey = append(entryInfoKey, entryInfo.EntryHash.Bytes...)
 				binaryEntryInfo, _ := entryInfo.MarshalBinary()
-				db.lbatch.Put(entryInfoKey, binaryEntryInfo)
+				batch.Put(entryInfoKey, binaryEntryInfo)
 			
 			}
 
 		}
 	    *****************************************/
 
-		err = db.lDb.Write(db.lbatch, db.wo)
+		err = db.store.Write(batch)
 		if err != nil {
 			log.Println("batch failed %v\n", err)
 			return err
 		}
 
+		db.events.Publish(&database.Event{
+			Type:    database.EventEBlock,
+			Hash:    eblock.EBHash,
+			KeyMR:   eblock.MerkleRoot,
+			ChainID: eblock.Header.ChainID,
+			Height:  eblock.Header.DBHeight,
+		})
 	}
 	return nil
 }
 
+// updateChain adds the EBlock to the record of its chain in the batch
+func (db *LevelDb) updateChain(batch *kv.Batch, eblock *common.EBlock) error {
+	chain, err := db.fetchChain(db.store, eblock.Header.ChainID)
+	if err != nil {
+		return err
+	}
+	if chain == nil {
+		chain = new(common.EChain)
+		chain.ChainID = eblock.Header.ChainID
+	}
+
+	db.addToChain(chain, eblock)
+
+	binaryChain, err := chain.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	var key []byte = []byte{byte(TBL_CHAIN_HASH)}
+	key = append(key, chain.ChainID.Bytes...)
+	batch.Put(key, binaryChain)
+
+	return nil
+}
+
+// addToChain counts the EBlock and its entries in a chain record. The EBlocks
+// of a chain must be added in order.
+func (db *LevelDb) addToChain(chain *common.EChain, eblock *common.EBlock) {
+	// The EBlock has been counted already
+	if eblock.Header.EBHeight < chain.EBlockCount {
+		return
+	}
+
+	if chain.EBlockCount == 0 {
+		chain.CreatedHeight = eblock.Header.DBHeight
+	}
+
+	for _, ebEntry := range eblock.EBEntries {
+		if common.IsEndOfMinuteMarker(ebEntry.EntryHash) {
+			continue
+		}
+		if chain.FirstEntryHash == nil {
+			chain.FirstEntryHash = ebEntry.EntryHash
+		}
+		chain.EntryCount++
+	}
+
+	// The chain name is the External IDs of the first entry
+	if len(chain.Name) == 0 && chain.FirstEntryHash != nil {
+		var key []byte = []byte{byte(TBL_ENTRY)}
+		key = append(key, chain.FirstEntryHash.Bytes...)
+		data, err := db.store.Get(key)
+		if data != nil && err == nil {
+			entry := new(common.Entry)
+			if entry.UnmarshalBinary(data) == nil {
+				chain.Name = entry.ExtIDs
+			}
+		}
+	}
+
+	chain.EBlockCount = eblock.Header.EBHeight + 1
+	chain.LastHeight = eblock.Header.DBHeight
+}
+
+// fetchChain reads a chain record from r
+func (db *LevelDb) fetchChain(r reader, chainID *common.Hash) (chain *common.EChain, err error) {
+	var key []byte = []byte{byte(TBL_CHAIN_HASH)}
+	key = append(key, chainID.Bytes...)
+	data, err := r.Get(key)
+	if err == kv.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	chain = new(common.EChain)
+	if err = chain.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	// Only the hash of the first entry is kept in the record
+	chain.FirstEntry = nil
+
+	return chain, nil
+}
+
 // FetchEBInfoByHash gets an EBInfo obj
 func (db *LevelDb) FetchEBInfoByHash(ebHash *common.Hash) (ebInfo *common.EBInfo, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
-
 	var key []byte = []byte{byte(TBL_EB_INFO)}
 	key = append(key, ebHash.Bytes...)
-	data, err := db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 
 	if data != nil {
 		ebInfo = new(common.EBInfo)
@@ -145,10 +235,25 @@ func (db *LevelDb) FetchEBInfoByHash(ebHash *common.Hash) (ebInfo *common.EBInfo
 
 // FetchEBlockByMR gets an entry block by merkle root from the database.
 func (db *LevelDb) FetchEBlockByMR(eBMR *common.Hash) (eBlock *common.EBlock, err error) {
-	eBlockHash, _ := db.FetchEBHashByMR(eBMR)
+	snap, err := db.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
 
-	if eBlockHash != nil {
-		eBlock, _ = db.FetchEBlockByHash(eBlockHash)
+	return db.fetchEBlockByMR(snap, eBMR)
+}
+
+// fetchEBlockByMR reads an entry block by merkle root from r
+func (db *LevelDb) fetchEBlockByMR(r reader, eBMR *common.Hash) (eBlock *common.EBlock, err error) {
+	var key []byte = []byte{byte(TBL_EB_MR)}
+	key = append(key, eBMR.Bytes...)
+	data, _ := r.Get(key)
+
+	if data != nil {
+		eBlockHash := new(common.Hash)
+		eBlockHash.UnmarshalBinary(data)
+		eBlock = db.fetchEBlock(r, eBlockHash)
 	}
 
 	return eBlock, nil
@@ -156,12 +261,9 @@ func (db *LevelDb) FetchEBlockByMR(eBMR *common.Hash) (eBlock *common.EBlock, er
 
 // FetchEntryBlock gets an entry by hash from the database.
 func (db *LevelDb) FetchEBlockByHash(eBlockHash *common.Hash) (eBlock *common.EBlock, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
-
 	var key []byte = []byte{byte(TBL_EB)}
 	key = append(key, eBlockHash.Bytes...)
-	data, err := db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 
 	if data != nil {
 		eBlock = new(common.EBlock)
@@ -172,32 +274,79 @@ func (db *LevelDb) FetchEBlockByHash(eBlockHash *common.Hash) (eBlock *common.EB
 
 // FetchEBlockByHeight gets an entry block by height from the database.
 func (db *LevelDb) FetchEBlockByHeight(chainID * common.Hash, eBlockHeight uint64) (eBlock *common.EBlock, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
+	snap, err := db.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	return db.fetchEBlockByHeight(snap, chainID, eBlockHeight)
+}
 
+// fetchEBlockByHeight reads an entry block by height from r
+func (db *LevelDb) fetchEBlockByHeight(r reader, chainID * common.Hash, eBlockHeight uint64) (eBlock *common.EBlock, err error) {
 	var key []byte = []byte{byte(TBL_EB_CHAIN_NUM)}
 	key = append(key, chainID.Bytes...)
-	bytes := make([]byte, 8)
-	binary.BigEndian.PutUint64(bytes, eBlockHeight)
-	key = append(key, bytes...)	
-	data, err := db.lDb.Get(key, db.ro)
+	key = append(key, heightToKey(eBlockHeight)...)
+	data, err := r.Get(key)
 
 	if data != nil {
-		eBlock = new(common.EBlock)
-		eBlock.UnmarshalBinary(data)
+		eBlockHash := new(common.Hash)
+		eBlockHash.UnmarshalBinary(data)
+		eBlock = db.fetchEBlock(r, eBlockHash)
 	}
 	return eBlock, nil
 }
 
+// FetchEBlockHead gets the newest entry block of a chain from the database.
+func (db *LevelDb) FetchEBlockHead(chainID *common.Hash) (eBlock *common.EBlock, err error) {
+	snap, err := db.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	return db.fetchEBlockHead(snap, chainID)
+}
+
+// fetchEBlockHead reads the newest entry block of a chain from r
+func (db *LevelDb) fetchEBlockHead(r reader, chainID *common.Hash) (eBlock *common.EBlock, err error) {
+	var fromkey []byte = []byte{byte(TBL_EB_CHAIN_NUM)} // Table Name (1 bytes)
+	fromkey = append(fromkey, chainID.Bytes...)         // Chain Type (32 bytes)
+	var tokey []byte = addOneToByteArray(fromkey)
+
+	iter := r.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
+	if iter.Last() {
+		eBlockHash := new(common.Hash)
+		eBlockHash.UnmarshalBinary(iter.Value())
+		eBlock = db.fetchEBlock(r, eBlockHash)
+	}
+	iter.Release()
+	err = iter.Error()
+
+	return eBlock, err
+}
+
+// fetchEBlock reads an entry block from r
+func (db *LevelDb) fetchEBlock(r reader, eBlockHash *common.Hash) *common.EBlock {
+	var key []byte = []byte{byte(TBL_EB)}
+	key = append(key, eBlockHash.Bytes...)
+	data, _ := r.Get(key)
+	if data == nil {
+		return nil
+	}
+
+	eBlock := new(common.EBlock)
+	eBlock.UnmarshalBinary(data)
+	eBlock.EBHash = eBlockHash
+	return eBlock
+}
 
 // FetchEBHashByMR gets an entry by hash from the database.
 func (db *LevelDb) FetchEBHashByMR(eBMR *common.Hash) (eBlockHash *common.Hash, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
-
 	var key []byte = []byte{byte(TBL_EB_MR)}
 	key = append(key, eBMR.Bytes...)
-	data, err := db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 
 	if data != nil {
 		log.Println("data:%v", data)
@@ -208,24 +357,44 @@ func (db *LevelDb) FetchEBHashByMR(eBMR *common.Hash) (eBlockHash *common.Hash,
 	return eBlockHash, nil
 }
 
-// InsertChain inserts the newly created chain into db
+// InsertChain inserts the newly created chain into db. The counts of an
+// existing chain record are kept.
 func (db *LevelDb) InsertChain(chain *common.EChain) (err error) {
 	db.dbLock.Lock()
 	defer db.dbLock.Unlock()
 
-	if db.lbatch == nil {
-		db.lbatch = new(leveldb.Batch)
+	batch := new(kv.Batch)
+
+	record, err := db.fetchChain(db.store, chain.ChainID)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		record = new(common.EChain)
+		record.ChainID = chain.ChainID
+	}
+	if len(chain.Name) > 0 {
+		record.Name = chain.Name
+	}
+	if chain.FirstEntry != nil && record.FirstEntryHash == nil {
+		binaryEntry, err := chain.FirstEntry.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		record.FirstEntryHash = common.Sha(binaryEntry)
 	}
-	defer db.lbatch.Reset()
 
-	binaryChain, _ := chain.MarshalBinary()
+	binaryChain, err := record.MarshalBinary()
+	if err != nil {
+		return err
+	}
 
 	var chainByHashKey []byte = []byte{byte(TBL_CHAIN_HASH)}
 	chainByHashKey = append(chainByHashKey, chain.ChainID.Bytes...)
 
-	db.lbatch.Put(chainByHashKey, binaryChain)
+	batch.Put(chainByHashKey, binaryChain)
 
-	err = db.lDb.Write(db.lbatch, db.wo)
+	err = db.store.Write(batch)
 	if err != nil {
 		log.Println("batch failed %v\n", err)
 		return err
@@ -236,25 +405,11 @@ func (db *LevelDb) InsertChain(chain *common.EChain) (err error) {
 
 // FetchChainByHash gets a chain by chainID
 func (db *LevelDb) FetchChainByHash(chainID *common.Hash) (chain *common.EChain, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
-
-	var key []byte = []byte{byte(TBL_CHAIN_HASH)}
-	key = append(key, chainID.Bytes...)
-	data, err := db.lDb.Get(key, db.ro)
-
-	if data != nil {
-		chain = new(common.EChain)
-		chain.UnmarshalBinary(data)
-	}
-	return chain, nil
+	return db.fetchChain(db.store, chainID)
 }
 
 // FetchChainIDByName gets a chainID by chain name
 func (db *LevelDb) FetchChainIDByName(chainName [][]byte) (chainID *common.Hash, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
-
 	chainID, err = common.GetChainID(chainName)
 	if err != nil  {
 	   return nil,err
@@ -277,19 +432,19 @@ func (db *LevelDb) FetchChainByName(chainName [][]byte) (chain *common.EChain, e
 }
 
 // FetchAllChains get all of the cahins
-func (db *LevelDb) FetchAllChains() (chains []common.EChain, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
-
+func (db *LevelDb) FetchAllChains() (chains []*common.EChain, err error) {
 	var fromkey []byte = []byte{byte(TBL_CHAIN_HASH)}   // Table Name (1 bytes)
 	var tokey []byte = []byte{byte(TBL_CHAIN_HASH + 1)} // Table Name (1 bytes)
 
-	chainSlice := make([]common.EChain, 0, 10)
+	chainSlice := make([]*common.EChain, 0, 10)
 
-	iter := db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
+	iter := db.store.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
 	for iter.Next() {
-		var chain common.EChain
-		chain.UnmarshalBinary(iter.Value())
+		chain := new(common.EChain)
+		if err := chain.UnmarshalBinary(iter.Value()); err != nil {
+			continue
+		}
+		chain.FirstEntry = nil
 		chainSlice = append(chainSlice, chain)
 	}
 	iter.Release()
@@ -304,8 +459,11 @@ func (db *LevelDb) FetchAllChains() (chains []common.EChain, err error) {
 
 // FetchAllEBlocksByChain gets all of the blocks by chain id
 func (db *LevelDb) FetchAllEBlocksByChain(chainID *common.Hash) (eBlocks *[]common.EBlock, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
+	snap, err := db.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
 
 	var fromkey []byte = []byte{byte(TBL_EB_CHAIN_NUM)} // Table Name (1 bytes)
 	fromkey = append(fromkey, []byte(chainID.Bytes)...) // Chain Type (32 bytes)
@@ -313,7 +471,7 @@ func (db *LevelDb) FetchAllEBlocksByChain(chainID *common.Hash) (eBlocks *[]comm
 
 	eBlockSlice := make([]common.EBlock, 0, 10)
 
-	iter := db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
+	iter := snap.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
 
 	for iter.Next() {
 		eBlockHash := new(common.Hash)
@@ -321,7 +479,7 @@ func (db *LevelDb) FetchAllEBlocksByChain(chainID *common.Hash) (eBlocks *[]comm
 
 		var key []byte = []byte{byte(TBL_EB)}
 		key = append(key, eBlockHash.Bytes...)
-		data, _ := db.lDb.Get(key, db.ro)
+		data, _ := snap.Get(key)
 
 		if data != nil {
 			eBlock := new(common.EBlock)
@@ -338,8 +496,11 @@ func (db *LevelDb) FetchAllEBlocksByChain(chainID *common.Hash) (eBlocks *[]comm
 
 // FetchAllEBInfosByChain gets all of the entry block infos by chain id
 func (db *LevelDb) FetchAllEBInfosByChain(chainID *common.Hash) (eBInfos *[]common.EBInfo, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
+	snap, err := db.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
 
 	var fromkey []byte = []byte{byte(TBL_EB_CHAIN_NUM)} // Table Name (1 bytes)
 	fromkey = append(fromkey, []byte(chainID.Bytes)...) // Chain Type (32 bytes)
@@ -347,7 +508,7 @@ func (db *LevelDb) FetchAllEBInfosByChain(chainID *common.Hash) (eBInfos *[]comm
 
 	eBInfoSlice := make([]common.EBInfo, 0, 10)
 
-	iter := db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
+	iter := snap.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
 
 	for iter.Next() {
 		eBlockHash := new(common.Hash)
@@ -356,7 +517,7 @@ func (db *LevelDb) FetchAllEBInfosByChain(chainID *common.Hash) (eBInfos *[]comm
 
 		var key []byte = []byte{byte(TBL_EB_INFO)}
 		key = append(key, eBlockHash.Bytes...)
-		data, _ := db.lDb.Get(key, db.ro)
+		data, _ := snap.Get(key)
 
 		if data != nil {
 			eBInfo := new(common.EBInfo)
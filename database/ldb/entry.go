@@ -1,10 +1,10 @@
 package ldb
 
 import (
-
+	"fmt"
 	"github.com/FactomProject/FactomCode/common"
-	"github.com/FactomProject/goleveldb/leveldb"
-	"github.com/FactomProject/goleveldb/leveldb/util"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/kv"
 	"log"
 	"strings"
 )
@@ -14,32 +14,56 @@ func (db *LevelDb) InsertEntry(entrySha *common.Hash, binaryEntry *[]byte, entry
 	db.dbLock.Lock()
 	defer db.dbLock.Unlock()
 
-	if db.lbatch == nil {
-		db.lbatch = new(leveldb.Batch)
+	// An entry paid for in a stored Entry Credit Block must be paid enough
+	// in the fee schedule of the block
+	payment, err := db.fetchPayment(db.store, entrySha)
+	if err != nil {
+		return err
 	}
-	defer db.lbatch.Reset()
+	if payment != nil {
+		fees, err := db.feeScheduleAt(db.store, payment.DBHeight)
+		if err != nil {
+			return err
+		}
+		if err := fees.CheckPayment(payment.Entry, len(*binaryEntry)); err != nil {
+			return fmt.Errorf("Entry %s: %v", entrySha.String(), err)
+		}
+	}
+
+	batch := new(kv.Batch)
 
 	var entryKey []byte = []byte{byte(TBL_ENTRY)}
 	entryKey = append(entryKey, entrySha.Bytes...)
-	db.lbatch.Put(entryKey, *binaryEntry)
+	batch.Put(entryKey, *binaryEntry)
 
-	err = db.lDb.Write(db.lbatch, db.wo)
+	err = db.store.Write(batch)
 	if err != nil {
 		log.Println("batch failed %v\n", err)
 		return err
 	}
 
+	event := &database.Event{
+		Type: database.EventEntry,
+		Hash: entrySha,
+	}
+	if chainID != nil {
+		event.ChainID = &common.Hash{Bytes: *chainID}
+	}
+	db.events.Publish(event)
+
 	return nil
 }
 
 // FetchEntry gets an entry by hash from the database.
 func (db *LevelDb) FetchEntryByHash(entrySha *common.Hash) (entry *common.Entry, err error) {
-	db.dbLock.Lock()
-	defer db.dbLock.Unlock()
+	return db.fetchEntry(db.store, entrySha)
+}
 
+// fetchEntry reads an entry from r
+func (db *LevelDb) fetchEntry(r reader, entrySha *common.Hash) (entry *common.Entry, err error) {
 	var key []byte = []byte{byte(TBL_ENTRY)}
 	key = append(key, entrySha.Bytes...)
-	data, err := db.lDb.Get(key, db.ro)
+	data, err := r.Get(key)
 
 	if data != nil {
 		entry = new(common.Entry)
@@ -73,7 +97,7 @@ func (db *LevelDb) FetchEntryInfoByHash(entryHash *common.Hash) (entryInfo *comm
 
 	var key []byte = []byte{byte(TBL_ENTRY_INFO)}
 	key = append(key, entryHash.Bytes...)
-	data, err := db.lDb.Get(key, db.ro)
+	data, err := db.store.Get(key)
 
 	if data != nil {
 		entryInfo = new(common.EntryInfo)
@@ -91,7 +115,7 @@ func (db *LevelDb) InitializeExternalIDMap() (extIDMap map[string]bool, err erro
 
 	extIDMap = make(map[string]bool)
 
-	iter := db.lDb.NewIterator(&util.Range{Start: fromkey, Limit: tokey}, db.ro)
+	iter := db.store.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
 
 	for iter.Next() {
 		entry := new(common.Entry)
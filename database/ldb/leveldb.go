@@ -5,14 +5,19 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 
+	"github.com/FactomProject/FactomCode/common"
 	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/kv"
+	"github.com/FactomProject/FactomCode/database/kv/btree"
+	"github.com/FactomProject/FactomCode/database/kv/leveldbkv"
 
 	"github.com/FactomProject/btcd/wire"
-	"github.com/FactomProject/goleveldb/leveldb"
 //	"github.com/FactomProject/goleveldb/leveldb/cache"
+	"github.com/FactomProject/goleveldb/leveldb/filter"
 	"github.com/FactomProject/goleveldb/leveldb/opt"
 )
 
@@ -48,6 +53,18 @@ const (
 	TBL_FB //14
 	TBL_FB_NUM
 	TBL_FB_INFO
+
+	TBL_CB_PUBKEY //17
+	TBL_EC_BALANCE
+	TBL_EC_BALANCE_MR
+
+	TBL_COMMIT //20
+
+	TBL_AB //21
+	TBL_AB_NUM
+	TBL_AB_FEES
+
+	TBL_CB_PAYMENT //24
 )
 
 // the process status in db
@@ -69,16 +86,33 @@ type tTxInsertData struct {
 	usedbuf []byte
 }
 
+// reader is the store or a snapshot of it. Reads that look up more than one
+// key go through a snapshot, so a write in between is not seen half way.
+type reader interface {
+	kv.Reader
+}
+
+// LevelDb keeps the blocks and entries in the tables of a key value store,
+// leveldb unless another backend is chosen in the Options
 type LevelDb struct {
-	// lock preventing multiple entry
+	// lock serializing the writes. Reads do not take it, the stores are
+	// safe for concurrent use.
 	dbLock sync.Mutex
 
-	// leveldb pieces
-	lDb *leveldb.DB
-	ro  *opt.ReadOptions
-	wo  *opt.WriteOptions
+	store kv.Store
+
+	// version of the .ver file
+	version int32
+
+	// fee schedule in force before an Admin Block sets one
+	configuredFees common.FeeSchedule
 
-	lbatch *leveldb.Batch
+	// balance tree after the latest entry credit block, loaded on first use
+	ecBalances  *common.ECBalanceTree
+	balanceLock sync.Mutex
+
+	// observers of the data written
+	events *database.EventFeed
 
 	nextBlock int64
 
@@ -90,21 +124,88 @@ type LevelDb struct {
 	//	txSpentUpdateMap map[wire.ShaHash]*spentTxUpdate
 }
 
-var CurrentDBVersion int32 = 1
+// CurrentDBVersion is the version of new databases. Version 2 keys the height
+// cross references by 8 byte heights, and older databases have their indexes
+// built again when they are opened.
+var CurrentDBVersion int32 = 2
+
+// Options tune the database. A zero field keeps the default.
+type Options struct {
+	// BlockCacheSize and WriteBufferSize are in bytes
+	BlockCacheSize  int
+	WriteBufferSize int
+
+	// BloomFilterBits is the bits per key of the bloom filters of the
+	// tables, written as they are compacted
+	BloomFilterBits int
+
+	// Compression is "none" or "snappy", for the tables written from now on
+	Compression string
+
+	MaxOpenFiles int
+
+	// Backend is BackendLevelDB or BackendBTree, and the others apply to
+	// leveldb only
+	Backend string
+}
+
+// the stores the database can be kept in
+const (
+	BackendLevelDB = "leveldb"
+	BackendBTree   = "btree"
+)
 
 //to be removed??
 func OpenLevelDB(dbpath string, create bool) (pbdb database.Db, err error) {
-	return openDB(dbpath, create)
+	return openDB(dbpath, create, nil)
+}
+
+// OpenLevelDBWithOptions opens the database tuned with options
+func OpenLevelDBWithOptions(dbpath string, create bool, options *Options) (pbdb database.Db, err error) {
+	return openDB(dbpath, create, options)
+}
+
+func openDB(dbpath string, create bool, options *Options) (database.Db, error) {
+	db, err := openLevelDb(dbpath, create, options)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.ready(dbpath + ".ver"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
-func openDB(dbpath string, create bool) (pbdb database.Db, err error) {
+// ready upgrades an older database, and puts in use the fee schedule stored
+func (db *LevelDb) ready(verfile string) error {
+	if db.version < CurrentDBVersion {
+		if err := db.upgrade(verfile); err != nil {
+			return err
+		}
+	}
+
+	// The prices set on the block chain override the configured ones
+	if err := db.applyFeeSchedule(); err != nil {
+		log.Printf("fee schedule not applied: %v\n", err)
+	}
+	return nil
+}
+
+// openLevelDb opens the store of a database as the version it is, without
+// upgrading it
+func openLevelDb(dbpath string, create bool, options *Options) (pbdb *LevelDb, err error) {
 	var db LevelDb
-	var tlDb *leveldb.DB
+	var store kv.Store
 	var dbversion int32
+	verfile := dbpath + ".ver"
 
 	defer func() {
 		if err == nil {
-			db.lDb = tlDb
+			db.store = store
+			db.version = dbversion
+			db.events = database.NewEventFeed()
+			db.configuredFees = common.GetFeeSchedule()
 
 			//			db.txUpdateMap = map[wire.ShaHash]*txUpdateObj{}
 			//			db.txSpentUpdateMap = make(map[wire.ShaHash]*spentTxUpdate)
@@ -127,7 +228,6 @@ func openDB(dbpath string, create bool) (pbdb database.Db, err error) {
 	}
 
 	needVersionFile := false
-	verfile := dbpath + ".ver"
 	fi, ferr := os.Open(verfile)
 	if ferr == nil {
 		defer fi.Close()
@@ -153,14 +253,24 @@ func openDB(dbpath string, create bool) (pbdb database.Db, err error) {
 	switch dbversion {
 	case 0:
 		opts = &opt.Options{}
-	case 1:
+	case 1, 2:
 		// uses defaults from above
 	default:
 		err = fmt.Errorf("unsupported db version %v", dbversion)
 		return
 	}
 
-	tlDb, err = leveldb.OpenFile(dbpath, opts)
+	backend := BackendLevelDB
+	if options != nil {
+		if err = options.apply(opts); err != nil {
+			return
+		}
+		if options.Backend != "" {
+			backend = options.Backend
+		}
+	}
+
+	store, err = openStore(dbpath, backend, opts)
 	if err != nil {
 		return
 	}
@@ -184,8 +294,79 @@ func openDB(dbpath string, create bool) (pbdb database.Db, err error) {
 	return
 }
 
+// upgrade builds the indexes of an older database again, in the layout of
+// CurrentDBVersion, and records the new version
+func (db *LevelDb) upgrade(verfile string) error {
+	log.Printf("upgrading the database from version %d to %d\n", db.version, CurrentDBVersion)
+	err := db.RebuildIndexes(func(table string, done int) {
+		log.Printf("%s: %d rows\n", table, done)
+	})
+	if err != nil {
+		return fmt.Errorf("Database version %d cannot be upgraded, it has to be synced again: %v", db.version, err)
+	}
+
+	fo, err := os.Create(verfile)
+	if err != nil {
+		return err
+	}
+	defer fo.Close()
+	if err := binary.Write(fo, binary.BigEndian, CurrentDBVersion); err != nil {
+		return err
+	}
+	db.version = CurrentDBVersion
+	return nil
+}
+
+// apply sets the leveldb options tuned
+func (o *Options) apply(opts *opt.Options) error {
+	if o.BlockCacheSize > 0 {
+		opts.BlockCacheCapacity = o.BlockCacheSize
+	}
+	if o.WriteBufferSize > 0 {
+		opts.WriteBuffer = o.WriteBufferSize
+	}
+	if o.BloomFilterBits > 0 {
+		opts.Filter = filter.NewBloomFilter(o.BloomFilterBits)
+	}
+	if o.MaxOpenFiles > 0 {
+		opts.OpenFilesCacheCapacity = o.MaxOpenFiles
+	}
+
+	switch o.Compression {
+	case "":
+	case "none":
+		opts.Compression = opt.NoCompression
+	case "snappy":
+		opts.Compression = opt.SnappyCompression
+	default:
+		return fmt.Errorf("unknown compression %v", o.Compression)
+	}
+	return nil
+}
+
+// openStore opens the store of a backend in dbpath, refusing the directory of
+// another one
+func openStore(dbpath string, backend string, opts *opt.Options) (kv.Store, error) {
+	_, lerr := os.Stat(filepath.Join(dbpath, "CURRENT"))
+	_, berr := os.Stat(filepath.Join(dbpath, btree.LogName))
+
+	switch backend {
+	case BackendLevelDB:
+		if berr == nil {
+			return nil, fmt.Errorf("%s is a btree database", dbpath)
+		}
+		return leveldbkv.Open(dbpath, opts)
+	case BackendBTree:
+		if lerr == nil {
+			return nil, fmt.Errorf("%s is a leveldb database", dbpath)
+		}
+		return btree.Open(dbpath)
+	}
+	return nil, fmt.Errorf("unknown database backend %v", backend)
+}
+
 func (db *LevelDb) close() error {
-	return db.lDb.Close()
+	return db.store.Close()
 }
 
 // Sync verifies that the database is coherent on disk,
@@ -204,6 +385,7 @@ func (db *LevelDb) Close() error {
 	db.dbLock.Lock()
 	defer db.dbLock.Unlock()
 
+	db.events.Close()
 	return db.close()
 }
 
@@ -212,6 +394,14 @@ func int64ToKey(keyint int64) []byte {
 	return []byte(key)
 }
 
+// heightToKey encodes a block height for the *_NUM cross reference tables.
+// Heights are always 8 bytes big endian, so the keys sort by height.
+func heightToKey(height uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, height)
+	return key
+}
+
 func shaBlkToKey(sha *wire.ShaHash) []byte {
 	shaB := sha.Bytes()
 	return shaB
@@ -229,16 +419,28 @@ func shaSpentTxToKey(sha *wire.ShaHash) []byte {
 	return shaB
 }
 
-func (db *LevelDb) lBatch() *leveldb.Batch {
-	if db.lbatch == nil {
-		db.lbatch = new(leveldb.Batch)
-	}
-	return db.lbatch
-}
-
 func (db *LevelDb) RollbackClose() error {
 	db.dbLock.Lock()
 	defer db.dbLock.Unlock()
 
+	db.events.Publish(&database.Event{Type: database.EventRollback})
+	db.events.Close()
 	return db.close()
 }
+
+// Subscribe registers an observer that is notified after blocks and entries
+// have been written to the database, and on rollback
+func (db *LevelDb) Subscribe(o database.Observer) *database.Subscription {
+	return db.events.Subscribe(o)
+}
+
+// SubscribeChan is like Subscribe, but delivers the events on the
+// subscription's channel, buffering up to size of them
+func (db *LevelDb) SubscribeChan(size int) *database.Subscription {
+	return db.events.SubscribeChan(size)
+}
+
+// Unsubscribe ends a subscription
+func (db *LevelDb) Unsubscribe(s *database.Subscription) {
+	db.events.Unsubscribe(s)
+}
@@ -0,0 +1,400 @@
+package ldb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database/kv"
+	"log"
+)
+
+// progressInterval is the number of rows between progress reports
+const progressInterval = 1000
+
+// indexTables are the tables built from the blocks and entries
+var indexTables = []uint8{
+	TBL_EB_CHAIN_NUM,
+	TBL_EB_MR,
+	TBL_DB_NUM,
+	TBL_CB_NUM,
+	TBL_CB_PUBKEY,
+	TBL_EC_BALANCE,
+	TBL_EC_BALANCE_MR,
+	TBL_AB_NUM,
+	TBL_AB_FEES,
+	TBL_CB_PAYMENT,
+}
+
+// indexWriter writes the rows of a rebuild in batches, reporting progress. It
+// keeps the keys written, so the rows left over from before can be told apart.
+type indexWriter struct {
+	db       *LevelDb
+	batch    *kv.Batch
+	progress func(table string, done int)
+	table    string
+	done     int
+	written  map[string]bool
+}
+
+// RebuildIndexes builds the tables built from the blocks and entries again
+// from the Directory, Admin, Entry Credit and Entry Blocks. The chain records
+// are counted again, and chains without an Entry Block yet are kept. The new
+// rows are written over the old ones, and the rows left over are deleted only
+// once all of the tables have been built, so a block that cannot be read
+// leaves the old indexes in place. progress, if not nil, is called every few
+// rows and at the end of each table with the rows done.
+func (db *LevelDb) RebuildIndexes(progress func(table string, done int)) error {
+	db.dbLock.Lock()
+	defer db.dbLock.Unlock()
+
+	w := &indexWriter{db: db, batch: new(kv.Batch), progress: progress,
+		written: make(map[string]bool)}
+
+	if err := db.rebuildDBlockIndexes(w); err != nil {
+		return err
+	}
+	if err := db.rebuildABlockIndexes(w); err != nil {
+		return err
+	}
+	if err := db.rebuildEBlockIndexes(w); err != nil {
+		return err
+	}
+	if err := db.rebuildChains(w); err != nil {
+		return err
+	}
+	if err := db.rebuildCBlockIndexes(w); err != nil {
+		return err
+	}
+
+	w.start("drop")
+	for _, table := range indexTables {
+		err := db.forEach(table, func(key []byte, value []byte) error {
+			if w.written[string(key)] {
+				return nil
+			}
+			return w.delete(key)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := w.end(); err != nil {
+		return err
+	}
+
+	// The balances are read again from the rebuilt table
+	db.balanceLock.Lock()
+	db.ecBalances = nil
+	db.balanceLock.Unlock()
+	return db.applyFeeSchedule()
+}
+
+// rebuildDBlockIndexes builds the height index of the Directory Blocks
+func (db *LevelDb) rebuildDBlockIndexes(w *indexWriter) error {
+	w.start("dblock")
+	err := db.forEach(TBL_DB, func(key []byte, value []byte) error {
+		header := new(common.DBlockHeader)
+		if err := unmarshalRow(header, value); err != nil {
+			return err
+		}
+
+		var numKey []byte = []byte{byte(TBL_DB_NUM)}
+		numKey = append(numKey, heightToKey(uint64(header.BlockHeight))...)
+		return w.put(numKey, key[1:])
+	})
+	if err != nil {
+		return err
+	}
+	return w.end()
+}
+
+// rebuildABlockIndexes builds the height index of the Admin Blocks and the
+// fee schedules they set
+func (db *LevelDb) rebuildABlockIndexes(w *indexWriter) error {
+	w.start("ablock")
+	err := db.forEach(TBL_AB, func(key []byte, value []byte) error {
+		block := new(common.AdminBlock)
+		if err := unmarshalRow(block, value); err != nil {
+			return err
+		}
+
+		var numKey []byte = []byte{byte(TBL_AB_NUM)}
+		numKey = append(numKey, heightToKey(uint64(block.DBHeight))...)
+		if err := w.put(numKey, key[1:]); err != nil {
+			return err
+		}
+
+		if fees, ok := block.FeeSchedule(); ok && fees.CreditsPerKB != 0 {
+			return w.put(feesKey(block.DBHeight), feesToBytes(fees))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return w.end()
+}
+
+// rebuildEBlockIndexes builds the merkle root and chain height indexes of the
+// Entry Blocks
+func (db *LevelDb) rebuildEBlockIndexes(w *indexWriter) error {
+	w.start("eblock")
+	err := db.forEach(TBL_EB, func(key []byte, value []byte) error {
+		eblock := new(common.EBlock)
+		if err := unmarshalRow(eblock, value); err != nil {
+			return err
+		}
+		eblock.BuildMerkleRoot()
+
+		var mrKey []byte = []byte{byte(TBL_EB_MR)}
+		mrKey = append(mrKey, eblock.MerkleRoot.Bytes...)
+		if err := w.put(mrKey, key[1:]); err != nil {
+			return err
+		}
+
+		var numKey []byte = []byte{byte(TBL_EB_CHAIN_NUM)}
+		numKey = append(numKey, eblock.Header.ChainID.Bytes...)
+		numKey = append(numKey, heightToKey(uint64(eblock.Header.EBHeight))...)
+		return w.put(numKey, key[1:])
+	})
+	if err != nil {
+		return err
+	}
+	return w.end()
+}
+
+// rebuildChains counts the chain records again from the Entry Blocks, which
+// the chain height index lists in order
+func (db *LevelDb) rebuildChains(w *indexWriter) error {
+	w.start("chain")
+
+	var chain *common.EChain
+	var name [][]byte
+	flush := func() error {
+		if chain == nil {
+			return nil
+		}
+		// The name stored is kept if the first entry is not
+		if len(chain.Name) == 0 {
+			chain.Name = name
+		}
+		binaryChain, err := chain.MarshalBinary()
+		if err != nil {
+			return err
+		}
+		var key []byte = []byte{byte(TBL_CHAIN_HASH)}
+		key = append(key, chain.ChainID.Bytes...)
+		return w.put(key, binaryChain)
+	}
+
+	err := db.forEach(TBL_EB_CHAIN_NUM, func(key []byte, value []byte) error {
+		// Rows left over from before the rebuild are not counted
+		if !w.written[string(key)] {
+			return nil
+		}
+		eblock := db.fetchEBlock(db.store, &common.Hash{Bytes: value})
+		if eblock == nil {
+			return nil
+		}
+
+		if chain == nil || !chain.ChainID.IsSameAs(eblock.Header.ChainID) {
+			if err := flush(); err != nil {
+				return err
+			}
+
+			chain = new(common.EChain)
+			chain.ChainID = eblock.Header.ChainID
+			name = nil
+			if record, _ := db.fetchChain(db.store, chain.ChainID); record != nil {
+				name = record.Name
+			}
+		}
+
+		db.addToChain(chain, eblock)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	return w.end()
+}
+
+// rebuildCBlockIndexes builds the height, public key and payment indexes of
+// the Entry Credit Blocks, and the balances after each of them in height order
+func (db *LevelDb) rebuildCBlockIndexes(w *indexWriter) error {
+	w.start("ecblock")
+
+	blocks := make([]*common.CBlock, 0)
+	err := db.forEach(TBL_CB, func(key []byte, value []byte) error {
+		block := new(common.CBlock)
+		if err := unmarshalRow(block, value); err != nil {
+			return err
+		}
+		block.CBHash = &common.Hash{Bytes: key[1:]}
+		blocks = append(blocks, block)
+
+		var numKey []byte = []byte{byte(TBL_CB_NUM)}
+		numKey = append(numKey, heightToKey(uint64(block.Header.DBHeight))...)
+		if err := w.put(numKey, key[1:]); err != nil {
+			return err
+		}
+
+		minutes := block.Minutes()
+		for i, entry := range block.CBEntries {
+			pubKey := entry.PublicKey()
+			if pubKey == nil {
+				continue
+			}
+
+			info := &common.CBEntryInfo{
+				CBHash:   block.CBHash,
+				DBHeight: uint32(block.Header.DBHeight),
+				Minute:   minutes[i],
+				Entry:    entry,
+			}
+			binaryInfo, err := info.MarshalBinary()
+			if err != nil {
+				return err
+			}
+			if err := w.put(pubKeyEntryToKey(pubKey, block.Header.DBHeight, i), binaryInfo); err != nil {
+				return err
+			}
+			if entryHash := common.PaymentEntryHash(entry); entryHash != nil {
+				if err := w.put(paymentKey(entryHash), binaryInfo); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Sort(byDBHeight(blocks))
+	tree := common.NewECBalanceTree(nil)
+	for _, block := range blocks {
+		changed, err := block.Balances(tree.Balance)
+		if err != nil {
+			return err
+		}
+		tree.Update(changed)
+
+		var mrKey []byte = []byte{byte(TBL_EC_BALANCE_MR)}
+		mrKey = append(mrKey, heightToKey(uint64(block.Header.DBHeight))...)
+		if err := w.put(mrKey, tree.Root().Bytes); err != nil {
+			return err
+		}
+	}
+
+	for _, b := range tree.Balances() {
+		var balanceKey []byte = []byte{byte(TBL_EC_BALANCE)}
+		balanceKey = append(balanceKey, b.PublicKey.Bytes...)
+		balance := make([]byte, 4)
+		binary.BigEndian.PutUint32(balance, uint32(int32(b.Credits)))
+		if err := w.put(balanceKey, balance); err != nil {
+			return err
+		}
+	}
+
+	return w.end()
+}
+
+// forEach calls f with every row of a table. The key and value are copies.
+func (db *LevelDb) forEach(table uint8, f func(key []byte, value []byte) error) error {
+	var fromkey []byte = []byte{byte(table)}   // Table Name (1 bytes)
+	var tokey []byte = []byte{byte(table + 1)} // Table Name (1 bytes)
+
+	iter := db.store.NewIterator(&kv.Range{Start: fromkey, Limit: tokey})
+	defer iter.Release()
+
+	for iter.Next() {
+		key := make([]byte, len(iter.Key()))
+		copy(key, iter.Key())
+		value := make([]byte, len(iter.Value()))
+		copy(value, iter.Value())
+
+		if err := f(key, value); err != nil {
+			return err
+		}
+	}
+	return iter.Error()
+}
+
+// unmarshalRow decodes a block read in a rebuild, turning a panic on a
+// damaged row into an error
+func unmarshalRow(obj common.BinaryMarshallable, data []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Bad row in the database: %v", r)
+		}
+	}()
+
+	return obj.UnmarshalBinary(data)
+}
+
+// byDBHeight sorts Entry Credit Blocks by height
+type byDBHeight []*common.CBlock
+
+func (b byDBHeight) Len() int           { return len(b) }
+func (b byDBHeight) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byDBHeight) Less(i, j int) bool { return b[i].Header.DBHeight < b[j].Header.DBHeight }
+
+func (w *indexWriter) start(table string) {
+	w.table = table
+	w.done = 0
+}
+
+func (w *indexWriter) put(key []byte, value []byte) error {
+	w.written[string(key)] = true
+	w.batch.Put(key, value)
+	return w.row()
+}
+
+func (w *indexWriter) delete(key []byte) error {
+	w.batch.Delete(key)
+	return w.row()
+}
+
+func (w *indexWriter) row() error {
+	w.done++
+	if w.batch.Len() >= dbMaxTransCnt || w.batch.Size() >= dbMaxTransMem {
+		if err := w.flush(); err != nil {
+			return err
+		}
+	}
+	if w.progress != nil && w.done%progressInterval == 0 {
+		w.progress(w.table, w.done)
+	}
+	return nil
+}
+
+// end writes the rows left of the table and reports on it
+func (w *indexWriter) end() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	if w.progress != nil {
+		w.progress(w.table, w.done)
+	}
+	return nil
+}
+
+func (w *indexWriter) flush() error {
+	if w.batch.Len() == 0 {
+		return nil
+	}
+
+	err := w.db.store.Write(w.batch)
+	if err != nil {
+		log.Printf("batch failed %v\n", err)
+		return err
+	}
+	w.batch.Reset()
+	return nil
+}
@@ -0,0 +1,95 @@
+package ldb
+
+import (
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/kv"
+)
+
+// tableNames are the names of the tables in the stats
+var tableNames = []struct {
+	table uint8
+	name  string
+}{
+	{TBL_ENTRY, "entry"},
+	{TBL_ENTRY_INFO, "entry_info"},
+	{TBL_EB, "eblock"},
+	{TBL_EB_INFO, "eblock_info"},
+	{TBL_EB_CHAIN_NUM, "eblock_chain_num"},
+	{TBL_EB_MR, "eblock_mr"},
+	{TBL_DB, "dblock"},
+	{TBL_DB_NUM, "dblock_num"},
+	{TBL_DB_INFO, "dblock_info"},
+	{TBL_CHAIN_HASH, "chain_hash"},
+	{TBL_CHAIN_NAME, "chain_name"},
+	{TBL_CB, "ecblock"},
+	{TBL_CB_NUM, "ecblock_num"},
+	{TBL_CB_INFO, "ecblock_info"},
+	{TBL_FB, "fblock"},
+	{TBL_FB_NUM, "fblock_num"},
+	{TBL_FB_INFO, "fblock_info"},
+	{TBL_CB_PUBKEY, "ecblock_pubkey"},
+	{TBL_EC_BALANCE, "ec_balance"},
+	{TBL_EC_BALANCE_MR, "ec_balance_mr"},
+	{TBL_COMMIT, "commit"},
+	{TBL_AB, "ablock"},
+	{TBL_AB_NUM, "ablock_num"},
+	{TBL_AB_FEES, "ablock_fees"},
+	{TBL_CB_PAYMENT, "ecblock_payment"},
+}
+
+// StorageStats counts the keys and bytes of each table in a snapshot, and
+// reports on the store, with the compactions of leveldb
+func (db *LevelDb) StorageStats() (*database.StorageStats, error) {
+	snap, err := db.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer snap.Release()
+
+	stats := new(database.StorageStats)
+	ranges := make([]kv.Range, 0, len(tableNames))
+	for _, t := range tableNames {
+		var fromkey []byte = []byte{byte(t.table)}   // Table Name (1 bytes)
+		var tokey []byte = []byte{byte(t.table + 1)} // Table Name (1 bytes)
+		ranges = append(ranges, kv.Range{Start: fromkey, Limit: tokey})
+
+		table := database.TableStats{Name: t.name}
+		iter := snap.NewIterator(&ranges[len(ranges)-1])
+		for iter.Next() {
+			table.Keys++
+			table.Bytes += int64(len(iter.Key()) + len(iter.Value()))
+		}
+		iter.Release()
+		if err := iter.Error(); err != nil {
+			return nil, err
+		}
+		stats.Tables = append(stats.Tables, table)
+	}
+
+	if sizer, ok := db.store.(kv.Sizer); ok {
+		sizes, err := sizer.SizeOf(ranges)
+		if err != nil {
+			return nil, err
+		}
+		for i, size := range sizes {
+			stats.Tables[i].DiskBytes = size
+		}
+	}
+
+	if reporter, ok := db.store.(kv.Reporter); ok {
+		stats.Engine, err = reporter.Report()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// Compact compacts the whole store, if it can be. Reads and writes go on while
+// it runs.
+func (db *LevelDb) Compact() error {
+	if compacter, ok := db.store.(kv.Compacter); ok {
+		return compacter.Compact()
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package ldb
+
+import (
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/kv"
+)
+
+// ldbView is a database.DbView reading from a snapshot of the store
+type ldbView struct {
+	db   *LevelDb
+	snap kv.Snapshot
+}
+
+var _ database.DbView = (*ldbView)(nil)
+
+// Snapshot returns a view of the database as it is now
+func (db *LevelDb) Snapshot() (database.DbView, error) {
+	snap, err := db.store.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &ldbView{db: db, snap: snap}, nil
+}
+
+func (v *ldbView) FetchDBlockByHeight(dBlockHeight uint64) (*common.DirectoryBlock, error) {
+	return v.db.fetchDBlockByHeight(v.snap, dBlockHeight)
+}
+
+func (v *ldbView) FetchDBlockHead() (*common.DirectoryBlock, error) {
+	return v.db.fetchDBlockHead(v.snap)
+}
+
+func (v *ldbView) FetchCBlockByHash(cBlockHash *common.Hash) (*common.CBlock, error) {
+	return v.db.fetchCBlockByHash(v.snap, cBlockHash)
+}
+
+func (v *ldbView) FetchCBlockByHeight(cBlockHeight uint64) (*common.CBlock, error) {
+	return v.db.fetchCBlockByHeight(v.snap, cBlockHeight)
+}
+
+func (v *ldbView) FetchEBlockByMR(eBMR *common.Hash) (*common.EBlock, error) {
+	return v.db.fetchEBlockByMR(v.snap, eBMR)
+}
+
+func (v *ldbView) FetchEBlockByHeight(chainID *common.Hash, eBlockHeight uint64) (*common.EBlock, error) {
+	return v.db.fetchEBlockByHeight(v.snap, chainID, eBlockHeight)
+}
+
+func (v *ldbView) FetchEBlockHead(chainID *common.Hash) (*common.EBlock, error) {
+	return v.db.fetchEBlockHead(v.snap, chainID)
+}
+
+func (v *ldbView) FetchEntryByHash(entrySha *common.Hash) (*common.Entry, error) {
+	return v.db.fetchEntry(v.snap, entrySha)
+}
+
+func (v *ldbView) FetchChainByHash(chainID *common.Hash) (*common.EChain, error) {
+	return v.db.fetchChain(v.snap, chainID)
+}
+
+// Release frees the snapshot
+func (v *ldbView) Release() {
+	v.snap.Release()
+}
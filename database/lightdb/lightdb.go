@@ -0,0 +1,441 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package lightdb is the database of a light node. It keeps the headers of
+// the Directory Blocks, the Admin Blocks and the DBInfo anchors in a local
+// database, and fetches the bodies of the Directory Blocks, Entry Blocks and
+// entries from a full node when they are asked for. Nothing fetched is served
+// before it has been checked against the hashes of the local headers.
+package lightdb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// ErrNotInLightMode is returned for the queries a light node cannot answer
+// without the blocks of a full node
+var ErrNotInLightMode = errors.New("Not available on a light node")
+
+// DefaultTimeout is the time given to the full node to answer a request
+const DefaultTimeout = 30 * time.Second
+
+// Source is the full node that Entry Blocks and entries are fetched from. A
+// *factomclient.Client is a Source.
+type Source interface {
+	// EBlock returns the Entry Block with the key merkle root mr
+	EBlock(ctx context.Context, mr *common.Hash) (*common.EBlock, error)
+
+	// Entry returns the entry with the hash hash
+	Entry(ctx context.Context, hash *common.Hash) (*common.Entry, error)
+
+	// RawData returns the binary form of a block or entry, nil if the full
+	// node does not have it. See factomapi.GetRawData.
+	RawData(ctx context.Context, kind string, key string) ([]byte, error)
+}
+
+// LightDb is a database.Db that stores only what a light node needs. The
+// blocks and entries it does not keep are dropped when they are inserted.
+type LightDb struct {
+	database.Db
+
+	source Source
+
+	// Timeout is the time given to the full node to answer a request
+	Timeout time.Duration
+}
+
+var _ database.Db = (*LightDb)(nil)
+
+// NewLightDb returns a LightDb keeping its blocks in local and fetching the
+// others from source
+func NewLightDb(local database.Db, source Source) *LightDb {
+	return &LightDb{
+		Db:      local,
+		source:  source,
+		Timeout: DefaultTimeout,
+	}
+}
+
+// ProcessDBlockBatch stores the header of a Directory Block, with the DBHash
+// and KeyMR of the whole block, and the Admin Block it lists. The Admin Block
+// is fetched from the full node unless it has been stored already.
+func (db *LightDb) ProcessDBlockBatch(dblock *common.DirectoryBlock) error {
+	if dblock == nil {
+		return nil
+	}
+
+	data, err := dblock.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if dblock.DBHash == nil {
+		dblock.DBHash = common.Sha(data)
+	}
+	bodyMR, err := dblock.BuildBodyMR()
+	if err != nil {
+		return err
+	}
+	if !bodyMR.IsSameAs(dblock.Header.BodyMR) {
+		return fmt.Errorf("DBlock %d does not match its BodyMR", dblock.Header.BlockHeight)
+	}
+	dblock.BuildKeyMerkleRoot()
+
+	for _, dbEntry := range dblock.DBEntries {
+		if bytes.Equal(dbEntry.ChainID.Bytes, common.ADMIN_CHAINID) {
+			if err := db.storeABlock(dbEntry.MerkleRoot, dblock.Header.BlockHeight); err != nil {
+				return err
+			}
+		}
+	}
+
+	header := &common.DirectoryBlock{
+		Header: dblock.Header,
+		DBHash: dblock.DBHash,
+		KeyMR:  dblock.KeyMR,
+	}
+	return db.Db.ProcessDBlockBatch(header)
+}
+
+// storeABlock fetches the Admin Block with the hash hash from the full node
+// and stores it, unless it is stored already
+func (db *LightDb) storeABlock(hash *common.Hash, height uint32) error {
+	if b, err := db.Db.FetchABlockByHash(hash); err == nil && b != nil {
+		return nil
+	}
+
+	ctx, cancel := db.context()
+	defer cancel()
+
+	data, err := db.source.RawData(ctx, "ablock", hash.String())
+	if err != nil {
+		return err
+	}
+	if data == nil || !common.Sha(data).IsSameAs(hash) {
+		return fmt.Errorf("Full node returned no ABlock for %s", hash.String())
+	}
+
+	block := new(common.AdminBlock)
+	if err := block.UnmarshalBinary(data); err != nil {
+		return err
+	}
+	if block.DBHeight != height {
+		return fmt.Errorf("ABlock %s is not at height %d", hash.String(), height)
+	}
+	block.ABHash = hash
+
+	return db.Db.ProcessABlockBatch(block)
+}
+
+// FetchDBlockByHash returns a Directory Block with its body fetched from the
+// full node
+func (db *LightDb) FetchDBlockByHash(dBlockHash *common.Hash) (*common.DirectoryBlock, error) {
+	dBlock, err := db.Db.FetchDBlockByHash(dBlockHash)
+	if err != nil || dBlock == nil {
+		return nil, err
+	}
+	dBlock.DBHash = dBlockHash
+
+	return db.fillDBlock(dBlock)
+}
+
+// FetchDBlockByHeight returns a Directory Block with its body fetched from the
+// full node
+func (db *LightDb) FetchDBlockByHeight(dBlockHeight uint64) (*common.DirectoryBlock, error) {
+	dBlock, err := db.Db.FetchDBlockByHeight(dBlockHeight)
+	if err != nil || dBlock == nil {
+		return nil, err
+	}
+
+	return db.fillDBlock(dBlock)
+}
+
+// FetchAllDBlocks returns the headers of the Directory Blocks. FetchDBlockHead
+// returns just the header as well, which is all that is needed to link the
+// next block to it.
+func (db *LightDb) FetchAllDBlocks() ([]common.DirectoryBlock, error) {
+	head, err := db.Db.FetchDBlockHead()
+	if err != nil || head == nil {
+		return nil, err
+	}
+
+	dBlocks := make([]common.DirectoryBlock, 0, head.Header.BlockHeight+1)
+	for h := uint64(0); h <= uint64(head.Header.BlockHeight); h++ {
+		dBlock, err := db.Db.FetchDBlockByHeight(h)
+		if err != nil {
+			return nil, err
+		}
+		dBlocks = append(dBlocks, *dBlock)
+	}
+	return dBlocks, nil
+}
+
+// fillDBlock fetches the body of a Directory Block whose header is stored
+// locally, and checks that the whole block has the DBHash of the header.
+// Blocks stored whole are returned as they are.
+func (db *LightDb) fillDBlock(dBlock *common.DirectoryBlock) (*common.DirectoryBlock, error) {
+	if len(dBlock.DBEntries) > 0 {
+		return dBlock, nil
+	}
+
+	ctx, cancel := db.context()
+	defer cancel()
+
+	height := dBlock.Header.BlockHeight
+	data, err := db.source.RawData(ctx, "dblockbyheight", strconv.FormatUint(uint64(height), 10))
+	if err != nil {
+		return nil, err
+	}
+	if data == nil || !common.Sha(data).IsSameAs(dBlock.DBHash) {
+		return nil, fmt.Errorf("Full node returned a different DBlock %d", height)
+	}
+
+	block := new(common.DirectoryBlock)
+	if err := block.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+	block.DBHash = dBlock.DBHash
+	block.BuildKeyMerkleRoot()
+	return block, nil
+}
+
+// InsertEntry drops the entry, it is fetched from the full node when needed
+func (db *LightDb) InsertEntry(entrySha *common.Hash, binaryEntry *[]byte, entry *common.Entry, chainID *[]byte) error {
+	return nil
+}
+
+// ProcessEBlockBatch drops the Entry Block, it is fetched from the full node
+// when needed
+func (db *LightDb) ProcessEBlockBatch(eblock *common.EBlock) error {
+	return nil
+}
+
+// InsertChain drops the chain, chains are not kept on a light node
+func (db *LightDb) InsertChain(chain *common.EChain) error {
+	return nil
+}
+
+// ProcessCBlockBatch drops the Entry Credit Block, balances are not kept on a
+// light node
+func (db *LightDb) ProcessCBlockBatch(block *common.CBlock) error {
+	return nil
+}
+
+// FetchEBlockByMR fetches an Entry Block from the full node and checks that
+// it is in a local Directory Block.
+func (db *LightDb) FetchEBlockByMR(eBMR *common.Hash) (*common.EBlock, error) {
+	ctx, cancel := db.context()
+	defer cancel()
+
+	eBlock, err := db.source.EBlock(ctx, eBMR)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.verifyEBlock(eBMR, eBlock); err != nil {
+		return nil, err
+	}
+	return eBlock, nil
+}
+
+// FetchEntryByHash fetches an entry from the full node and checks that it has
+// the hash asked for. An entry reached through an Entry Block from
+// FetchEBlockByMR is thereby part of the block chain.
+func (db *LightDb) FetchEntryByHash(entrySha *common.Hash) (*common.Entry, error) {
+	ctx, cancel := db.context()
+	defer cancel()
+
+	entry, err := db.source.Entry(ctx, entrySha)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil || entry.ChainID == nil {
+		return nil, fmt.Errorf("Full node returned no entry for %s", entrySha.String())
+	}
+
+	data, err := entry.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	if !common.Sha(data).IsSameAs(entrySha) {
+		return nil, fmt.Errorf("Full node returned a different entry for %s", entrySha.String())
+	}
+	return entry, nil
+}
+
+// verifyEBlock checks that the body of an Entry Block matches its header, that
+// the block has the key merkle root mr, and that the Directory Block at the
+// height in its header lists mr for its chain.
+func (db *LightDb) verifyEBlock(mr *common.Hash, eBlock *common.EBlock) error {
+	if eBlock == nil || eBlock.Header == nil || len(eBlock.EBEntries) == 0 {
+		return fmt.Errorf("Full node returned no EBlock for %s", mr.String())
+	}
+	h := eBlock.Header
+	if h.ChainID == nil || h.BodyMR == nil || h.PrevKeyMR == nil || h.PrevHash == nil {
+		return fmt.Errorf("Full node returned EBlock %s without its header hashes", mr.String())
+	}
+
+	hashes := make([]*common.Hash, len(eBlock.EBEntries))
+	for i, e := range eBlock.EBEntries {
+		if e == nil || e.EntryHash == nil {
+			return fmt.Errorf("Full node returned EBlock %s with an empty entry", mr.String())
+		}
+		hashes[i] = e.EntryHash
+	}
+	merkle := common.BuildMerkleTreeStore(hashes)
+	if !merkle[len(merkle)-1].IsSameAs(eBlock.Header.BodyMR) {
+		return fmt.Errorf("EBlock %s does not match its BodyMR", mr.String())
+	}
+
+	eBlock.BuildMerkleRoot()
+	if !eBlock.MerkleRoot.IsSameAs(mr) {
+		return fmt.Errorf("Full node returned EBlock %s for %s",
+			eBlock.MerkleRoot.String(), mr.String())
+	}
+
+	dBlock, err := db.FetchDBlockByHeight(uint64(eBlock.Header.DBHeight))
+	if err != nil {
+		return err
+	}
+	if dBlock == nil {
+		return fmt.Errorf("EBlock %s is after the last DBlock", mr.String())
+	}
+	for _, dbEntry := range dBlock.DBEntries {
+		if dbEntry.ChainID.IsSameAs(eBlock.Header.ChainID) && dbEntry.MerkleRoot.IsSameAs(mr) {
+			return nil
+		}
+	}
+	return fmt.Errorf("EBlock %s is not in DBlock %d", mr.String(), eBlock.Header.DBHeight)
+}
+
+// Snapshot returns a view of the local database that fetches Entry Blocks and
+// entries from the full node, as the LightDb does
+func (db *LightDb) Snapshot() (database.DbView, error) {
+	view, err := db.Db.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &lightView{DbView: view, light: db}, nil
+}
+
+// lightView is the view of a LightDb. What is fetched from the full node is
+// checked against the local Directory Blocks, which do not change.
+type lightView struct {
+	database.DbView
+	light *LightDb
+}
+
+func (v *lightView) FetchEBlockByMR(eBMR *common.Hash) (*common.EBlock, error) {
+	return v.light.FetchEBlockByMR(eBMR)
+}
+
+func (v *lightView) FetchEntryByHash(entrySha *common.Hash) (*common.Entry, error) {
+	return v.light.FetchEntryByHash(entrySha)
+}
+
+func (v *lightView) FetchDBlockByHeight(dBlockHeight uint64) (*common.DirectoryBlock, error) {
+	return v.light.FetchDBlockByHeight(dBlockHeight)
+}
+
+func (v *lightView) FetchEBlockByHeight(chainID *common.Hash, eBlockHeight uint64) (*common.EBlock, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (v *lightView) FetchEBlockHead(chainID *common.Hash) (*common.EBlock, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (v *lightView) FetchChainByHash(chainID *common.Hash) (*common.EChain, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (v *lightView) FetchCBlockByHash(cBlockHash *common.Hash) (*common.CBlock, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (v *lightView) FetchCBlockByHeight(cBlockHeight uint64) (*common.CBlock, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) context() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), db.Timeout)
+}
+
+// The Entry Block indexes, chains and Entry Credit blocks are not kept on a
+// light node.
+
+func (db *LightDb) FetchEBlockByHash(eBlockHash *common.Hash) (*common.EBlock, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) FetchEBlockByHeight(chainID *common.Hash, eBlockHeight uint64) (*common.EBlock, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) FetchEBlockHead(chainID *common.Hash) (*common.EBlock, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) FetchEBHashByMR(eBMR *common.Hash) (*common.Hash, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) FetchEBInfoByHash(ebHash *common.Hash) (*common.EBInfo, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) FetchAllEBlocksByChain(chainID *common.Hash) (*[]common.EBlock, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) FetchAllEBInfosByChain(chainID *common.Hash) (*[]common.EBInfo, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) FetchChainByHash(chainID *common.Hash) (*common.EChain, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) FetchChainByName(chainName [][]byte) (*common.EChain, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) FetchAllChains() ([]*common.EChain, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) FetchCBlockByHash(cBlockHash *common.Hash) (*common.CBlock, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) FetchCBlockByHeight(cBlockHeight uint64) (*common.CBlock, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) FetchAllCBlocks() ([]common.CBlock, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) FetchCBEntriesByPubKey(pubKey *common.Hash) ([]*common.CBEntryInfo, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) FetchECBalance(pubKey *common.Hash) (int, error) {
+	return 0, ErrNotInLightMode
+}
+
+func (db *LightDb) FetchECBalanceProof(pubKey *common.Hash) (*common.ECBalanceProof, error) {
+	return nil, ErrNotInLightMode
+}
+
+func (db *LightDb) InitializeExternalIDMap() (map[string]bool, error) {
+	return nil, ErrNotInLightMode
+}
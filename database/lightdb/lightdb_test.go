@@ -0,0 +1,202 @@
+package lightdb
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/dbgen"
+	"github.com/FactomProject/FactomCode/database/ldb"
+)
+
+// fullNode serves the blocks and entries it has been given
+type fullNode struct {
+	eBlocks map[string]*common.EBlock
+	entries map[string]*common.Entry
+	raw     map[string][]byte
+}
+
+func (n *fullNode) EBlock(ctx context.Context, mr *common.Hash) (*common.EBlock, error) {
+	if b, ok := n.eBlocks[mr.String()]; ok {
+		return b, nil
+	}
+	return nil, fmt.Errorf("no EBlock %s", mr.String())
+}
+
+func (n *fullNode) Entry(ctx context.Context, hash *common.Hash) (*common.Entry, error) {
+	if e, ok := n.entries[hash.String()]; ok {
+		return e, nil
+	}
+	return nil, fmt.Errorf("no entry %s", hash.String())
+}
+
+func (n *fullNode) RawData(ctx context.Context, kind string, key string) ([]byte, error) {
+	return n.raw[kind+"/"+key], nil
+}
+
+// localDb holds the Directory Blocks of the light node
+type localDb struct {
+	database.Db
+	dBlocks map[uint64]*common.DirectoryBlock
+}
+
+func (db *localDb) FetchDBlockByHeight(height uint64) (*common.DirectoryBlock, error) {
+	if b, ok := db.dBlocks[height]; ok {
+		return b, nil
+	}
+	return nil, fmt.Errorf("DBlock not found for height: %d", height)
+}
+
+func TestLightDbVerifies(t *testing.T) {
+	chainID := common.Sha([]byte("chain"))
+	entry := &common.Entry{ChainID: chainID, Data: []byte("data")}
+	data, _ := entry.MarshalBinary()
+	entryHash := common.Sha(data)
+
+	eBlock := &common.EBlock{
+		Header: &common.EBlockHeader{
+			ChainID:    chainID,
+			PrevKeyMR:  common.NewHash(),
+			PrevHash:   common.NewHash(),
+			DBHeight:   3,
+			EntryCount: 1,
+		},
+		EBEntries: []*common.EBEntry{common.NewEBEntry(entryHash)},
+	}
+	merkle := common.BuildMerkleTreeStore([]*common.Hash{entryHash})
+	eBlock.Header.BodyMR = merkle[len(merkle)-1]
+	eBlock.BuildMerkleRoot()
+	mr := eBlock.MerkleRoot
+
+	node := &fullNode{
+		eBlocks: map[string]*common.EBlock{mr.String(): eBlock},
+		entries: map[string]*common.Entry{entryHash.String(): entry},
+	}
+	local := &localDb{dBlocks: map[uint64]*common.DirectoryBlock{
+		3: {DBEntries: []*common.DBEntry{{ChainID: chainID, MerkleRoot: mr}}},
+	}}
+	db := NewLightDb(local, node)
+
+	b, err := db.FetchEBlockByMR(mr)
+	if err != nil || b == nil {
+		t.Fatalf("EBlock not served: %v", err)
+	}
+	e, err := db.FetchEntryByHash(entryHash)
+	if err != nil || string(e.Data) != "data" {
+		t.Fatalf("entry not served: %v", err)
+	}
+
+	// The full node changes the entry
+	node.entries[entryHash.String()] = &common.Entry{ChainID: chainID, Data: []byte("other")}
+	if _, err := db.FetchEntryByHash(entryHash); err == nil {
+		t.Errorf("changed entry served")
+	}
+
+	// The full node changes the body of the EBlock
+	eBlock.EBEntries[0] = common.NewEBEntry(common.Sha([]byte("other")))
+	if _, err := db.FetchEBlockByMR(mr); err == nil {
+		t.Errorf("changed EBlock served")
+	}
+	eBlock.EBEntries[0] = common.NewEBEntry(entryHash)
+
+	// The EBlock is not in the Directory Block at its height
+	local.dBlocks[3].DBEntries[0].ChainID = common.Sha([]byte("other"))
+	if _, err := db.FetchEBlockByMR(mr); err == nil {
+		t.Errorf("EBlock missing from its DBlock served")
+	}
+
+	// Blocks and entries with hashes missing are refused
+	local.dBlocks[3].DBEntries[0].ChainID = chainID
+	eBlock.Header.PrevHash = nil
+	if _, err := db.FetchEBlockByMR(mr); err == nil {
+		t.Errorf("EBlock without a PrevHash served")
+	}
+	eBlock.Header.PrevHash = common.NewHash()
+	eBlock.EBEntries[0].EntryHash = nil
+	if _, err := db.FetchEBlockByMR(mr); err == nil {
+		t.Errorf("EBlock with an empty entry served")
+	}
+	node.entries[entryHash.String()] = &common.Entry{Data: []byte("data")}
+	if _, err := db.FetchEntryByHash(entryHash); err == nil {
+		t.Errorf("entry without a ChainID served")
+	}
+
+	if _, err := db.FetchChainByHash(chainID); err != ErrNotInLightMode {
+		t.Errorf("expected ErrNotInLightMode, got %v", err)
+	}
+}
+
+// TestLightDbStoresHeaders stores the blocks of a full node in a light node,
+// which keeps the headers of the Directory Blocks and the Admin Blocks
+func TestLightDbStoresHeaders(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lightdb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	local, err := ldb.OpenLevelDB(dir, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+
+	node := &fullNode{raw: make(map[string][]byte)}
+	db := NewLightDb(local, node)
+
+	g, err := dbgen.New(dbgen.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var blocks []*dbgen.Block
+	for i := 0; i < 3; i++ {
+		block, err := g.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := block.DBlock.MarshalBinary()
+		node.raw["dblockbyheight/"+strconv.Itoa(i)] = data
+		data, _ = block.ABlock.MarshalBinary()
+		node.raw["ablock/"+block.ABlock.ABHash.String()] = data
+		blocks = append(blocks, block)
+	}
+
+	for _, block := range blocks {
+		if err := db.ProcessDBlockBatch(block.DBlock); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i, block := range blocks {
+		header, err := local.FetchDBlockByHeight(uint64(i))
+		if err != nil || len(header.DBEntries) != 0 || !header.DBHash.IsSameAs(block.DBlock.DBHash) {
+			t.Errorf("DBlock %d not stored as a header: %v", i, err)
+		}
+		aBlock, err := local.FetchABlockByHash(block.ABlock.ABHash)
+		if err != nil || aBlock == nil {
+			t.Errorf("ABlock %d not stored: %v", i, err)
+		}
+
+		dBlock, err := db.FetchDBlockByHeight(uint64(i))
+		if err != nil || len(dBlock.DBEntries) != len(block.DBlock.DBEntries) ||
+			!dBlock.KeyMR.IsSameAs(block.DBlock.KeyMR) {
+			t.Errorf("DBlock %d not filled from the full node: %v", i, err)
+		}
+	}
+
+	all, err := db.FetchAllDBlocks()
+	if err != nil || len(all) != 3 || !all[2].DBHash.IsSameAs(blocks[2].DBlock.DBHash) {
+		t.Errorf("wrong Directory Block headers: %v", err)
+	}
+
+	// The full node changes a Directory Block
+	data := node.raw["dblockbyheight/1"]
+	node.raw["dblockbyheight/1"] = append(append([]byte{}, data[:len(data)-1]...), data[len(data)-1]^1)
+	if _, err := db.FetchDBlockByHeight(1); err == nil {
+		t.Errorf("changed DBlock served")
+	}
+}
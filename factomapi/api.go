@@ -5,18 +5,16 @@
 package factomapi
 
 import (
-	"bytes"
-	"encoding/binary"
 	"encoding/hex"
 	"fmt"
-	"sort"
+	"io"
 	"strings"
 	"time"
 
 	"github.com/FactomProject/FactomCode/common"
 	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/cachedb"
 	"github.com/FactomProject/FactomCode/util"
-	"github.com/FactomProject/FactomCode/wallet"
 	"github.com/FactomProject/btcd"
 	"github.com/FactomProject/btcd/wire"
 )
@@ -25,8 +23,6 @@ import (
 var (
 	serverAddr      = "localhost:8083"
 	db              database.Db
-	creditsPerChain uint32                     = 10
-	inMsgQueue      chan<- wire.FtmInternalMsg //outgoing message queue for factom application messages
 )
 
 // This method will be replaced with a Factoid transaction once we have the factoid implementation in place
@@ -81,22 +77,39 @@ func GetChainByHashStr(id string) (*common.EChain, error) {
 	return db.FetchChainByHash(hash)
 }
 
-func GetAllChains() ([]common.EChain, error) {
+func GetAllChains() ([]*common.EChain, error) {
 	return db.FetchAllChains()
 }
 
+// GetDirectoryBloks gets the Directory Blocks between two heights, inclusive,
+// from one view of the database. The range ends at the newest block.
 func GetDirectoryBloks(fromBlockHeight uint32, toBlockHeight uint32) (dBlocks []common.DirectoryBlock, err error) {
-	//needs to be improved ??
-	dBlocks, _ = db.FetchAllDBlocks()
-	sort.Sort(byBlockID(dBlocks))
+	view, err := db.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer view.Release()
 
-	if fromBlockHeight > uint32(len(dBlocks)-1) {
+	head, err := view.FetchDBlockHead()
+	if err != nil {
+		return nil, err
+	}
+	if head == nil || fromBlockHeight > head.Header.BlockHeight {
 		return nil, nil
-	} else if toBlockHeight > uint32(len(dBlocks)-1) {
-		toBlockHeight = uint32(len(dBlocks) - 1)
+	} else if toBlockHeight > head.Header.BlockHeight {
+		toBlockHeight = head.Header.BlockHeight
+	}
+
+	dBlocks = make([]common.DirectoryBlock, 0, 10)
+	for h := uint64(fromBlockHeight); h <= uint64(toBlockHeight); h++ {
+		block, err := view.FetchDBlockByHeight(h)
+		if err != nil {
+			return nil, err
+		}
+		dBlocks = append(dBlocks, *block)
 	}
 
-	return dBlocks[fromBlockHeight : toBlockHeight+1], nil
+	return dBlocks, nil
 }
 
 func GetDirectoryBlokByHashStr(addr string) (*common.DirectoryBlock, error) {
@@ -143,6 +156,23 @@ func GetEntryBlokByMRStr(addr string) (*common.EBlock, error) {
 	return db.FetchEBlockByMR(hash)
 }
 
+func GetDirectoryBlokByHeight(height uint64) (*common.DirectoryBlock, error) {
+	return db.FetchDBlockByHeight(height)
+}
+
+func GetEntryBlokByHeight(chainIDStr string, height uint64) (*common.EBlock, error) {
+	chainID, err := common.HexToHash(chainIDStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.FetchEBlockByHeight(chainID, height)
+}
+
+func GetEntryCreditBlokByHeight(height uint64) (*common.CBlock, error) {
+	return db.FetchCBlockByHeight(height)
+}
+
 func GetBlokHeight() (int, error) {
 	b := make([]common.DirectoryBlock, 0)
 	b, err := db.FetchAllDBlocks()
@@ -152,6 +182,32 @@ func GetBlokHeight() (int, error) {
 	return len(b), nil
 }
 
+// GetCacheStats reports on the block and entry cache, or returns nil if the
+// database is not cached
+func GetCacheStats() *cachedb.Stats {
+	cache, ok := db.(*cachedb.CacheDb)
+	if !ok {
+		return nil
+	}
+	stats := cache.Stats()
+	return &stats
+}
+
+// GetStorageStats counts the keys and bytes of each table of the database
+func GetStorageStats() (*database.StorageStats, error) {
+	return db.StorageStats()
+}
+
+// CompactDB compacts the database on disk
+func CompactDB() error {
+	return db.Compact()
+}
+
+// BackupDB writes a backup of the database to w while the node runs
+func BackupDB(w io.Writer) (*database.BackupInfo, error) {
+	return db.Backup(w)
+}
+
 func GetEntriesByExtID(eid string) (entries []common.Entry, err error) {
 	extIDMap, err := db.InitializeExternalIDMap()
 	if err != nil {
@@ -171,6 +227,16 @@ func GetEntriesByExtID(eid string) (entries []common.Entry, err error) {
 	return entries, err
 }
 
+// SubscribeEvents returns a subscription to the database events, buffering up
+// to size of them
+func SubscribeEvents(size int) *database.Subscription {
+	return db.SubscribeChan(size)
+}
+
+func UnsubscribeEvents(s *database.Subscription) {
+	db.Unsubscribe(s)
+}
+
 func GetEntryByHashStr(addr string) (*common.Entry, error) {
 	hash := new(common.Hash)
 	a, err := hex.DecodeString(addr)
@@ -215,27 +281,9 @@ func SetDB(database database.Db) error {
 
 	return nil
 }
-func SetInMsgQueue(inMsgQ chan<- wire.FtmInternalMsg) error {
-	inMsgQueue = inMsgQ
-
-	return nil
-}
 
 //-=-----------------------------------------
 
-// array sorting implementation
-type byBlockID []common.DirectoryBlock
-
-func (f byBlockID) Len() int {
-	return len(f)
-}
-func (f byBlockID) Less(i, j int) bool {
-	return f[i].Header.BlockHeight < f[j].Header.BlockHeight
-}
-func (f byBlockID) Swap(i, j int) {
-	f[i], f[j] = f[j], f[i]
-}
-
 // array sorting implementation
 type byEBlockID []common.EBlock
 
@@ -333,40 +381,25 @@ func RevealEntry(e *Entry) error {
 // hashes to be used to verify the later RevealChain.
 func CommitChain(c *common.EChain) error {
 	util.Trace()
-	var buf bytes.Buffer
-
-	// Calculate the required credits
-	bChain, _ := c.MarshalBinary()
-	credits := uint32(binary.Size(bChain)/1000+1) + creditsPerChain
 
 	binaryEntry, _ := c.FirstEntry.MarshalBinary()
 	entryHash := common.Sha(binaryEntry)
 
-	entryChainIDHash := common.Sha(append(c.ChainID.Bytes, entryHash.Bytes...))
-
-	// Create a msg signature (timestamp + chainid + entry hash + entryChainIDHash + credits)
-	timestamp := uint64(time.Now().Unix())
-	binary.Write(&buf, binary.BigEndian, timestamp)
-	buf.Write(c.ChainID.Bytes)
-	buf.Write(entryHash.Bytes)
-	buf.Write(entryChainIDHash.Bytes)
-	binary.Write(&buf, binary.BigEndian, credits)
-	sig := wallet.SignData(buf.Bytes())
+	// Calculate the required credits
+	commit := new(common.CommitChain)
+	commit.Timestamp = uint64(time.Now().Unix())
+	commit.ChainID = c.ChainID
+	commit.EntryHash = entryHash
+	commit.EntryChainIDHash = common.GetEntryChainIDHash(c.ChainID, entryHash)
+	commit.Credits = common.ChainCredits(len(binaryEntry))
+
+	// Sign the commit (timestamp + chainid + entry hash + entryChainIDHash + credits)
+	if err := commit.Sign(walletSigner{}); err != nil {
+		return err
+	}
 
 	//Construct a msg and add it to the msg queue
-	msgCommitChain := wire.NewMsgCommitChain()
-	msgCommitChain.ChainID = c.ChainID
-	msgCommitChain.Credits = credits
-	msgCommitChain.ECPubKey = new(common.Hash)
-	msgCommitChain.ECPubKey.Bytes = (*sig.Pub.Key)[:]
-	msgCommitChain.EntryChainIDHash = entryChainIDHash
-	msgCommitChain.EntryHash = entryHash
-	msgCommitChain.Sig = (*sig.Sig)[:]
-	msgCommitChain.Timestamp = timestamp
-
-	inMsgQueue <- msgCommitChain
-
-	return nil
+	return submit(newMsgCommitChain(commit))
 }
 
 // RevealChain sends a message to the factom network containing the binary
@@ -378,9 +411,7 @@ func RevealChain(c *common.EChain) error {
 	msgRevealChain := wire.NewMsgRevealChain()
 	msgRevealChain.Chain = c
 
-	inMsgQueue <- msgRevealChain
-
-	return nil
+	return submit(msgRevealChain)
 }
 
 // PrintEntry is a helper function for debugging entry transport and encoding
@@ -425,34 +456,22 @@ func NewChain(name []string, eids []string, data []byte) (c *Chain, err error) {
 // entry to be used to verify the later RevealEntry.
 func CommitEntry(e *common.Entry) error {
 	util.Trace()
-	var buf bytes.Buffer
 
 	bEntry, _ := e.MarshalBinary()
-	entryHash := common.Sha(bEntry)
+
 	// Calculate the required credits
-	credits := uint32(binary.Size(bEntry)/1000 + 1)
+	commit := new(common.CommitEntry)
+	commit.Timestamp = uint64(time.Now().Unix())
+	commit.EntryHash = common.Sha(bEntry)
+	commit.Credits = common.EntryCredits(len(bEntry))
 
-	// Create a msg signature (timestamp + entry hash + credits)
-	timestamp := uint64(time.Now().Unix())
-	binary.Write(&buf, binary.BigEndian, timestamp)
-	buf.Write(entryHash.Bytes)
-	binary.Write(&buf, binary.BigEndian, credits)
-	sig := wallet.SignData(buf.Bytes())
+	// Sign the commit (timestamp + entry hash + credits)
+	if err := commit.Sign(walletSigner{}); err != nil {
+		return err
+	}
 
 	//Construct a msg and add it to the msg queue
-	msgCommitEntry := wire.NewMsgCommitEntry()
-	msgCommitEntry.Credits = credits
-	msgCommitEntry.ECPubKey = new(common.Hash)
-	msgCommitEntry.ECPubKey.Bytes = (*sig.Pub.Key)[:]
-	msgCommitEntry.EntryHash = entryHash
-	msgCommitEntry.Sig = (*sig.Sig)[:]
-	msgCommitEntry.Timestamp = timestamp
-
-	util.Trace()
-	inMsgQueue <- msgCommitEntry
-	util.Trace()
-
-	return nil
+	return submit(newMsgCommitEntry(commit))
 }
 
 // RevealEntry sends a message to the factom network containing the binary
@@ -464,14 +483,10 @@ func RevealEntry(e *common.Entry) error {
 	msgRevealEntry := wire.NewMsgRevealEntry()
 	msgRevealEntry.Entry = e
 
-	inMsgQueue <- msgRevealEntry
-
-	return nil
+	return submit(msgRevealEntry)
 }
 
 func SubmitFactoidTx(m wire.Message) error {
 
-	inMsgQueue <- m
-
-	return nil
+	return submit(m)
 }
@@ -0,0 +1,349 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factomapi
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/wallet"
+	"github.com/FactomProject/btcd/wire"
+)
+
+// Size of the fixed Entry header: Version, ChainID, ExIDSize and PayloadSize
+const entryHeaderSize = 37
+
+// Size of the largest allowed entry, header included
+const maxEntrySize = entryHeaderSize + int(common.MAX_ENTRY_SIZE)
+
+// Commits accepted through the api are remembered this long so the credits
+// can be checked against the size of the entry when it is revealed.
+const pendingCommitLifetime = time.Hour
+
+// Seen commits are pruned from the database at most this often
+const commitPruneInterval = 10 * time.Minute
+
+// pendingCommit is a commit accepted through the api and waiting for its
+// reveal. The payment is kept as the entry credit block entry the commit
+// turns into.
+type pendingCommit struct {
+	payment  common.CBEntry
+	received time.Time
+}
+
+var (
+	pendingCommits     = make(map[common.HashF]*pendingCommit)
+	pendingCommitsLock sync.Mutex
+
+	lastPrune     time.Time
+	lastPruneLock sync.Mutex
+)
+
+// walletSigner signs with the key of the node's own wallet
+type walletSigner struct{}
+
+func (walletSigner) Sign(msg []byte) common.Signature {
+	return wallet.SignData(msg)
+}
+
+// SubmitCommitEntry checks the signature, timestamp and credits of a client
+// built entry commit, and the balance paying for it, makes sure it is not a
+// replay, and queues it.
+func SubmitCommitEntry(c *common.CommitEntry) error {
+	if err := c.Validate(time.Now(), common.GetCommitWindow()); err != nil {
+		return err
+	}
+	min, max := common.EntryCredits(0), common.EntryCredits(maxEntrySize)
+	if c.Credits < min || c.Credits > max {
+		return fmt.Errorf("Entry commit pays %d credits, it has to be between %d and %d",
+			c.Credits, min, max)
+	}
+	if err := checkBalance(c.ECPubKey, c.Credits); err != nil {
+		return err
+	}
+
+	// The commit is journaled before it is recorded, so that nothing is
+	// recorded for a commit that fails to be queued
+	q, err := getSubmitQueue()
+	if err != nil {
+		return err
+	}
+	if err := q.reserve(); err != nil {
+		return err
+	}
+	m, err := q.journal(newMsgCommitEntry(c))
+	if err != nil {
+		return err
+	}
+	if err := checkReplay(c.EntryHash, c.Timestamp); err != nil {
+		q.discard(m)
+		return err
+	}
+
+	addPendingCommit(c.EntryHash, common.NewPayEntryCBEntry(c.ECPubKey, c.EntryHash,
+		int(c.Credits), int64(c.Timestamp), c.Sig))
+	q.queue(m)
+
+	return nil
+}
+
+// SubmitCommitChain checks the signature, timestamp, the entry/chain binding
+// and the credits of a client built chain commit, and the balance paying for
+// it, makes sure it is not a replay, and queues it.
+func SubmitCommitChain(c *common.CommitChain) error {
+	if err := c.Validate(time.Now(), common.GetCommitWindow()); err != nil {
+		return err
+	}
+	min, max := common.ChainCredits(0), common.ChainCredits(maxEntrySize)
+	if c.Credits < min || c.Credits > max {
+		return fmt.Errorf("Chain commit pays %d credits, it has to be between %d and %d",
+			c.Credits, min, max)
+	}
+	if err := checkBalance(c.ECPubKey, c.Credits); err != nil {
+		return err
+	}
+
+	// The commit is journaled before it is recorded, so that nothing is
+	// recorded for a commit that fails to be queued
+	q, err := getSubmitQueue()
+	if err != nil {
+		return err
+	}
+	if err := q.reserve(); err != nil {
+		return err
+	}
+	m, err := q.journal(newMsgCommitChain(c))
+	if err != nil {
+		return err
+	}
+	if err := checkReplay(c.EntryHash, c.Timestamp); err != nil {
+		q.discard(m)
+		return err
+	}
+
+	addPendingCommit(c.EntryHash, common.NewPayChainCBEntry(c.ECPubKey, c.EntryHash,
+		int(c.Credits), c.ChainID, c.EntryChainIDHash, c.Sig))
+	q.queue(m)
+
+	return nil
+}
+
+// SubmitRevealEntry queues an entry for a previous commit. If the commit came
+// in through this api, the credits it paid are checked against the entry.
+func SubmitRevealEntry(e *common.Entry) error {
+	if e.ChainID == nil {
+		return errors.New("Entry has no ChainID")
+	}
+	bEntry, err := e.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	if err := checkPendingCommit(common.Sha(bEntry), len(bEntry), false); err != nil {
+		return err
+	}
+
+	return RevealEntry(e)
+}
+
+// SubmitRevealChain queues the first entry of a new chain for a previous
+// chain commit. The chain name is taken from the External IDs of the entry,
+// and has to hash to its ChainID.
+func SubmitRevealChain(e *common.Entry) error {
+	if e.ChainID == nil {
+		return errors.New("Entry has no ChainID")
+	}
+	chainID, err := common.GetChainID(e.ExtIDs)
+	if err != nil {
+		return err
+	}
+	if !chainID.IsSameAs(e.ChainID) {
+		return errors.New("The External IDs of the first entry do not hash to its ChainID")
+	}
+
+	bEntry, err := e.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	if err := checkPendingCommit(common.Sha(bEntry), len(bEntry), true); err != nil {
+		return err
+	}
+
+	c := new(common.EChain)
+	c.ChainID = e.ChainID
+	c.Name = e.ExtIDs
+	c.FirstEntry = e
+
+	return RevealChain(c)
+}
+
+// checkBalance makes sure the Entry Credit balance of a public key covers the
+// credits a commit pays, on top of the commits of the key waiting for their
+// reveal. It is only a check ahead of the processor's: the commits revealed
+// but not yet in an Entry Credit Block are not counted, nor are the commits
+// checked at the same time.
+func checkBalance(pubKey *common.Hash, credits uint32) error {
+	balance, err := db.FetchECBalance(pubKey)
+	if err != nil {
+		return err
+	}
+	pending := pendingCredits(pubKey)
+	if balance-pending < int(credits) {
+		return fmt.Errorf("Commit pays %d credits, the balance of %s is %d with %d committed already",
+			credits, pubKey.String(), balance, pending)
+	}
+	return nil
+}
+
+// pendingCredits returns the credits paid by the commits of a public key that
+// wait for their reveal
+func pendingCredits(pubKey *common.Hash) int {
+	pendingCommitsLock.Lock()
+	defer pendingCommitsLock.Unlock()
+
+	now := time.Now()
+	credits := 0
+	for _, c := range pendingCommits {
+		if now.Sub(c.received) > pendingCommitLifetime {
+			continue
+		}
+		if c.payment.PublicKey().IsSameAs(pubKey) {
+			credits += c.payment.Credits()
+		}
+	}
+	return credits
+}
+
+// checkReplay records a commit in the database and fails if it has been seen
+// before. Commits older than the commit window are pruned from time to time,
+// as their timestamp alone gets them rejected.
+func checkReplay(entryHash *common.Hash, timestamp uint64) error {
+	// Pruning goes first, so the commit is only recorded if nothing fails
+	lastPruneLock.Lock()
+	now := time.Now()
+	if now.Sub(lastPrune) > commitPruneInterval {
+		before := now.Add(-common.GetCommitWindow()).Unix()
+		if _, err := db.PruneCommits(uint64(before)); err != nil {
+			lastPruneLock.Unlock()
+			return err
+		}
+		lastPrune = now
+	}
+	lastPruneLock.Unlock()
+
+	inserted, err := db.InsertCommit(entryHash, timestamp)
+	if err != nil {
+		return err
+	}
+	if !inserted {
+		return errors.New("Commit has been submitted before")
+	}
+
+	return nil
+}
+
+func addPendingCommit(entryHash *common.Hash, payment common.CBEntry) {
+	pendingCommitsLock.Lock()
+	defer pendingCommitsLock.Unlock()
+
+	now := time.Now()
+	for k, v := range pendingCommits {
+		if now.Sub(v.received) > pendingCommitLifetime {
+			delete(pendingCommits, k)
+		}
+	}
+
+	var key common.HashF
+	key.From(entryHash)
+	pendingCommits[key] = &pendingCommit{
+		payment:  payment,
+		received: now,
+	}
+}
+
+// checkPendingCommit makes sure a commit for the entry that came in through
+// this api paid enough for it. Entries committed elsewhere are left to the
+// processor.
+func checkPendingCommit(entryHash *common.Hash, size int, chain bool) error {
+	pendingCommitsLock.Lock()
+	defer pendingCommitsLock.Unlock()
+
+	var key common.HashF
+	key.From(entryHash)
+	c, ok := pendingCommits[key]
+	if !ok {
+		return nil
+	}
+
+	if (c.payment.Type() == common.TYPE_PAY_CHAIN) != chain {
+		return errors.New("Entry was committed as a different type of reveal")
+	}
+	if err := common.CheckPayment(c.payment, size); err != nil {
+		return err
+	}
+
+	delete(pendingCommits, key)
+	return nil
+}
+
+func newMsgCommitEntry(c *common.CommitEntry) *wire.MsgCommitEntry {
+	msg := wire.NewMsgCommitEntry()
+	msg.Credits = c.Credits
+	msg.ECPubKey = c.ECPubKey
+	msg.EntryHash = c.EntryHash
+	msg.Sig = c.Sig
+	msg.Timestamp = c.Timestamp
+
+	return msg
+}
+
+func newMsgCommitChain(c *common.CommitChain) *wire.MsgCommitChain {
+	msg := wire.NewMsgCommitChain()
+	msg.ChainID = c.ChainID
+	msg.Credits = c.Credits
+	msg.ECPubKey = c.ECPubKey
+	msg.EntryChainIDHash = c.EntryChainIDHash
+	msg.EntryHash = c.EntryHash
+	msg.Sig = c.Sig
+	msg.Timestamp = c.Timestamp
+
+	return msg
+}
+
+// EntryCost is the price of an entry, or of a new chain with it as its first
+// entry, in the fee schedule in use
+type EntryCost struct {
+	Size            int
+	NewChain        bool
+	Credits         uint32
+	CreditsPerKB    uint32
+	CreditsPerChain uint32
+}
+
+// GetEntryCost quotes the price of an entry of size bytes, header included
+func GetEntryCost(size int, newChain bool) (*EntryCost, error) {
+	if size < entryHeaderSize || size > maxEntrySize {
+		return nil, fmt.Errorf("Entry size has to be between %d and %d bytes", entryHeaderSize, maxEntrySize)
+	}
+
+	fees := common.GetFeeSchedule()
+	cost := &EntryCost{
+		Size:            size,
+		NewChain:        newChain,
+		CreditsPerKB:    fees.CreditsPerKB,
+		CreditsPerChain: fees.CreditsPerChain,
+	}
+	if newChain {
+		cost.Credits = fees.ChainCost(size)
+	} else {
+		cost.Credits = fees.EntryCost(size)
+	}
+
+	return cost, nil
+}
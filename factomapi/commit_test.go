@@ -0,0 +1,77 @@
+package factomapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/btcd/wire"
+)
+
+// balanceDB has one balance for every public key, and records the commits
+type balanceDB struct {
+	database.Db
+	credits int
+	commits map[string]bool
+}
+
+func (d *balanceDB) FetchECBalance(pubKey *common.Hash) (int, error) {
+	return d.credits, nil
+}
+
+func (d *balanceDB) InsertCommit(entryHash *common.Hash, timestamp uint64) (bool, error) {
+	if d.commits[entryHash.String()] {
+		return false, nil
+	}
+	d.commits[entryHash.String()] = true
+	return true, nil
+}
+
+func (d *balanceDB) PruneCommits(before uint64) (int, error) {
+	return 0, nil
+}
+
+func TestCommitBalance(t *testing.T) {
+	d := &balanceDB{credits: 1, commits: make(map[string]bool)}
+	SetDB(d)
+	defer SetDB(nil)
+
+	processor := make(chan wire.FtmInternalMsg, 10)
+	if err := StartSubmitQueue(10, "", processor); err != nil {
+		t.Fatal(err)
+	}
+	defer stopSubmitQueue()
+
+	key := new(common.PrivateKey)
+	if err := key.GenerateKey(); err != nil {
+		t.Fatal(err)
+	}
+	commit := func(data string) *common.CommitEntry {
+		c := new(common.CommitEntry)
+		c.Timestamp = uint64(time.Now().Unix())
+		c.EntryHash = common.Sha([]byte(data))
+		c.Credits = common.EntryCredits(2000)
+		if err := c.Sign(key); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	if err := SubmitCommitEntry(commit("one")); err == nil {
+		t.Errorf("commit over the balance accepted")
+	}
+	if len(d.commits) != 0 || GetSubmitQueueStats().Depth != 0 {
+		t.Errorf("commit over the balance recorded")
+	}
+
+	d.credits = int(common.EntryCredits(2000))
+	if err := SubmitCommitEntry(commit("two")); err != nil {
+		t.Errorf("commit within the balance refused: %v", err)
+	}
+
+	// The balance is spent by the commit waiting for its reveal
+	if err := SubmitCommitEntry(commit("three")); err == nil {
+		t.Errorf("commit over the balance left by a pending commit accepted")
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factomapi
+
+import (
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// ECTransaction is an entry credit transaction of a public key
+type ECTransaction struct {
+	// Type is one of "buy", "payentry" or "paychain"
+	Type    string
+	Credits int
+
+	// TxHash is the Factoid transaction hash of a purchase, or the hash of
+	// the entry paid for
+	TxHash *common.Hash
+
+	// CBHash, DBHeight and Minute place the transaction in the block chain
+	CBHash   *common.Hash
+	DBHeight uint32
+	Minute   byte
+}
+
+func GetEntryCreditBlokByHashStr(addr string) (*common.CBlock, error) {
+	hash, err := common.HexToHash(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.FetchCBlockByHash(hash)
+}
+
+// GetEntryCreditBloks gets the entry credit blocks between two Directory
+// Block heights, inclusive, from one view of the database. The listing stops
+// at the first missing block.
+func GetEntryCreditBloks(fromBlockHeight uint32, toBlockHeight uint32) (cBlocks []*common.CBlock, err error) {
+	view, err := db.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer view.Release()
+
+	cBlocks = make([]*common.CBlock, 0, 10)
+	for h := uint64(fromBlockHeight); h <= uint64(toBlockHeight); h++ {
+		block, err := view.FetchCBlockByHeight(h)
+		if err != nil {
+			return nil, err
+		}
+		if block == nil {
+			break
+		}
+		cBlocks = append(cBlocks, block)
+	}
+
+	return cBlocks, nil
+}
+
+// GetEntryCreditHistory gets every purchase and payment of entry credits by a
+// public key, oldest first.
+func GetEntryCreditHistory(pubKeyStr string) ([]*ECTransaction, error) {
+	pubKey, err := common.HexToHash(pubKeyStr)
+	if err != nil {
+		return nil, err
+	}
+
+	infos, err := db.FetchCBEntriesByPubKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+
+	txs := make([]*ECTransaction, 0, len(infos))
+	for _, info := range infos {
+		tx := &ECTransaction{
+			Credits:  info.Entry.Credits(),
+			CBHash:   info.CBHash,
+			DBHeight: info.DBHeight,
+			Minute:   info.Minute,
+		}
+
+		switch e := info.Entry.(type) {
+		case *common.BuyCBEntry:
+			tx.Type = "buy"
+			tx.TxHash = e.FactomTxHash
+		case *common.PayEntryCBEntry:
+			tx.Type = "payentry"
+			tx.TxHash = e.EntryHash
+		case *common.PayChainCBEntry:
+			tx.Type = "paychain"
+			tx.TxHash = e.EntryHash
+		default:
+			continue
+		}
+		txs = append(txs, tx)
+	}
+
+	return txs, nil
+}
+
+// GetEntryCreditBalanceProof gets the balance of a public key with a proof
+// that can be checked with common.VerifyECBalanceProof against the BalanceMR
+// of the entry credit block at proof.DBHeight.
+func GetEntryCreditBalanceProof(pubKeyStr string) (*common.ECBalanceProof, error) {
+	pubKey, err := common.HexToHash(pubKeyStr)
+	if err != nil {
+		return nil, err
+	}
+
+	return db.FetchECBalanceProof(pubKey)
+}
@@ -0,0 +1,186 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factomapi
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+const (
+	// DefaultEntriesLimit is the page size used when none is asked for
+	DefaultEntriesLimit = 50
+
+	// MaxEntriesLimit is the largest page of entries returned at once
+	MaxEntriesLimit = 1000
+)
+
+// ChainEntriesQuery selects a page of the entries of a chain
+type ChainEntriesQuery struct {
+	// OldestFirst lists the entries in the order they were added to the
+	// chain. By default the newest entries come first.
+	OldestFirst bool
+
+	// Cursor is the NextCursor of the previous page, or empty for the first
+	// page.
+	Cursor string
+
+	// Limit is the maximum number of entries returned
+	Limit int
+
+	// FromHeight and ToHeight limit the entries to EBlocks in that range of
+	// Directory Block heights. A ToHeight of 0 means no upper limit.
+	FromHeight uint32
+	ToHeight   uint32
+}
+
+// ChainEntry is an entry together with its place in the chain
+type ChainEntry struct {
+	EntryHash *common.Hash
+	EBHeight  uint32
+	DBHeight  uint32
+
+	// Entry is nil if the entry is not in the database
+	Entry *common.Entry
+}
+
+// ChainEntries is a page of the entries of a chain
+type ChainEntries struct {
+	Entries []*ChainEntry
+
+	// NextCursor continues the listing after this page. It is empty on the
+	// last page.
+	NextCursor string
+}
+
+// GetChainEntries walks the EBlocks of a chain and returns a page of its
+// entries. End of minute markers are skipped. The page is read from one view
+// of the database.
+func GetChainEntries(chainID *common.Hash, q *ChainEntriesQuery) (*ChainEntries, error) {
+	view, err := db.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+	defer view.Release()
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultEntriesLimit
+	} else if limit > MaxEntriesLimit {
+		limit = MaxEntriesLimit
+	}
+
+	var eBlock *common.EBlock
+	var index int
+	if q.Cursor != "" {
+		var height uint32
+		height, index, err = parseEntriesCursor(q.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		eBlock, err = view.FetchEBlockByHeight(chainID, uint64(height))
+		if err != nil {
+			return nil, err
+		}
+		if eBlock == nil {
+			return nil, fmt.Errorf("Cursor %s is not in the chain", q.Cursor)
+		}
+	} else {
+		if q.OldestFirst {
+			eBlock, err = view.FetchEBlockByHeight(chainID, 0)
+		} else {
+			eBlock, err = view.FetchEBlockHead(chainID)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if eBlock != nil && !q.OldestFirst {
+			index = len(eBlock.EBEntries) - 1
+		}
+	}
+
+	page := new(ChainEntries)
+	page.Entries = make([]*ChainEntry, 0, limit)
+
+	for eBlock != nil {
+		header := eBlock.Header
+		if q.OldestFirst && q.ToHeight != 0 && header.DBHeight > q.ToHeight {
+			break
+		}
+		if !q.OldestFirst && header.DBHeight < q.FromHeight {
+			break
+		}
+
+		if header.DBHeight >= q.FromHeight && (q.ToHeight == 0 || header.DBHeight <= q.ToHeight) {
+			for index >= 0 && index < len(eBlock.EBEntries) {
+				hash := eBlock.EBEntries[index].EntryHash
+				if !common.IsEndOfMinuteMarker(hash) {
+					if len(page.Entries) == limit {
+						page.NextCursor = fmt.Sprintf("%d.%d", header.EBHeight, index)
+						return page, nil
+					}
+
+					entry, err := view.FetchEntryByHash(hash)
+					if err != nil {
+						return nil, err
+					}
+					page.Entries = append(page.Entries, &ChainEntry{
+						EntryHash: hash,
+						EBHeight:  header.EBHeight,
+						DBHeight:  header.DBHeight,
+						Entry:     entry,
+					})
+				}
+
+				if q.OldestFirst {
+					index++
+				} else {
+					index--
+				}
+			}
+		}
+
+		// Move on to the next EBlock of the chain
+		if q.OldestFirst {
+			eBlock, err = view.FetchEBlockByHeight(chainID, uint64(header.EBHeight)+1)
+			index = 0
+		} else {
+			if header.EBHeight == 0 {
+				break
+			}
+			eBlock, err = view.FetchEBlockByMR(header.PrevKeyMR)
+			if eBlock != nil {
+				index = len(eBlock.EBEntries) - 1
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+// parseEntriesCursor splits a cursor of the form "ebheight.index"
+func parseEntriesCursor(cursor string) (height uint32, index int, err error) {
+	parts := strings.Split(cursor, ".")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("Invalid cursor %s", cursor)
+	}
+
+	h, err := strconv.ParseUint(parts[0], 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid cursor %s", cursor)
+	}
+	i, err := strconv.ParseUint(parts[1], 10, 31)
+	if err != nil {
+		return 0, 0, fmt.Errorf("Invalid cursor %s", cursor)
+	}
+
+	return uint32(h), int(i), nil
+}
@@ -0,0 +1,121 @@
+package factomapi
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// chainDB serves the EBlocks and entries of a single chain
+type chainDB struct {
+	database.Db
+	eBlocks []*common.EBlock
+	entries map[string]*common.Entry
+}
+
+func (d *chainDB) FetchEBlockHead(chainID *common.Hash) (*common.EBlock, error) {
+	return d.eBlocks[len(d.eBlocks)-1], nil
+}
+
+func (d *chainDB) FetchEBlockByHeight(chainID *common.Hash, h uint64) (*common.EBlock, error) {
+	if h >= uint64(len(d.eBlocks)) {
+		return nil, nil
+	}
+	return d.eBlocks[h], nil
+}
+
+func (d *chainDB) FetchEBlockByMR(mr *common.Hash) (*common.EBlock, error) {
+	for _, b := range d.eBlocks {
+		if b.MerkleRoot.IsSameAs(mr) {
+			return b, nil
+		}
+	}
+	return nil, nil
+}
+
+func (d *chainDB) FetchEntryByHash(h *common.Hash) (*common.Entry, error) {
+	return d.entries[h.String()], nil
+}
+
+// The chain does not change, so it is its own view
+func (d *chainDB) Snapshot() (database.DbView, error) {
+	return d, nil
+}
+
+func (d *chainDB) Release() {}
+
+// newChainDB builds a chain of 3 EBlocks with 2 entries and a minute marker
+// each, at Directory Block heights 10, 11 and 12.
+func newChainDB() *chainDB {
+	d := &chainDB{entries: make(map[string]*common.Entry)}
+	chainID := common.Sha([]byte("chain"))
+	chain := &common.EChain{ChainID: chainID}
+
+	var prev *common.EBlock
+	for i := 0; i < 3; i++ {
+		b, _ := common.CreateBlock(chain, prev, 3)
+		b.Header.DBHeight = uint32(10 + i)
+		b.Header.BodyMR = common.NewHash()
+		for j := 0; j < 2; j++ {
+			e := &common.Entry{ChainID: chainID, Data: []byte{byte(i), byte(j)}}
+			b.AddEBEntry(e)
+			d.entries[b.EBEntries[len(b.EBEntries)-1].EntryHash.String()] = e
+		}
+		b.AddEndOfMinuteMarker(1)
+		b.BuildMerkleRoot()
+		data, _ := b.MarshalBinary()
+		b.EBHash = common.Sha(data)
+
+		d.eBlocks = append(d.eBlocks, b)
+		chain.NextBlockHeight++
+		prev = b
+	}
+
+	return d
+}
+
+func TestGetChainEntries(t *testing.T) {
+	d := newChainDB()
+	SetDB(d)
+	chainID := d.eBlocks[0].Header.ChainID
+
+	var got []string
+	q := &ChainEntriesQuery{Limit: 4}
+	for {
+		page, err := GetChainEntries(chainID, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range page.Entries {
+			got = append(got, string([]byte{'0' + e.Entry.Data[0], '0' + e.Entry.Data[1]}))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	if s := strings.Join(got, " "); s != "21 20 11 10 01 00" {
+		t.Errorf("newest first got %s", s)
+	}
+
+	got = nil
+	q = &ChainEntriesQuery{OldestFirst: true, Limit: 1, FromHeight: 11, ToHeight: 11}
+	for {
+		page, err := GetChainEntries(chainID, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range page.Entries {
+			got = append(got, string([]byte{'0' + e.Entry.Data[0], '0' + e.Entry.Data[1]}))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+	}
+	if s := strings.Join(got, " "); s != "10 11" {
+		t.Errorf("oldest first in height range got %s", s)
+	}
+}
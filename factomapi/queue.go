@@ -0,0 +1,585 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factomapi
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/btcd/wire"
+)
+
+// DefaultSubmitQueueSize is the size of the submission queue used when none
+// has been started
+const DefaultSubmitQueueSize = 1000
+
+// ErrQueueFull is returned when a submission is turned away because the
+// processor is not keeping up
+var ErrQueueFull = errors.New("Submission queue is full, try again later")
+
+// Types of the messages in the journal
+const (
+	journalCommitEntry byte = iota + 1
+	journalCommitChain
+	journalRevealEntry
+	journalRevealChain
+)
+
+// SubmitQueueStats reports on the submission queue
+type SubmitQueueStats struct {
+	// Depth is the number of messages waiting for the processor, including
+	// the one being handed to it
+	Depth    int
+	Capacity int
+
+	// Journaled is true if the waiting commits and reveals are kept on disk
+	Journaled bool
+
+	// Unacknowledged is the number of journaled messages handed to the
+	// processor whose entry is not in the database yet
+	Unacknowledged int
+
+	Submitted uint64
+	Forwarded uint64
+
+	// Rejected counts the submissions turned away because the queue was full
+	Rejected uint64
+
+	// Replayed counts the messages read back from the journal on startup
+	Replayed uint64
+}
+
+// queuedMsg is a message waiting in the submission queue, with the journal
+// file holding it if there is one
+type queuedMsg struct {
+	msg  wire.FtmInternalMsg
+	file string
+
+	// written is when the message was journaled
+	written time.Time
+}
+
+// submitQueue is a bounded queue in front of the processor. Submitting never
+// blocks, and a goroutine hands the messages to the processor in order. Slots
+// are reserved before a message is put in, so a submission can fail early
+// without side effects.
+//
+// A journaled commit or reveal stays on disk after it is handed to the
+// processor, until its entry is stored in the database or the commit window
+// has passed, as the processor has a buffer of its own that is lost on a
+// crash. Without a database to tell when entries are stored, the journal file
+// is removed as soon as the processor takes the message, and the messages in
+// the buffer of the processor are not replayed.
+type submitQueue struct {
+	slots chan struct{}
+	msgs  chan *queuedMsg
+	out   chan<- wire.FtmInternalMsg
+	quit  chan struct{}
+	done  chan struct{}
+
+	journalDir string
+	seq        uint64
+
+	// forwarded holds the journaled messages taken by the processor by the
+	// hash of their entry, until the entry is stored
+	db         database.Db
+	sub        *database.Subscription
+	forwarded  map[common.HashF][]*queuedMsg
+	lastExpiry time.Time
+
+	lock  sync.Mutex
+	stats SubmitQueueStats
+}
+
+var (
+	subQueue     *submitQueue
+	subQueueLock sync.Mutex
+)
+
+// StartSubmitQueue starts the submission queue in front of the processor,
+// which takes the messages from out. Commits and reveals waiting in the queue
+// are journaled to journalDir, unless it is empty, and the ones left from a
+// previous run are submitted again. SetDB has to be called first for the
+// journal to be kept until the entries are stored.
+func StartSubmitQueue(size int, journalDir string, out chan<- wire.FtmInternalMsg) error {
+	subQueueLock.Lock()
+	defer subQueueLock.Unlock()
+
+	if subQueue != nil {
+		return errors.New("The submission queue has been started already")
+	}
+	if out == nil {
+		return errors.New("The submission queue needs a processor queue")
+	}
+	if size <= 0 {
+		size = DefaultSubmitQueueSize
+	}
+
+	var pending []*queuedMsg
+	var seq uint64
+	if journalDir != "" {
+		if err := os.MkdirAll(journalDir, 0750); err != nil {
+			return err
+		}
+
+		var err error
+		pending, seq, err = readJournal(journalDir)
+		if err != nil {
+			return err
+		}
+		if pending, err = dropStale(pending, db); err != nil {
+			return err
+		}
+		if len(pending) > size {
+			size = len(pending)
+		}
+	}
+
+	q := newSubmitQueue(size, journalDir, out)
+	q.seq = seq
+	if journalDir != "" && db != nil {
+		q.db = db
+		q.sub = db.Subscribe(database.ObserverFunc(q.stored))
+	}
+	for _, m := range pending {
+		q.slots <- struct{}{}
+		q.msgs <- m
+		q.stats.Replayed++
+	}
+
+	subQueue = q
+	go q.run()
+
+	return nil
+}
+
+// stopSubmitQueue stops the submission queue. The messages still waiting are
+// left in the journal.
+func stopSubmitQueue() {
+	subQueueLock.Lock()
+	defer subQueueLock.Unlock()
+
+	if subQueue != nil {
+		subQueue.stop()
+		subQueue = nil
+	}
+}
+
+// GetSubmitQueueStats reports on the submission queue. The stats are empty if
+// the queue has not been started.
+func GetSubmitQueueStats() SubmitQueueStats {
+	q, err := getSubmitQueue()
+	if err != nil {
+		return SubmitQueueStats{}
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	stats := q.stats
+	stats.Depth = len(q.slots)
+	return stats
+}
+
+// submit puts a message in the submission queue, failing with ErrQueueFull if
+// there is no room for it
+func submit(msg wire.FtmInternalMsg) error {
+	q, err := getSubmitQueue()
+	if err != nil {
+		return err
+	}
+	if err := q.reserve(); err != nil {
+		return err
+	}
+	return q.put(msg)
+}
+
+// getSubmitQueue returns the submission queue, failing if it has not been
+// started, as there would be nothing to hand the messages to
+func getSubmitQueue() (*submitQueue, error) {
+	subQueueLock.Lock()
+	defer subQueueLock.Unlock()
+
+	if subQueue == nil {
+		return nil, errors.New("The submission queue has not been started")
+	}
+	return subQueue, nil
+}
+
+func newSubmitQueue(size int, journalDir string, out chan<- wire.FtmInternalMsg) *submitQueue {
+	q := new(submitQueue)
+	q.slots = make(chan struct{}, size)
+	q.msgs = make(chan *queuedMsg, size)
+	q.out = out
+	q.quit = make(chan struct{})
+	q.done = make(chan struct{})
+	q.journalDir = journalDir
+	q.forwarded = make(map[common.HashF][]*queuedMsg)
+	q.stats.Capacity = size
+	q.stats.Journaled = journalDir != ""
+	return q
+}
+
+// reserve takes a slot in the queue for a message
+func (q *submitQueue) reserve() error {
+	select {
+	case q.slots <- struct{}{}:
+		return nil
+	default:
+		q.lock.Lock()
+		q.stats.Rejected++
+		q.lock.Unlock()
+		return ErrQueueFull
+	}
+}
+
+// release gives back a reserved slot that will not be used
+func (q *submitQueue) release() {
+	<-q.slots
+}
+
+// put journals a message and queues it in a reserved slot
+func (q *submitQueue) put(msg wire.FtmInternalMsg) error {
+	m, err := q.journal(msg)
+	if err != nil {
+		return err
+	}
+	q.queue(m)
+	return nil
+}
+
+// journal writes a message for a reserved slot to the journal. The slot is
+// released if that fails. The message is not queued until queue is called, so
+// a submission can still be turned away with discard.
+func (q *submitQueue) journal(msg wire.FtmInternalMsg) (*queuedMsg, error) {
+	m := &queuedMsg{msg: msg, written: time.Now()}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.journalDir != "" {
+		if data, ok := encodeJournalMsg(msg); ok {
+			q.seq++
+			m.file = filepath.Join(q.journalDir, fmt.Sprintf("%016x.msg", q.seq))
+			if err := writeJournalFile(m.file, data); err != nil {
+				q.release()
+				return nil, err
+			}
+		}
+	}
+	return m, nil
+}
+
+// queue puts a journaled message in its reserved slot
+func (q *submitQueue) queue(m *queuedMsg) {
+	q.lock.Lock()
+	q.stats.Submitted++
+
+	// The slot is reserved, so this does not block
+	q.msgs <- m
+	q.lock.Unlock()
+}
+
+// discard removes a journaled message that will not be queued, and releases
+// its slot
+func (q *submitQueue) discard(m *queuedMsg) {
+	if m.file != "" {
+		os.Remove(m.file)
+	}
+	q.release()
+}
+
+// run hands the queued messages to the processor, waiting for it as long as
+// needed
+func (q *submitQueue) run() {
+	defer close(q.done)
+
+	for {
+		var m *queuedMsg
+		select {
+		case m = <-q.msgs:
+		case <-q.quit:
+			return
+		}
+
+		select {
+		case q.out <- m.msg:
+		case <-q.quit:
+			return
+		}
+		q.release()
+
+		q.lock.Lock()
+		q.stats.Forwarded++
+		q.acknowledgeLater(m)
+		q.lock.Unlock()
+	}
+}
+
+// stop stops handing messages to the processor
+func (q *submitQueue) stop() {
+	close(q.quit)
+	<-q.done
+	if q.sub != nil {
+		q.db.Unsubscribe(q.sub)
+	}
+}
+
+// acknowledgeLater keeps the journal file of a message taken by the processor
+// until its entry is stored. Messages held longer than the commit window are
+// given up on, as the processor rejects them by then. The lock must be held.
+func (q *submitQueue) acknowledgeLater(m *queuedMsg) {
+	if m.file == "" {
+		return
+	}
+	hash := journalEntryHash(m.msg)
+	if q.sub == nil || hash == nil {
+		os.Remove(m.file)
+		return
+	}
+
+	var key common.HashF
+	key.From(hash)
+	q.forwarded[key] = append(q.forwarded[key], m)
+	q.stats.Unacknowledged++
+
+	window := common.GetCommitWindow()
+	now := time.Now()
+	if now.Sub(q.lastExpiry) < window {
+		return
+	}
+	q.lastExpiry = now
+	for k, msgs := range q.forwarded {
+		kept := msgs[:0]
+		for _, m := range msgs {
+			if now.Sub(m.written) > window {
+				os.Remove(m.file)
+				q.stats.Unacknowledged--
+			} else {
+				kept = append(kept, m)
+			}
+		}
+		if len(kept) == 0 {
+			delete(q.forwarded, k)
+		} else {
+			q.forwarded[k] = kept
+		}
+	}
+}
+
+// stored removes the journal files of the commit and reveal of an entry once
+// it is in the database
+func (q *submitQueue) stored(e *database.Event) {
+	if e.Type != database.EventEntry || e.Hash == nil {
+		return
+	}
+
+	var key common.HashF
+	key.From(e.Hash)
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for _, m := range q.forwarded[key] {
+		os.Remove(m.file)
+		q.stats.Unacknowledged--
+	}
+	delete(q.forwarded, key)
+}
+
+// dropStale removes the journaled messages whose entry is in the database
+// already, or which are older than the commit window
+func dropStale(msgs []*queuedMsg, db database.Db) ([]*queuedMsg, error) {
+	window := common.GetCommitWindow()
+	now := time.Now()
+
+	kept := msgs[:0]
+	for _, m := range msgs {
+		stale := now.Sub(m.written) > window
+		if hash := journalEntryHash(m.msg); !stale && hash != nil && db != nil {
+			entry, err := db.FetchEntryByHash(hash)
+			if err != nil {
+				return nil, err
+			}
+			stale = entry != nil
+		}
+		if stale {
+			os.Remove(m.file)
+		} else {
+			kept = append(kept, m)
+		}
+	}
+	return kept, nil
+}
+
+// journalEntryHash returns the hash of the entry a journaled commit or reveal
+// is for
+func journalEntryHash(msg wire.FtmInternalMsg) *common.Hash {
+	var e *common.Entry
+	switch m := msg.(type) {
+	case *wire.MsgCommitEntry:
+		return m.EntryHash
+	case *wire.MsgCommitChain:
+		return m.EntryHash
+	case *wire.MsgRevealEntry:
+		e = m.Entry
+	case *wire.MsgRevealChain:
+		if m.Chain != nil {
+			e = m.Chain.FirstEntry
+		}
+	}
+	if e == nil || e.ChainID == nil {
+		return nil
+	}
+
+	data, err := e.MarshalBinary()
+	if err != nil {
+		return nil
+	}
+	return common.Sha(data)
+}
+
+// writeJournalFile writes a journal file in one go, so a crash does not leave
+// half of a message behind
+func writeJournalFile(name string, data []byte) error {
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	return os.Rename(tmp, name)
+}
+
+// readJournal reads the messages left in the journal, oldest first, and
+// returns them with the last sequence number used
+func readJournal(dir string) (msgs []*queuedMsg, seq uint64, err error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// ReadDir sorts by name, which is the order of the sequence numbers
+	for _, f := range files {
+		name := f.Name()
+		if !strings.HasSuffix(name, ".msg") {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSuffix(name, ".msg"), 16, 64)
+		if err != nil {
+			continue
+		}
+		if n > seq {
+			seq = n
+		}
+
+		file := filepath.Join(dir, name)
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, 0, err
+		}
+		msg, err := decodeJournalMsg(data)
+		if err != nil {
+			// A message that cannot be read back is dropped
+			os.Remove(file)
+			continue
+		}
+		msgs = append(msgs, &queuedMsg{msg: msg, file: file, written: f.ModTime()})
+	}
+
+	return msgs, seq, nil
+}
+
+// encodeJournalMsg encodes the commits and reveals for the journal. Other
+// messages are not journaled.
+func encodeJournalMsg(msg wire.FtmInternalMsg) (data []byte, ok bool) {
+	var t byte
+	var err error
+	switch m := msg.(type) {
+	case *wire.MsgCommitEntry:
+		t = journalCommitEntry
+		c := &common.CommitEntry{
+			Timestamp: m.Timestamp,
+			EntryHash: m.EntryHash,
+			Credits:   m.Credits,
+			ECPubKey:  m.ECPubKey,
+			Sig:       m.Sig,
+		}
+		data, err = c.MarshalBinary()
+	case *wire.MsgCommitChain:
+		t = journalCommitChain
+		c := &common.CommitChain{
+			Timestamp:        m.Timestamp,
+			ChainID:          m.ChainID,
+			EntryHash:        m.EntryHash,
+			EntryChainIDHash: m.EntryChainIDHash,
+			Credits:          m.Credits,
+			ECPubKey:         m.ECPubKey,
+			Sig:              m.Sig,
+		}
+		data, err = c.MarshalBinary()
+	case *wire.MsgRevealEntry:
+		t = journalRevealEntry
+		data, err = m.Entry.MarshalBinary()
+	case *wire.MsgRevealChain:
+		t = journalRevealChain
+		data, err = m.Chain.MarshalBinary()
+	default:
+		return nil, false
+	}
+	if err != nil {
+		return nil, false
+	}
+
+	return append([]byte{t}, data...), true
+}
+
+// decodeJournalMsg turns a journal file back into a message
+func decodeJournalMsg(data []byte) (wire.FtmInternalMsg, error) {
+	if len(data) == 0 {
+		return nil, errors.New("Empty journal message")
+	}
+
+	t, data := data[0], data[1:]
+	switch t {
+	case journalCommitEntry:
+		c := new(common.CommitEntry)
+		if err := c.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return newMsgCommitEntry(c), nil
+	case journalCommitChain:
+		c := new(common.CommitChain)
+		if err := c.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		return newMsgCommitChain(c), nil
+	case journalRevealEntry:
+		e := new(common.Entry)
+		if err := e.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		msg := wire.NewMsgRevealEntry()
+		msg.Entry = e
+		return msg, nil
+	case journalRevealChain:
+		c := new(common.EChain)
+		if err := c.UnmarshalBinary(data); err != nil {
+			return nil, err
+		}
+		msg := wire.NewMsgRevealChain()
+		msg.Chain = c
+		return msg, nil
+	}
+
+	return nil, fmt.Errorf("Unknown journal message type %d", t)
+}
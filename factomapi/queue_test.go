@@ -0,0 +1,114 @@
+package factomapi
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/btcd/wire"
+)
+
+// eventDB publishes events for the tests, and stores no entries
+type eventDB struct {
+	database.Db
+	feed *database.EventFeed
+}
+
+func (d *eventDB) Subscribe(o database.Observer) *database.Subscription {
+	return d.feed.Subscribe(o)
+}
+
+func (d *eventDB) Unsubscribe(s *database.Subscription) {
+	d.feed.Unsubscribe(s)
+}
+
+func (d *eventDB) FetchEntryByHash(h *common.Hash) (*common.Entry, error) {
+	return nil, nil
+}
+
+func TestSubmitQueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "submit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	d := &eventDB{feed: database.NewEventFeed()}
+	SetDB(d)
+	defer SetDB(nil)
+
+	if err := RevealEntry(&common.Entry{ChainID: common.NewHash()}); err == nil {
+		t.Errorf("submitted without a queue")
+	}
+
+	// Nothing reads from the processor queue, so the queue fills up
+	stalled := make(chan wire.FtmInternalMsg)
+	if err := StartSubmitQueue(2, dir, stalled); err != nil {
+		t.Fatal(err)
+	}
+
+	var hashes []*common.Hash
+	for i := 0; i < 2; i++ {
+		e := &common.Entry{ChainID: common.Sha([]byte("chain")), Data: []byte{byte(i)}}
+		if err := RevealEntry(e); err != nil {
+			t.Fatal(err)
+		}
+		data, _ := e.MarshalBinary()
+		hashes = append(hashes, common.Sha(data))
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := RevealEntry(&common.Entry{ChainID: common.NewHash()}); err != ErrQueueFull {
+		t.Errorf("expected a full queue, got %v", err)
+	}
+
+	stats := GetSubmitQueueStats()
+	if stats.Depth != 2 || stats.Submitted != 2 || stats.Rejected != 1 || !stats.Journaled {
+		t.Errorf("wrong stats %+v", stats)
+	}
+
+	// Start again from the journal, as after a restart
+	stopSubmitQueue()
+	processor := make(chan wire.FtmInternalMsg, 10)
+	if err := StartSubmitQueue(2, dir, processor); err != nil {
+		t.Fatal(err)
+	}
+	defer stopSubmitQueue()
+
+	for i := 0; i < 2; i++ {
+		select {
+		case msg := <-processor:
+			e := msg.(*wire.MsgRevealEntry).Entry
+			if e.Data[0] != byte(i) {
+				t.Errorf("entry %d replayed out of order", e.Data[0])
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("only %d messages replayed", i)
+		}
+	}
+	if GetSubmitQueueStats().Replayed != 2 {
+		t.Errorf("wrong replay count %+v", GetSubmitQueueStats())
+	}
+
+	// The journal is kept until the entries are stored
+	time.Sleep(10 * time.Millisecond)
+	if files, _ := ioutil.ReadDir(dir); len(files) != 2 {
+		t.Errorf("%d messages in the journal before the entries are stored", len(files))
+	}
+	if n := GetSubmitQueueStats().Unacknowledged; n != 2 {
+		t.Errorf("%d messages waiting for their entries", n)
+	}
+
+	for _, h := range hashes {
+		d.feed.Publish(&database.Event{Type: database.EventEntry, Hash: h})
+	}
+	time.Sleep(10 * time.Millisecond)
+	if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+		t.Errorf("%d messages left in the journal", len(files))
+	}
+	if n := GetSubmitQueueStats().Unacknowledged; n != 0 {
+		t.Errorf("%d messages still waiting for their entries", n)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factomapi
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// GetRawData gets the binary form of a block or entry, as it is hashed, so
+// another node can check it and store it. kind is one of "dblockbyheight",
+// "ablock", "ecblock", "eblock" or "entry", and key the height, hash or merkle
+// root to look it up by. The data is nil if it is not found.
+func GetRawData(kind string, key string) ([]byte, error) {
+	if kind == "dblockbyheight" {
+		height, err := strconv.ParseUint(key, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		block, err := db.FetchDBlockByHeight(height)
+		if err != nil || block == nil {
+			return nil, nil
+		}
+		return block.MarshalBinary()
+	}
+
+	hash, err := common.HexToHash(key)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case "ablock":
+		block, err := db.FetchABlockByHash(hash)
+		if err != nil || block == nil {
+			return nil, err
+		}
+		return block.MarshalBinary()
+	case "ecblock":
+		block, err := db.FetchCBlockByHash(hash)
+		if err != nil || block == nil {
+			return nil, err
+		}
+		return block.MarshalBinary()
+	case "eblock":
+		block, err := db.FetchEBlockByMR(hash)
+		if err != nil || block == nil {
+			return nil, err
+		}
+		return block.MarshalBinary()
+	case "entry":
+		entry, err := db.FetchEntryByHash(hash)
+		if err != nil || entry == nil {
+			return nil, err
+		}
+		return entry.MarshalBinary()
+	}
+
+	return nil, fmt.Errorf("Unknown kind of data %s", kind)
+}
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"crypto/sha256"
 	//	"encoding/base64"
-	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/FactomProject/FactomCode/common"
 )
 
 type jsonentry struct {
@@ -39,37 +42,64 @@ func (e *Entry) CreateFactomEntry() *Entry {
 	return e
 }
 
-// Hash returns a hex encoded sha256 hash of the entry.
-func (e *Entry) Hash() string {
-	s := sha256.New()
-	s.Write(e.MarshalBinary())
-	return hex.EncodeToString(s.Sum(nil))
+// Hash returns the hex encoded entry hash, the same hash the entry is stored
+// under once it is in the factom blockchain.
+func (e *Entry) Hash() (string, error) {
+	data, err := e.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(common.Sha(data).Bytes), nil
 }
 
 // Hex return the hex encoded string of the binary entry.
 // Depricated!
-func (e *Entry) Hex() string {
-	return hex.EncodeToString(e.MarshalBinary())
+func (e *Entry) Hex() (string, error) {
+	data, err := e.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
 }
 
-// MarshalBinary creates a single []byte from an entry for transport.
-func (e *Entry) MarshalBinary() []byte {
-	var buf bytes.Buffer
-
-	buf.Write([]byte{byte(len(e.ChainID))})
-	buf.Write(e.ChainID)
+// MarshalBinary creates a single []byte from an entry for transport. The
+// encoding is that of common.Entry.
+func (e *Entry) MarshalBinary() ([]byte, error) {
+	ce, err := e.ToCommonEntry()
+	if err != nil {
+		return nil, err
+	}
+	return ce.MarshalBinary()
+}
 
-	count := len(e.ExtIDs)
-	binary.Write(&buf, binary.BigEndian, uint8(count))
-	for _, bytes := range e.ExtIDs {
-		count = len(bytes)
-		binary.Write(&buf, binary.BigEndian, uint32(count))
-		buf.Write(bytes)
+// ToCommonEntry returns the entry as a common.Entry
+func (e *Entry) ToCommonEntry() (*common.Entry, error) {
+	if len(e.ChainID) != common.HASH_LENGTH {
+		return nil, fmt.Errorf("ChainID must be %d bytes, not %d",
+			common.HASH_LENGTH, len(e.ChainID))
 	}
 
-	buf.Write(e.Data)
+	ce := new(common.Entry)
+	ce.ChainID = new(common.Hash)
+	ce.ChainID.Bytes = make([]byte, common.HASH_LENGTH)
+	copy(ce.ChainID.Bytes, e.ChainID)
+	ce.ExtIDs = e.ExtIDs
+	ce.Data = e.Data
 
-	return buf.Bytes()
+	return ce, nil
+}
+
+// NewEntryFromCommon returns a common.Entry as an Entry
+func NewEntryFromCommon(ce *common.Entry) *Entry {
+	e := new(Entry)
+	if ce.ChainID != nil {
+		e.ChainID = make([]byte, len(ce.ChainID.Bytes))
+		copy(e.ChainID, ce.ChainID.Bytes)
+	}
+	e.ExtIDs = ce.ExtIDs
+	e.Data = ce.Data
+
+	return e
 }
 
 // UnmarshalJSON makes satisfies the json.Unmarshaler interfact and populates
@@ -153,42 +183,90 @@ func (c *Chain) GenerateID() string {
 	return hex.EncodeToString(c.ChainID)
 }
 
-// Hash will return a hex encoded hash of the chainid, a hash of the entry, and
-// a hash of the chainid + entry to be used by CommitChain.
-func (c *Chain) Hash() (chain string, chain_entry string, entry string) {
-	s := sha256.New()
-	s.Write(c.MarshalBinary())
-	chain = hex.EncodeToString(s.Sum(nil))
+// Hash will return the hex encoded chainid, the hash of the chainid + entry
+// hash, and the entry hash of the first entry, as used by CommitChain.
+func (c *Chain) Hash() (chain string, chain_entry string, entry string, err error) {
+	ce, err := c.ToCommonChain()
+	if err != nil {
+		return
+	}
 
-	s.Write(c.FirstEntry.MarshalBinary())
-	chain_entry = hex.EncodeToString(s.Sum(nil))
+	data, err := ce.FirstEntry.MarshalBinary()
+	if err != nil {
+		return
+	}
+	entryHash := common.Sha(data)
 
-	entry = c.FirstEntry.Hash()
+	chain = hex.EncodeToString(ce.ChainID.Bytes)
+	chain_entry = hex.EncodeToString(common.GetEntryChainIDHash(ce.ChainID, entryHash).Bytes)
+	entry = hex.EncodeToString(entryHash.Bytes)
 
 	return
 }
 
 // Hex will return a hex encoded string of the binary chain.
-func (c *Chain) Hex() string {
-	return hex.EncodeToString(c.MarshalBinary())
+func (c *Chain) Hex() (string, error) {
+	data, err := c.MarshalBinary()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(data), nil
 }
 
-// MarshalBinary creates a single []byte from a chain for transport.
-func (c *Chain) MarshalBinary() []byte {
-	var buf bytes.Buffer
+// ToCommonChain returns the chain as a common.EChain. The ChainID, if set,
+// and the ChainID of the first entry must be the ones of the chain name.
+func (c *Chain) ToCommonChain() (*common.EChain, error) {
+	if c.FirstEntry == nil {
+		return nil, errors.New("The first entry is required for a chain")
+	}
 
-	buf.Write(c.ChainID)
+	fe, err := c.FirstEntry.ToCommonEntry()
+	if err != nil {
+		return nil, err
+	}
 
-	count := len(c.Name)
-	binary.Write(&buf, binary.BigEndian, uint64(count))
+	chainID, err := common.GetChainID(c.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.ChainID) != 0 && !bytes.Equal(c.ChainID, chainID.Bytes) {
+		return nil, fmt.Errorf("ChainID %x is not the ChainID of the chain name", c.ChainID)
+	}
+	if !fe.ChainID.IsSameAs(chainID) {
+		return nil, fmt.Errorf("The first entry is not in chain %s", chainID.String())
+	}
 
-	for _, bytes := range c.Name {
-		count = len(bytes)
-		binary.Write(&buf, binary.BigEndian, uint64(count))
-		buf.Write(bytes)
+	ce := new(common.EChain)
+	ce.ChainID = chainID
+	ce.Name = c.Name
+	ce.FirstEntry = fe
+
+	return ce, nil
+}
+
+// NewChainFromCommon returns a common.EChain as a Chain
+func NewChainFromCommon(ce *common.EChain) *Chain {
+	c := new(Chain)
+	if ce.ChainID != nil {
+		c.ChainID = make([]byte, len(ce.ChainID.Bytes))
+		copy(c.ChainID, ce.ChainID.Bytes)
+	}
+	c.Name = ce.Name
+	if ce.FirstEntry != nil {
+		c.FirstEntry = NewEntryFromCommon(ce.FirstEntry)
 	}
 
-	return buf.Bytes()
+	return c
+}
+
+// MarshalBinary creates a single []byte from a chain for transport. The
+// encoding is that of common.EChain.
+func (c *Chain) MarshalBinary() ([]byte, error) {
+	ce, err := c.ToCommonChain()
+	if err != nil {
+		return nil, err
+	}
+	return ce.MarshalBinary()
 }
 
 func sha(b []byte) []byte {
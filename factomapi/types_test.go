@@ -0,0 +1,108 @@
+package factomapi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+func TestEntryHashMatchesCommon(t *testing.T) {
+	ce := new(common.Entry)
+	ce.ChainID = common.Sha([]byte("chain"))
+	ce.ExtIDs = [][]byte{[]byte("one"), []byte("two")}
+	ce.Data = []byte("some data")
+
+	data, err := ce.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e := NewEntryFromCommon(ce)
+	b, err := e.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, data) {
+		t.Errorf("binary entries differ:\n%x\n%x", b, data)
+	}
+
+	hash, err := e.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != common.Sha(data).String() {
+		t.Errorf("entry hash %s, expected %s", hash, common.Sha(data).String())
+	}
+
+	back, err := e.ToCommonEntry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !back.ChainID.IsSameAs(ce.ChainID) || len(back.ExtIDs) != 2 ||
+		!bytes.Equal(back.Data, ce.Data) {
+		t.Errorf("entry changed on conversion")
+	}
+}
+
+func TestEntryBadChainID(t *testing.T) {
+	e := &Entry{ChainID: []byte{1, 2, 3}}
+	if _, err := e.MarshalBinary(); err == nil {
+		t.Errorf("entry with a short ChainID was marshalled")
+	}
+}
+
+func TestChainHashMatchesCommon(t *testing.T) {
+	c := new(Chain)
+	c.Name = [][]byte{[]byte("my"), []byte("chain")}
+	c.GenerateID()
+	c.FirstEntry = &Entry{ChainID: c.ChainID, ExtIDs: c.Name, Data: []byte("first")}
+
+	chainID, chainEntry, entry, err := c.Hash()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ce, err := c.ToCommonChain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := common.GetChainID(ce.Name)
+	if chainID != id.String() {
+		t.Errorf("ChainID %s, expected %s", chainID, id.String())
+	}
+
+	data, _ := ce.FirstEntry.MarshalBinary()
+	entryHash := common.Sha(data)
+	if entry != entryHash.String() {
+		t.Errorf("entry hash %s, expected %s", entry, entryHash.String())
+	}
+	if chainEntry != common.GetEntryChainIDHash(id, entryHash).String() {
+		t.Errorf("wrong EntryChainIDHash %s", chainEntry)
+	}
+
+	if hex.EncodeToString(NewChainFromCommon(ce).ChainID) != chainID {
+		t.Errorf("ChainID changed on conversion")
+	}
+
+	data, err = c.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := ce.MarshalBinary()
+	if !bytes.Equal(data, want) {
+		t.Errorf("chain not marshalled as a common.EChain")
+	}
+
+	// The ChainID has to be the one of the name
+	c.ChainID = make([]byte, len(c.ChainID))
+	if _, err := c.ToCommonChain(); err == nil {
+		t.Errorf("chain with another ChainID converted")
+	}
+	c.GenerateID()
+	c.FirstEntry.ChainID = make([]byte, len(c.ChainID))
+	if _, err := c.ToCommonChain(); err == nil {
+		t.Errorf("chain with a first entry in another chain converted")
+	}
+}
@@ -69,7 +69,7 @@ func TestAddChain(t *testing.T) {
 	chain.ChainID,_ = common.GetChainID(chain.Name)
 
 	entry := new(common.Entry)
-	entry.ChainID = *chain.ChainID
+	entry.ChainID = chain.ChainID
 	entry.ExtIDs = make([][]byte, 0, 5)
 	entry.ExtIDs = append(entry.ExtIDs, []byte("1001"))
 	entry.ExtIDs = append(entry.ExtIDs, []byte("570b9e3fb2f5ae823685eb4422d4fd83f3f0d9e7ce07d988bd17e665394668c6"))
@@ -130,7 +130,7 @@ func TestAddEntry(t *testing.T) {
 	chain.ChainID,_ = common.GetChainID(chain.Name)
 
 	entry := new(common.Entry)
-	entry.ChainID = *chain.ChainID
+	entry.ChainID = chain.ChainID
 	entry.ExtIDs = make([][]byte, 0, 5)
 	entry.ExtIDs = append(entry.ExtIDs, []byte("1001"))
 	entry.ExtIDs = append(entry.ExtIDs, []byte("570b9e3fb2f5ae823685eb4422d4fd83f3f0d9e7ce07d988bd17e665394668c6"))
@@ -185,7 +185,7 @@ func TestAddEntry2(t *testing.T) {
 	chain.ChainID,_ = common.GetChainID(chain.Name)
 
 	entry := new(common.Entry)
-	entry.ChainID = *chain.ChainID
+	entry.ChainID = chain.ChainID
 	entry.ExtIDs = make([][]byte, 0, 5)
 	entry.ExtIDs = append(entry.ExtIDs, []byte("1001"))
 	entry.ExtIDs = append(entry.ExtIDs, []byte("570b9e3fb2f5ae823685eb4422d4fd83f3f0d9e7ce07d988bd17e665394668c6"))
@@ -280,7 +280,7 @@ func TestGetCreditWalletBalance(t *testing.T) {
 	barray := (make([]byte, 32))
 	barray[0] = 2
 	pubKey := new (common.Hash)
-	pubKey.SetBytes(barray)
+	pubKey.Bytes = barray
 	data.Set("pubkey", "wallet")
 	data.Set("password", "opensesame")
 
@@ -0,0 +1,182 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factomclient
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// DBlockHeight returns the height of the newest Directory Block
+func (c *Client) DBlockHeight(ctx context.Context) (int, error) {
+	body, err := c.do(ctx, "GET", "dblockheight", nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(body)))
+}
+
+// DBlock returns the Directory Block with the hash hash
+func (c *Client) DBlock(ctx context.Context, hash *common.Hash) (*common.DirectoryBlock, error) {
+	b := new(common.DirectoryBlock)
+	if err := c.get(ctx, "dblock/"+hash.String(), b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// EBlock returns the Entry Block with the merkle root mr
+func (c *Client) EBlock(ctx context.Context, mr *common.Hash) (*common.EBlock, error) {
+	b := new(common.EBlock)
+	if err := c.get(ctx, "eblock/"+mr.String(), b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// Entry returns the entry with the hash hash
+func (c *Client) Entry(ctx context.Context, hash *common.Hash) (*common.Entry, error) {
+	e := new(common.Entry)
+	if err := c.get(ctx, "entry/"+hash.String(), e); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Chain returns the chain chainID
+func (c *Client) Chain(ctx context.Context, chainID *common.Hash) (*common.EChain, error) {
+	ch := new(common.EChain)
+	if err := c.get(ctx, "chain/"+chainID.String(), ch); err != nil {
+		return nil, err
+	}
+
+	return ch, nil
+}
+
+// CreditBalance returns the Entry Credit balance of the public key pubKey
+func (c *Client) CreditBalance(ctx context.Context, pubKey *common.Hash) (*common.ECBalance, error) {
+	b := new(common.ECBalance)
+	path := "creditbalance?" + url.Values{"pubkey": {pubKey.String()}}.Encode()
+	if err := c.get(ctx, path, b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// RawData returns the binary form of a block or entry, see
+// factomapi.GetRawData for the kinds and keys. The data is nil if the server
+// does not have it.
+func (c *Client) RawData(ctx context.Context, kind string, key string) ([]byte, error) {
+	body, err := c.do(ctx, "GET", "raw/"+kind+"/"+key, nil)
+	if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode == http.StatusNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return hex.DecodeString(strings.TrimSpace(string(body)))
+}
+
+// CommitEntry sends a signed entry commit to the server
+func (c *Client) CommitEntry(ctx context.Context, commit *common.CommitEntry) error {
+	data, err := commit.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.post(ctx, "commitentry", url.Values{"commit": {hex.EncodeToString(data)}})
+	return err
+}
+
+// CommitChain sends a signed chain commit to the server
+func (c *Client) CommitChain(ctx context.Context, commit *common.CommitChain) error {
+	data, err := commit.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.post(ctx, "commitchain", url.Values{"commit": {hex.EncodeToString(data)}})
+	return err
+}
+
+// RevealEntry sends a committed entry to the server
+func (c *Client) RevealEntry(ctx context.Context, e *common.Entry) error {
+	data, err := e.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.post(ctx, "revealentry", url.Values{"entry": {hex.EncodeToString(data)}})
+	return err
+}
+
+// RevealChain sends the first entry of a committed chain to the server
+func (c *Client) RevealChain(ctx context.Context, ch *common.EChain) error {
+	data, err := ch.FirstEntry.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	_, err = c.post(ctx, "revealchain", url.Values{"entry": {hex.EncodeToString(data)}})
+	return err
+}
+
+// SubmitEntry commits e, paid for and signed by key, and then reveals it. It
+// returns the entry hash.
+func (c *Client) SubmitEntry(ctx context.Context, e *common.Entry, key common.Signer) (*common.Hash, error) {
+	commit, err := NewCommitEntry(e, key)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.CommitEntry(ctx, commit); err != nil {
+		return nil, err
+	}
+
+	if err := c.sleep(ctx, c.RevealDelay); err != nil {
+		return nil, err
+	}
+	if err := c.RevealEntry(ctx, e); err != nil {
+		return nil, err
+	}
+
+	return commit.EntryHash, nil
+}
+
+// SubmitChain commits ch, paid for and signed by key, and then reveals it
+func (c *Client) SubmitChain(ctx context.Context, ch *common.EChain, key common.Signer) error {
+	commit, err := NewCommitChain(ch, key)
+	if err != nil {
+		return err
+	}
+	if err := c.CommitChain(ctx, commit); err != nil {
+		return err
+	}
+
+	if err := c.sleep(ctx, c.RevealDelay); err != nil {
+		return err
+	}
+	return c.RevealChain(ctx, ch)
+}
+
+func (c *Client) sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,149 @@
+package factomclient
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/FactomCode/factomapi"
+)
+
+// serveJSON answers a request for path with obj, written as the wsapi does
+func serveJSON(t *testing.T, path string, obj interface{}) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			t.Errorf("requested %s, expected %s", r.URL.Path, path)
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if err := factomapi.SafeMarshal(w, obj); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestDBlock(t *testing.T) {
+	b := &common.DirectoryBlock{
+		Header: &common.DBlockHeader{
+			BodyMR:        common.Sha([]byte("body")),
+			PrevKeyMR:     common.Sha([]byte("prev")),
+			PrevBlockHash: common.NewHash(),
+			BlockHeight:   12,
+			EntryCount:    1,
+		},
+		DBEntries: []*common.DBEntry{
+			{ChainID: common.Sha([]byte("chain")), MerkleRoot: common.Sha([]byte("mr"))},
+		},
+	}
+	hash := common.Sha([]byte("dblock"))
+	server, client := newTestServer(serveJSON(t, "/v1/dblock/"+hash.String(), b))
+	defer server.Close()
+
+	got, err := client.DBlock(context.Background(), hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Header.BlockHeight != 12 || !got.Header.PrevKeyMR.IsSameAs(b.Header.PrevKeyMR) {
+		t.Errorf("wrong header %+v", got.Header)
+	}
+	if len(got.DBEntries) != 1 || !got.DBEntries[0].MerkleRoot.IsSameAs(b.DBEntries[0].MerkleRoot) {
+		t.Errorf("wrong entries %+v", got.DBEntries)
+	}
+}
+
+func TestEBlock(t *testing.T) {
+	entryHash := common.Sha([]byte("entry"))
+	b := &common.EBlock{
+		Header: &common.EBlockHeader{
+			ChainID:    common.Sha([]byte("chain")),
+			BodyMR:     entryHash,
+			PrevKeyMR:  common.NewHash(),
+			PrevHash:   common.NewHash(),
+			EBHeight:   3,
+			DBHeight:   7,
+			EntryCount: 1,
+		},
+		EBEntries: []*common.EBEntry{common.NewEBEntry(entryHash)},
+	}
+	mr := common.Sha([]byte("mr"))
+	server, client := newTestServer(serveJSON(t, "/v1/eblock/"+mr.String(), b))
+	defer server.Close()
+
+	got, err := client.EBlock(context.Background(), mr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Header.EBHeight != 3 || got.Header.DBHeight != 7 || !got.Header.ChainID.IsSameAs(b.Header.ChainID) {
+		t.Errorf("wrong header %+v", got.Header)
+	}
+	if len(got.EBEntries) != 1 || !got.EBEntries[0].EntryHash.IsSameAs(entryHash) {
+		t.Errorf("wrong entries %+v", got.EBEntries)
+	}
+}
+
+func TestEntry(t *testing.T) {
+	e := NewEntry(common.Sha([]byte("chain")), [][]byte{[]byte("id")}, []byte("data"))
+	hash := common.Sha([]byte("entry"))
+	server, client := newTestServer(serveJSON(t, "/v1/entry/"+hash.String(), e))
+	defer server.Close()
+
+	got, err := client.Entry(context.Background(), hash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.ChainID.IsSameAs(e.ChainID) || len(got.ExtIDs) != 1 || string(got.ExtIDs[0]) != "id" ||
+		string(got.Data) != "data" {
+		t.Errorf("wrong entry %+v", got)
+	}
+}
+
+func TestChain(t *testing.T) {
+	ch, err := NewChain([][]byte{[]byte("test"), []byte("chain")}, []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch.EBlockCount = 4
+	ch.EntryCount = 9
+	server, client := newTestServer(serveJSON(t, "/v1/chain/"+ch.ChainID.String(), ch))
+	defer server.Close()
+
+	got, err := client.Chain(context.Background(), ch.ChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.ChainID.IsSameAs(ch.ChainID) || len(got.Name) != 2 || string(got.Name[1]) != "chain" ||
+		got.EBlockCount != 4 || got.EntryCount != 9 {
+		t.Errorf("wrong chain %+v", got)
+	}
+}
+
+func TestCreditBalance(t *testing.T) {
+	pubKey := common.Sha([]byte("key"))
+	balance := &common.ECBalance{PublicKey: pubKey, Credits: 150}
+	server, client := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/creditbalance" || r.FormValue("pubkey") != pubKey.String() {
+			t.Errorf("requested %s", r.URL.String())
+		}
+		if err := factomapi.SafeMarshal(w, balance); err != nil {
+			t.Error(err)
+		}
+	})
+	defer server.Close()
+
+	got, err := client.CreditBalance(context.Background(), pubKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Credits != 150 || !got.PublicKey.IsSameAs(pubKey) {
+		t.Errorf("wrong balance %+v", got)
+	}
+
+	// A bad response is an error
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{"))
+	})
+	if _, err := client.CreditBalance(context.Background(), pubKey); err == nil {
+		t.Errorf("bad json decoded")
+	}
+}
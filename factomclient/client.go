@@ -0,0 +1,166 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// Package factomclient talks to the wsapi of a factomd node. Entries, chains
+// and their commits are built and signed on the client, so the Entry Credit
+// key never has to be given to the node.
+package factomclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/FactomProject/FactomCode/common"
+	"github.com/FactomProject/gocoding"
+	"github.com/FactomProject/gocoding/json"
+)
+
+// APIError is returned for a request the server answered with an error
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("factomd returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Client sends requests to one factomd wsapi server
+type Client struct {
+	// Server is the host:port of the wsapi
+	Server string
+
+	// HTTPClient is used for all requests
+	HTTPClient *http.Client
+
+	// Retries is the number of times a GET request is repeated after a
+	// network error or a 5xx response. Commits and reveals are sent once, as
+	// one repeated after it reached the server is refused as a replay.
+	Retries int
+
+	// RetryDelay is the pause before the first retry. It doubles for every
+	// further retry.
+	RetryDelay time.Duration
+
+	// RevealDelay is the pause between a commit and its reveal, giving the
+	// server time to process the commit first.
+	RevealDelay time.Duration
+}
+
+// NewClient returns a Client for the wsapi at server, e.g. "localhost:8088"
+func NewClient(server string) *Client {
+	return &Client{
+		Server:      server,
+		HTTPClient:  http.DefaultClient,
+		Retries:     3,
+		RetryDelay:  500 * time.Millisecond,
+		RevealDelay: time.Second,
+	}
+}
+
+// get requests path and decodes the json response into obj
+func (c *Client) get(ctx context.Context, path string, obj interface{}) error {
+	body, err := c.do(ctx, "GET", path, nil)
+	if err != nil {
+		return err
+	}
+
+	return unmarshalJSON(body, obj)
+}
+
+// post sends form to path once and returns the response body
+func (c *Client) post(ctx context.Context, path string, form url.Values) ([]byte, error) {
+	return c.do(ctx, "POST", path, form)
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, form url.Values) ([]byte, error) {
+	u := fmt.Sprintf("http://%s/v1/%s", c.Server, path)
+
+	retries := c.Retries
+	if method == "POST" {
+		retries = 0
+	}
+
+	delay := c.RetryDelay
+	var err error
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		var body []byte
+		body, err = c.send(ctx, method, u, form)
+		if err == nil {
+			return body, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if apiErr, ok := err.(*APIError); ok && apiErr.StatusCode < 500 {
+			return nil, err
+		}
+	}
+
+	return nil, err
+}
+
+// send makes a single request
+func (c *Client) send(ctx context.Context, method string, u string, form url.Values) ([]byte, error) {
+	var req *http.Request
+	var err error
+	if method == "POST" {
+		req, err = http.NewRequest(method, u, strings.NewReader(form.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		req, err = http.NewRequest(method, u, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(body)),
+		}
+	}
+
+	return body, nil
+}
+
+func unmarshalJSON(data []byte, obj interface{}) error {
+	scanner := json.Scan(gocoding.ReadBytes(data))
+	scanner.SetRecoverHandler(func(obj interface{}) error {
+		if err, ok := obj.(error); ok {
+			return err
+		}
+		return errors.New(fmt.Sprint(obj))
+	})
+
+	return common.NewJSONUnmarshaller().Unmarshal(scanner, obj)
+}
@@ -0,0 +1,159 @@
+package factomclient
+
+import (
+	"context"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+func newTestServer(handler http.HandlerFunc) (*httptest.Server, *Client) {
+	server := httptest.NewServer(handler)
+	client := NewClient(strings.TrimPrefix(server.URL, "http://"))
+	client.RetryDelay = time.Millisecond
+	client.RevealDelay = 0
+	return server, client
+}
+
+func TestNewChainCommit(t *testing.T) {
+	key := new(common.PrivateKey)
+	if err := key.GenerateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	ch, err := NewChain([][]byte{[]byte("test"), []byte("chain")}, []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ch.FirstEntry.ChainID.IsSameAs(ch.ChainID) {
+		t.Errorf("first entry is not in the new chain")
+	}
+
+	commit, err := NewCommitChain(ch, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !commit.VerifySignature() {
+		t.Errorf("chain commit signature does not verify")
+	}
+	if commit.Credits != common.ChainCredits(0) {
+		t.Errorf("chain commit pays %d credits", commit.Credits)
+	}
+}
+
+func TestSubmitEntry(t *testing.T) {
+	key := new(common.PrivateKey)
+	if err := key.GenerateKey(); err != nil {
+		t.Fatal(err)
+	}
+
+	var commit *common.CommitEntry
+	var entry *common.Entry
+	server, client := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/commitentry":
+			data, _ := hex.DecodeString(r.FormValue("commit"))
+			commit = new(common.CommitEntry)
+			if err := commit.UnmarshalBinary(data); err != nil {
+				t.Error(err)
+			}
+		case "/v1/revealentry":
+			data, _ := hex.DecodeString(r.FormValue("entry"))
+			entry = new(common.Entry)
+			if err := entry.UnmarshalBinary(data); err != nil {
+				t.Error(err)
+			}
+		}
+	})
+	defer server.Close()
+
+	e := NewEntry(common.NewHash(), [][]byte{[]byte("id")}, []byte("data"))
+	hash, err := client.SubmitEntry(context.Background(), e, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if commit == nil || !commit.VerifySignature() {
+		t.Fatalf("server did not get a valid commit")
+	}
+	if entry == nil || string(entry.Data) != "data" {
+		t.Fatalf("server did not get the entry")
+	}
+	if !commit.EntryHash.IsSameAs(hash) {
+		t.Errorf("commit is for a different entry")
+	}
+}
+
+func TestRetries(t *testing.T) {
+	calls := 0
+	server, client := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("42"))
+	})
+	defer server.Close()
+
+	height, err := client.DBlockHeight(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if height != 42 || calls != 3 {
+		t.Errorf("got height %d after %d calls", height, calls)
+	}
+
+	calls = 0
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("Bad Request"))
+	})
+	_, err = client.DBlockHeight(context.Background())
+	if apiErr, ok := err.(*APIError); !ok || apiErr.StatusCode != http.StatusBadRequest {
+		t.Errorf("got error %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("client error was retried")
+	}
+
+	// A commit is not sent again, it may have reached the server
+	calls = 0
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	commit := new(common.CommitEntry)
+	commit.EntryHash = common.NewHash()
+	commit.ECPubKey = common.NewHash()
+	if err := client.CommitEntry(context.Background(), commit); err == nil {
+		t.Errorf("failed commit succeeded")
+	}
+	if calls != 1 {
+		t.Errorf("commit sent %d times", calls)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	server, client := newTestServer(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	defer server.Close()
+	client.RetryDelay = time.Hour
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	if _, err := client.DBlockHeight(ctx); err != context.Canceled {
+		t.Errorf("got error %v, expected cancellation", err)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package factomclient
+
+import (
+	"errors"
+	"time"
+
+	"github.com/FactomProject/FactomCode/common"
+)
+
+// NewEntry returns an entry for the chain chainID
+func NewEntry(chainID *common.Hash, extIDs [][]byte, data []byte) *common.Entry {
+	e := new(common.Entry)
+	e.ChainID = chainID
+	e.ExtIDs = extIDs
+	e.Data = data
+
+	return e
+}
+
+// NewChain returns a new chain called name, with a first entry holding data.
+// The name is used as the External IDs of the first entry, which is how the
+// server checks the ChainID when the chain is revealed.
+func NewChain(name [][]byte, data []byte) (*common.EChain, error) {
+	chainID, err := common.GetChainID(name)
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(common.EChain)
+	c.ChainID = chainID
+	c.Name = name
+	c.FirstEntry = NewEntry(chainID, name, data)
+
+	return c, nil
+}
+
+// NewCommitEntry returns a commit for e paying for its size, signed by key
+func NewCommitEntry(e *common.Entry, key common.Signer) (*common.CommitEntry, error) {
+	bEntry, err := e.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	c := new(common.CommitEntry)
+	c.Timestamp = uint64(time.Now().Unix())
+	c.EntryHash = common.Sha(bEntry)
+	c.Credits = common.EntryCredits(len(bEntry))
+
+	if err := c.Sign(key); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// NewCommitChain returns a commit for ch and its first entry, signed by key
+func NewCommitChain(ch *common.EChain, key common.Signer) (*common.CommitChain, error) {
+	if ch.FirstEntry == nil {
+		return nil, errors.New("The first entry is required for committing a chain")
+	}
+
+	bEntry, err := ch.FirstEntry.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	entryHash := common.Sha(bEntry)
+
+	c := new(common.CommitChain)
+	c.Timestamp = uint64(time.Now().Unix())
+	c.ChainID = ch.ChainID
+	c.EntryHash = entryHash
+	c.EntryChainIDHash = common.GetEntryChainIDHash(ch.ChainID, entryHash)
+	c.Credits = common.ChainCredits(len(bEntry))
+
+	if err := c.Sign(key); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
@@ -5,9 +5,15 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"github.com/FactomProject/FactomCode/common"
 	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/cachedb"
+	"github.com/FactomProject/FactomCode/database/dbsync"
 	"github.com/FactomProject/FactomCode/database/ldb"
+	"github.com/FactomProject/FactomCode/database/lightdb"
+	"github.com/FactomProject/FactomCode/factomclient"
 	"github.com/FactomProject/FactomCode/util"
 	"github.com/FactomProject/FactomCode/wsapi"
 	"github.com/FactomProject/btcd"
@@ -16,6 +22,7 @@ import (
 	"log"
 	"os"
 	"runtime"
+	"time"
 )
 
 var (
@@ -86,6 +93,16 @@ func init() {
 
 func factomdMain() error {
 
+	// Catch up with the block chain of a peer before starting. A light node
+	// does not keep the blocks a sync downloads, so it does not sync.
+	if cfg.Sync.PeerServer != "" && cfg.App.NodeMode == common.LIGHT_NODE {
+		log.Println("Sync from " + cfg.Sync.PeerServer + " skipped: a light node cannot sync")
+	} else if cfg.Sync.PeerServer != "" {
+		if err := syncDB(cfg.Sync.PeerServer); err != nil {
+			log.Println("Sync from "+cfg.Sync.PeerServer+" stopped: ", err)
+		}
+	}
+
 	// Start the processor module
 	go btcd.Start_Processor(db, inMsgQueue, outMsgQueue, inCtlMsgQueue, outCtlMsgQueue, doneFBlockQueue)
 
@@ -107,6 +124,18 @@ func loadConfigurations() {
 	federatedid = cfg.App.FederatedId
 	btcd.LoadConfigurations(cfg)
 
+	fees := common.FeeSchedule{
+		CreditsPerKB:    uint32(cfg.EntryCredit.CreditsPerKB),
+		CreditsPerChain: uint32(cfg.EntryCredit.CreditsPerChain),
+	}
+	if err := common.SetFeeSchedule(fees); err != nil {
+		log.Println("Using the default Entry Credit prices: ", err)
+	}
+	window := time.Duration(cfg.EntryCredit.CommitWindowInSeconds) * time.Second
+	if err := common.SetCommitWindow(window); err != nil {
+		log.Println("Using the default commit window: ", err)
+	}
+
 	fmt.Println("CHECK cfg= ", cfg)
 }
 
@@ -115,7 +144,7 @@ func initDB() {
 
 	//init db
 	var err error
-	db, err = ldb.OpenLevelDB(ldbpath, false)
+	db, err = ldb.OpenLevelDBWithOptions(ldbpath, false, ldb.ConfigOptions(cfg))
 
 	if err != nil {
 		log.Printf("err opening db: %v\n", err)
@@ -124,7 +153,7 @@ func initDB() {
 
 	if db == nil {
 		log.Println("Creating new db ...")
-		db, err = ldb.OpenLevelDB(ldbpath, true)
+		db, err = ldb.OpenLevelDBWithOptions(ldbpath, true, ldb.ConfigOptions(cfg))
 
 		if err != nil {
 			panic(err)
@@ -132,4 +161,32 @@ func initDB() {
 	}
 	log.Println("Database started from: " + ldbpath)
 
+	// A light node keeps only the Directory Blocks, Admin Blocks and anchors,
+	// and gets the rest from a full node
+	if cfg.App.NodeMode == common.LIGHT_NODE {
+		client := factomclient.NewClient(cfg.Light.FullNodeServer)
+		light := lightdb.NewLightDb(db, client)
+		if cfg.Light.TimeoutInSeconds > 0 {
+			light.Timeout = time.Duration(cfg.Light.TimeoutInSeconds) * time.Second
+		}
+		db = light
+		log.Println("Light node fetching from: " + cfg.Light.FullNodeServer)
+	}
+
+	if cfg.Cache.Size > 0 {
+		db = cachedb.NewCacheDb(db, cfg.Cache.Size)
+	}
+
+}
+
+// Download the blocks after the local head from the wsapi of a peer
+func syncDB(server string) error {
+	syncer := dbsync.NewSyncer(db, factomclient.NewClient(server))
+	syncer.Progress = func(height uint32) {
+		log.Printf("Synced DBlock %d from %s\n", height, server)
+	}
+
+	synced, err := syncer.Sync(context.Background())
+	log.Printf("Synced %d DBlocks from %s\n", synced, server)
+	return err
 }
@@ -0,0 +1,240 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+// factomdb looks after the database of a factomd node that is not running.
+//
+//	factomdb [-ldb path] check
+//	factomdb [-ldb path] [-peer host:port] repair
+//	factomdb [-ldb path] reindex
+//	factomdb [-ldb path] stats
+//	factomdb [-ldb path] compact
+//	factomdb [-ldb path] backup file
+//	factomdb [-ldb path] restore file
+//	factomdb [-ldb path] [-seed n] [-chains n] [-chainsperblock n] [-entries n]
+//		[-minsize n] [-maxsize n] generate blocks
+//
+// check lists the blocks and entries that are referenced but missing, and
+// repair downloads them from the wsapi of a peer node. reindex builds the
+// height, merkle root, chain, public key and balance tables again from the
+// blocks and entries. stats counts the keys and bytes of each table, and
+// compact compacts the database on disk. backup writes every key and value to
+// a file, and restore makes a new database from one, reading it back to check
+// it. A running node is backed up from its wsapi, with
+//
+//	curl -o file http://localhost:8088/v1/backup
+//
+// generate makes a new database of made up Directory Blocks and the blocks and
+// entries they refer to, for performance work. The same flags always make the
+// same blocks.
+//
+// The defaults are the LdbPath, the database backend and tuning, and the sync
+// PeerServer of factomd.conf.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/FactomProject/FactomCode/database"
+	"github.com/FactomProject/FactomCode/database/dbgen"
+	"github.com/FactomProject/FactomCode/database/dbsync"
+	"github.com/FactomProject/FactomCode/database/ldb"
+	"github.com/FactomProject/FactomCode/factomclient"
+	"github.com/FactomProject/FactomCode/util"
+)
+
+func main() {
+	cfg := util.ReadConfig()
+
+	ldbPath := flag.String("ldb", cfg.App.LdbPath, "path of the leveldb database")
+	peer := flag.String("peer", cfg.Sync.PeerServer, "wsapi of the node to repair from")
+	gen := dbgen.DefaultConfig
+	flag.Int64Var(&gen.Seed, "seed", gen.Seed, "seed of the generated blocks")
+	flag.IntVar(&gen.Chains, "chains", gen.Chains, "number of generated chains")
+	flag.IntVar(&gen.ChainsPerBlock, "chainsperblock", gen.ChainsPerBlock, "chains with an Entry Block in each generated Directory Block")
+	flag.IntVar(&gen.EntriesPerEBlock, "entries", gen.EntriesPerEBlock, "entries in each generated Entry Block")
+	flag.IntVar(&gen.MinEntrySize, "minsize", gen.MinEntrySize, "least bytes of data of a generated entry")
+	flag.IntVar(&gen.MaxEntrySize, "maxsize", gen.MaxEntrySize, "most bytes of data of a generated entry")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: factomdb [flags] check|repair|reindex|stats|compact")
+		fmt.Fprintln(os.Stderr, "       factomdb [flags] backup|restore file")
+		fmt.Fprintln(os.Stderr, "       factomdb [flags] generate blocks")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cmd := flag.Arg(0)
+	if cmd == "backup" || cmd == "restore" || cmd == "generate" {
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+	} else if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// restore and generate make the database
+	if cmd == "restore" || cmd == "generate" {
+		var err error
+		if cmd == "restore" {
+			err = restore(flag.Arg(1), *ldbPath, ldb.ConfigOptions(cfg))
+		} else {
+			err = generate(flag.Arg(1), *ldbPath, ldb.ConfigOptions(cfg), gen)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	db, err := ldb.OpenLevelDBWithOptions(*ldbPath, false, ldb.ConfigOptions(cfg))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot open the database:", err)
+		os.Exit(1)
+	}
+	defer db.Close()
+
+	switch cmd {
+	case "check":
+		err = check(db)
+	case "repair":
+		err = repair(db, *peer)
+	case "reindex":
+		err = reindex(db)
+	case "stats":
+		err = stats(db)
+	case "compact":
+		err = db.Compact()
+	case "backup":
+		err = backup(db, flag.Arg(1))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		db.Close()
+		os.Exit(1)
+	}
+}
+
+func check(db database.Db) error {
+	missing, err := dbsync.Check(db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range missing {
+		fmt.Println(m.String())
+	}
+	fmt.Printf("%d missing\n", len(missing))
+	return nil
+}
+
+func repair(db database.Db, peer string) error {
+	if peer == "" {
+		return fmt.Errorf("No peer to repair from, use -peer")
+	}
+
+	missing, err := dbsync.Check(db)
+	if err != nil {
+		return err
+	}
+
+	syncer := dbsync.NewSyncer(db, factomclient.NewClient(peer))
+	repaired, err := syncer.Repair(context.Background(), missing)
+	fmt.Printf("%d of %d missing repaired from %s\n", repaired, len(missing), peer)
+	return err
+}
+
+func reindex(db database.Db) error {
+	return db.RebuildIndexes(func(table string, done int) {
+		fmt.Printf("%s: %d\n", table, done)
+	})
+}
+
+func stats(db database.Db) error {
+	stats, err := db.StorageStats()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%-18s %10s %14s %14s\n", "table", "keys", "bytes", "disk bytes")
+	for _, t := range stats.Tables {
+		fmt.Printf("%-18s %10d %14d %14d\n", t.Name, t.Keys, t.Bytes, t.DiskBytes)
+	}
+	fmt.Println(stats.Engine)
+	return nil
+}
+
+func backup(db database.Db, path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0640)
+	if err != nil {
+		return err
+	}
+
+	info, err := db.Backup(f)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	fmt.Printf("%d keys backed up to %s, hash %s\n", info.Keys, path, info.Hash)
+	return nil
+}
+
+func restore(path string, ldbPath string, options *ldb.Options) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := ldb.RestoreLevelDB(f, ldbPath, options)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d keys restored to %s and checked, hash %s\n", info.Keys, ldbPath, info.Hash)
+	return nil
+}
+
+func generate(blocks string, ldbPath string, options *ldb.Options, cfg dbgen.Config) error {
+	n, err := strconv.Atoi(blocks)
+	if err != nil || n < 1 {
+		return fmt.Errorf("Invalid number of Directory Blocks %s", blocks)
+	}
+	if _, err := os.Stat(ldbPath); err == nil {
+		return fmt.Errorf("%s exists already", ldbPath)
+	}
+
+	g, err := dbgen.New(cfg)
+	if err != nil {
+		return err
+	}
+	db, err := ldb.OpenLevelDBWithOptions(ldbPath, true, options)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	for int(g.Height()) < n {
+		count := n - int(g.Height())
+		if count > 1000 {
+			count = 1000
+		}
+		if err := g.Generate(db, count); err != nil {
+			return err
+		}
+		fmt.Printf("%d of %d Directory Blocks\n", g.Height(), n)
+	}
+	return nil
+}
@@ -16,6 +16,16 @@ type FactomdConfig struct {
 		DirectoryBlockInSeconds int
 		NodeMode                string
 		FederatedId             string
+
+		// DbBackend is the store of the database, leveldb or btree
+		DbBackend string
+
+		// leveldb tuning, 0 or "" for the default
+		LdbBlockCacheMB    int
+		LdbWriteBufferMB   int
+		LdbBloomFilterBits int
+		LdbCompression     string
+		LdbMaxOpenFiles    int
 	}
 	Btc struct {
 		BTCPubAddr         string
@@ -36,14 +46,31 @@ type FactomdConfig struct {
 		RefreshInSeconds int
 	}
 	Wsapi struct {
-		PortNumber       int
-		ApplicationName  string
-		RefreshInSeconds int
+		PortNumber        int
+		ApplicationName   string
+		RefreshInSeconds  int
+		SubmitQueueSize   int
+		SubmitJournalPath string
 	}
 	Log struct {
 		LogPath  string
 		LogLevel string
 	}
+	Sync struct {
+		PeerServer string
+	}
+	Light struct {
+		FullNodeServer   string
+		TimeoutInSeconds int
+	}
+	Cache struct {
+		Size int
+	}
+	EntryCredit struct {
+		CreditsPerKB          int
+		CreditsPerChain       int
+		CommitWindowInSeconds int
+	}
 
 	//	AddPeers     []string `short:"a" long:"addpeer" description:"Add a peer to connect with at startup"`
 	//	ConnectPeers []string `long:"connect" description:"Connect only to the specified peers at startup"`
@@ -68,6 +95,14 @@ DirectoryBlockInSeconds	= 60
 ;---- NodeMode - FULL,SERVER,LIGHT -----
 NodeMode				= FULL
 FederatedId				= "5706d2ebbc0e1dc7fb1df24d0b6fc6f2b3b35bb04ec316c4683c2"
+;---- DbBackend - leveldb,btree. btree keeps all of the database in memory -----
+DbBackend				= leveldb
+;---- leveldb tuning, 0 for the default. LdbCompression - none,snappy -----
+LdbBlockCacheMB			= 8
+LdbWriteBufferMB		= 4
+LdbBloomFilterBits		= 10
+LdbCompression			= none
+LdbMaxOpenFiles			= 500
 
 [btc]
 BTCPubAddr				= "movaFTARmsaTMk3j71MpX8HtMURpsKhdra"
@@ -86,6 +121,38 @@ RpcBtcdHost 			= "localhost:18334"
 ApplicationName			= "Factom/wsapi"
 PortNumber				= 8088
 RefreshInSeconds		= 60
+SubmitQueueSize			= 1000
+SubmitJournalPath		= "/tmp/store/submit/"
+
+; ------------------------------------------------------------------------------
+; The wsapi of a node to download the block chain from on startup, if any.
+; Full nodes only, a light node does not sync.
+; ------------------------------------------------------------------------------
+[sync]
+PeerServer				= ""
+
+; ------------------------------------------------------------------------------
+; Light node settings, used when NodeMode is LIGHT
+; ------------------------------------------------------------------------------
+[light]
+; The wsapi of the full node Entry Blocks and entries are fetched from
+FullNodeServer			= "localhost:8088"
+TimeoutInSeconds		= 30
+
+; ------------------------------------------------------------------------------
+; The number of recent blocks and entries kept decoded in memory, 0 for none
+; ------------------------------------------------------------------------------
+[cache]
+Size					= 10000
+
+; ------------------------------------------------------------------------------
+; Entry Credit prices, until changed by the admin chain
+; ------------------------------------------------------------------------------
+[entrycredit]
+CreditsPerKB			= 1
+CreditsPerChain			= 10
+; How far the timestamp of a commit may be from the time it is received
+CommitWindowInSeconds	= 3600
 
 ; ------------------------------------------------------------------------------
 ; LogLevel - debug,info,notice,warning,error,critical,alert,emergency,none
@@ -0,0 +1,108 @@
+// Copyright 2015 Factom Foundation
+// Use of this source code is governed by the MIT
+// license that can be found in the LICENSE file.
+
+package wsapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/FactomProject/FactomCode/database"
+)
+
+// eventBufferSize is the number of events held for a slow event stream
+// client before further events are dropped for it.
+const eventBufferSize = 100
+
+// eventFilter selects the database events sent to one event stream client.
+// An empty set matches everything.
+type eventFilter struct {
+	types    map[database.EventType]bool
+	chainIDs map[string]bool
+}
+
+// newEventFilter builds a filter from the comma separated "types" and
+// "chainid" request parameters.
+func newEventFilter(types string, chainIDs string) (*eventFilter, error) {
+	f := &eventFilter{
+		types:    make(map[database.EventType]bool),
+		chainIDs: make(map[string]bool),
+	}
+
+	for _, name := range splitParam(types) {
+		t, ok := database.ParseEventType(name)
+		if !ok {
+			return nil, fmt.Errorf("Unknown event type %q", name)
+		}
+		f.types[t] = true
+	}
+
+	for _, id := range splitParam(chainIDs) {
+		f.chainIDs[strings.ToLower(id)] = true
+	}
+
+	return f, nil
+}
+
+// match reports whether e passes the filter. The chain filter only applies
+// to EBlock and entry events, which are the ones that carry a ChainID.
+func (f *eventFilter) match(e *database.Event) bool {
+	if len(f.types) > 0 && !f.types[e.Type] {
+		return false
+	}
+
+	if len(f.chainIDs) > 0 && (e.Type == database.EventEBlock || e.Type == database.EventEntry) {
+		if e.ChainID == nil || !f.chainIDs[e.ChainID.String()] {
+			return false
+		}
+	}
+
+	return true
+}
+
+type eventJSON struct {
+	Type    string `json:"type"`
+	Hash    string `json:"hash"`
+	KeyMR   string `json:"keymr,omitempty"`
+	ChainID string `json:"chainid,omitempty"`
+	Height  uint32 `json:"height"`
+}
+
+// writeEvent writes e to w as a Server-Sent Event named after the event type
+// with a json data field.
+func writeEvent(w io.Writer, e *database.Event) error {
+	j := eventJSON{
+		Type:   e.Type.String(),
+		Height: e.Height,
+	}
+	if e.Hash != nil {
+		j.Hash = e.Hash.String()
+	}
+	if e.KeyMR != nil {
+		j.KeyMR = e.KeyMR.String()
+	}
+	if e.ChainID != nil {
+		j.ChainID = e.ChainID.String()
+	}
+
+	data, err := json.Marshal(j)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", j.Type, data)
+	return err
+}
+
+func splitParam(param string) []string {
+	values := make([]string, 0)
+	for _, v := range strings.Split(param, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
+	"net/http"
 	"net/url"
 	"strconv"
 	"time"
@@ -109,9 +110,623 @@ func handleChainByHash(ctx *web.Context, hash string) {
 		log.Error(err)
 		return
 	}
+	if chain == nil {
+		httpcode = 404
+		buf.WriteString("Chain not found")
+		return
+	}
+
+	// Send back JSON response
+	err = factomapi.SafeMarshal(buf, chain)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request ")
+		log.Error(err)
+		return
+	}
+}
+
+// handleChainEntries returns a page of the entries of a chain in json format.
+// The optional parameters are order (newest or oldest), cursor, limit, and a
+// range of Directory Block heights from and to.
+func handleChainEntries(ctx *web.Context, chainID string) {
+	log := serverLog
+	log.Debug("handleChainEntries")
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	hash, err := common.HexToHash(chainID)
+	if err != nil || len(hash.Bytes) != common.HASH_LENGTH {
+		httpcode = 400
+		buf.WriteString("Bad ChainID")
+		log.Error(err)
+		return
+	}
+
+	q := new(factomapi.ChainEntriesQuery)
+	switch ctx.Params["order"] {
+	case "", "newest":
+	case "oldest":
+		q.OldestFirst = true
+	default:
+		httpcode = 400
+		buf.WriteString("Bad order, use newest or oldest")
+		return
+	}
+	q.Cursor = ctx.Params["cursor"]
+
+	if s := ctx.Params["limit"]; s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil {
+			httpcode = 400
+			buf.WriteString("Bad limit")
+			log.Error(err)
+			return
+		}
+	}
+	if s := ctx.Params["from"]; s != "" {
+		h, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			httpcode = 400
+			buf.WriteString("Bad from height")
+			log.Error(err)
+			return
+		}
+		q.FromHeight = uint32(h)
+	}
+	if s := ctx.Params["to"]; s != "" {
+		h, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			httpcode = 400
+			buf.WriteString("Bad to height")
+			log.Error(err)
+			return
+		}
+		q.ToHeight = uint32(h)
+	}
+
+	entries, err := factomapi.GetChainEntries(hash, q)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad Request")
+		log.Error(err)
+		return
+	}
+
+	// Send back JSON response
+	err = factomapi.SafeMarshal(buf, entries)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request ")
+		log.Error(err)
+		return
+	}
+}
+
+// handleChains will return all chains from the backend database
+func handleChains(ctx *web.Context) {
+	log := serverLog
+	log.Debug("handleChains")
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	chains, err := factomapi.GetAllChains()
+	log.Debugf("Got %d chains", len(chains))
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad Request")
+		log.Error(err)
+		return
+	}
+
+	// Send back JSON response
+	for _, v := range chains {
+		err = factomapi.SafeMarshal(buf, v)
+		if err != nil {
+			log.Error(err)
+			break
+		}
+	}
+
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request ")
+		log.Error(err)
+		return
+	}
+}
+
+// handleCommitChain takes a hex encoded binary chain commit, built and signed
+// by the client, and submits it to factomapi.
+func handleCommitChain(ctx *web.Context) {
+	log := serverLog
+	log.Debug("handleCommitChain")
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	data, err := hex.DecodeString(ctx.Params["commit"])
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad commit encoding")
+		log.Error(err)
+		return
+	}
+
+	c := new(common.CommitChain)
+	if err := c.UnmarshalBinary(data); err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request ")
+		log.Error(err)
+		return
+	}
+
+	if err := factomapi.SubmitCommitChain(c); err != nil {
+		httpcode = submitErrorCode(err)
+		fmt.Fprintln(buf, "there was a problem with submitting the commit:", err)
+		log.Error(err)
+		return
+	}
+
+	fmt.Fprintln(buf, "Chain Commit Submitted")
+}
+
+// handleCommitEntry takes a hex encoded binary entry commit, built and signed
+// by the client, and submits it to factomapi.
+func handleCommitEntry(ctx *web.Context) {
+	log := serverLog
+	log.Debug("handleCommitEntry")
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	data, err := hex.DecodeString(ctx.Params["commit"])
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad commit encoding")
+		log.Error(err)
+		return
+	}
+
+	c := new(common.CommitEntry)
+	if err := c.UnmarshalBinary(data); err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request ")
+		log.Error(err)
+		return
+	}
+
+	if err := factomapi.SubmitCommitEntry(c); err != nil {
+		httpcode = submitErrorCode(err)
+		fmt.Fprintln(buf, "there was a problem with submitting the commit:", err)
+		log.Error(err)
+		return
+	}
+
+	fmt.Fprintln(buf, "Entry Commit Submitted")
+}
+
+// handleCBlockByHash will take an entry credit block hash and return the entry
+// credit block in json format.
+func handleCBlockByHash(ctx *web.Context, hashStr string) {
+	log := serverLog
+	log.Debug("handleCBlockByHash")
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	block, err := factomapi.GetEntryCreditBlokByHashStr(hashStr)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad Request")
+		log.Error(err)
+		return
+	}
+	if block == nil {
+		httpcode = 404
+		buf.WriteString("ECBlock not found")
+		return
+	}
+
+	// Send back JSON response
+	err = factomapi.SafeMarshal(buf, block)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request ")
+		log.Error(err)
+		return
+	}
+}
+
+// handleCBlockByHeight will take an entry credit block height and return the
+// entry credit block in json format.
+func handleCBlockByHeight(ctx *web.Context, heightStr string) {
+	log := serverLog
+	log.Debug("handleCBlockByHeight")
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	height, err := strconv.ParseUint(heightStr, 10, 32)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad height")
+		log.Error(err)
+		return
+	}
+
+	block, err := factomapi.GetEntryCreditBlokByHeight(height)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad Request")
+		log.Error(err)
+		return
+	}
+	if block == nil {
+		httpcode = 404
+		buf.WriteString("ECBlock not found")
+		return
+	}
+
+	// Send back JSON response
+	err = factomapi.SafeMarshal(buf, block)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request ")
+		log.Error(err)
+		return
+	}
+}
+
+// handleCBlocksByRange will get a block height range and return all of the
+// entry credit blocks within the range in json format.
+func handleCBlocksByRange(ctx *web.Context, fromHeightStr string,
+	toHeightStr string) {
+	log := serverLog
+	log.Debug("handleCBlocksByRange")
+
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	fromBlockHeight, err := strconv.ParseUint(fromHeightStr, 10, 32)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad fromBlockHeight")
+		log.Error(err)
+		return
+	}
+	toBlockHeight := fromBlockHeight
+	if toHeightStr != "" {
+		toBlockHeight, err = strconv.ParseUint(toHeightStr, 10, 32)
+		if err != nil {
+			httpcode = 400
+			buf.WriteString("Bad toBlockHeight")
+			log.Error(err)
+			return
+		}
+	}
+
+	cBlocks, err := factomapi.GetEntryCreditBloks(uint32(fromBlockHeight),
+		uint32(toBlockHeight))
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request")
+		log.Error(err)
+		return
+	}
+
+	// Send back JSON response
+	err = factomapi.SafeMarshal(buf, cBlocks)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request")
+		log.Error(err)
+		return
+	}
+}
+
+// handleCreditBalance will return the current entry credit balance of the
+// spesified pubKey
+func handleCreditBalance(ctx *web.Context) {
+	log := serverLog
+	log.Debug("handleGetCreditBalance")
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	ecPubKey := new(common.Hash)
+	if ctx.Params["pubkey"] == "wallet" {
+		ecPubKey.Bytes = (*wallet.ClientPublicKey().Key)[:]
+	} else {
+		p, err := hex.DecodeString(ctx.Params["pubkey"])
+		if err != nil {
+			log.Error(err)
+		}
+		ecPubKey.Bytes = p
+	}
+
+	log.Info("handleGetCreditBalance using pubkey: ", ecPubKey,
+		" requested", ctx.Params["pubkey"])
+
+	balance, err := factomapi.GetEntryCreditBalance(ecPubKey)
+	if err != nil {
+		log.Error(err)
+	}
+
+	ecBalance := new(common.ECBalance)
+	ecBalance.Credits = int(balance)
+	ecBalance.PublicKey = ecPubKey
+
+	log.Info("Balance for pubkey ", ctx.Params["pubkey"], " is: ", balance)
+
+	// Send back JSON response
+	err = factomapi.SafeMarshal(buf, ecBalance)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request ")
+		log.Error(err)
+		return
+	}
+}
+
+// handleDBlockByHash will take a directory block hash and return the directory
+// block information in json format.
+func handleDBlockByHash(ctx *web.Context, hashStr string) {
+	log := serverLog
+	log.Debug("handleDBlockByHash")
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	dBlock, err := factomapi.GetDirectoryBlokByHashStr(hashStr)
+	log.Debug(dBlock)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad Request")
+		log.Error(err)
+		return
+	}
+
+	// Send back JSON response
+	err = factomapi.SafeMarshal(buf, dBlock)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request ")
+		log.Error(err)
+		return
+	}
+}
+
+// handleDBlockByHeight will take a directory block height and return the
+// directory block in json format.
+func handleDBlockByHeight(ctx *web.Context, heightStr string) {
+	log := serverLog
+	log.Debug("handleDBlockByHeight")
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	height, err := strconv.ParseUint(heightStr, 10, 32)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad height")
+		log.Error(err)
+		return
+	}
+
+	block, err := factomapi.GetDirectoryBlokByHeight(height)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad Request")
+		log.Error(err)
+		return
+	}
+	if block == nil {
+		httpcode = 404
+		buf.WriteString("DBlock not found")
+		return
+	}
+
+	// Send back JSON response
+	err = factomapi.SafeMarshal(buf, block)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request ")
+		log.Error(err)
+		return
+	}
+}
+
+// handleDBInfoByHash will take a Directory Block Hash and return the directory
+// block information in json format.
+func handleDBInfoByHash(ctx *web.Context, hashStr string) {
+	log := serverLog
+	log.Debug("handleDBInfoByHash")
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	dBInfo, err := factomapi.GetDBInfoByHashStr(hashStr)
+	log.Debug(dBInfo)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad Request")
+		log.Error(err)
+		return
+	}
+
+	// Send back JSON response
+	err = factomapi.SafeMarshal(buf, dBInfo)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request ")
+		log.Error(err)
+		return
+	}
+}
+
+// handleDBlockByRange will get a block height range and return the information
+// for all of the directory blocks within the range in json format.
+func handleDBlocksByRange(ctx *web.Context, fromHeightStr string,
+	toHeightStr string) {
+	log := serverLog
+	log.Debug("handleDBlocksByRange")
+
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	fromBlockHeight, err := strconv.Atoi(fromHeightStr)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad fromBlockHeight")
+		log.Error(err)
+		return
+	}
+	toBlockHeight, err := strconv.Atoi(toHeightStr)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad toBlockHeight")
+		log.Error(err)
+		return
+	}
+
+	dBlocks, err := factomapi.GetDirectoryBloks(uint32(fromBlockHeight),
+		uint32(toBlockHeight))
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request")
+		log.Error(err)
+		return
+	}
+
+	// Send back JSON response
+	for _, block := range dBlocks {
+		err = factomapi.SafeMarshal(buf, &block)
+		if err != nil {
+			httpcode = 400
+			buf.WriteString("Bad request")
+			log.Error(err)
+			return
+		}
+	}
+}
+
+func handleEBlockByHash(ctx *web.Context, hashStr string) {
+	log := serverLog
+	log.Debug("handleEBlockByHash")
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	eBlock, err := factomapi.GetEntryBlokByHashStr(hashStr)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad Request")
+		log.Error(err)
+		return
+	}
+
+	// Send back JSON response
+	err = factomapi.SafeMarshal(buf, eBlock)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request")
+		log.Error(err)
+		return
+	}
+}
+
+// handleEBlockByHeight will take an entry block height and return the
+// entry block in json format.
+func handleEBlockByHeight(ctx *web.Context, chainID string, heightStr string) {
+	log := serverLog
+	log.Debug("handleEBlockByHeight")
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	height, err := strconv.ParseUint(heightStr, 10, 32)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad height")
+		log.Error(err)
+		return
+	}
+
+	block, err := factomapi.GetEntryBlokByHeight(chainID, height)
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad Request")
+		log.Error(err)
+		return
+	}
+	if block == nil {
+		httpcode = 404
+		buf.WriteString("EBlock not found")
+		return
+	}
 
 	// Send back JSON response
-	err = factomapi.SafeMarshal(buf, chain)
+	err = factomapi.SafeMarshal(buf, block)
 	if err != nil {
 		httpcode = 400
 		buf.WriteString("Bad request ")
@@ -120,10 +735,9 @@ func handleChainByHash(ctx *web.Context, hash string) {
 	}
 }
 
-// handleChains will return all chains from the backend database
-func handleChains(ctx *web.Context) {
+func handleEBlockByMR(ctx *web.Context, mrStr string) {
 	log := serverLog
-	log.Debug("handleChains")
+	log.Debug("handleEBlockByMR")
 	var httpcode int = 200
 	buf := new(bytes.Buffer)
 
@@ -131,9 +745,10 @@ func handleChains(ctx *web.Context) {
 		ctx.WriteHeader(httpcode)
 		ctx.Write(buf.Bytes())
 	}()
-
-	chains, err := factomapi.GetAllChains()
-	log.Debugf("Got %d chains", len(chains))
+	log.Info("mrstr:", mrStr)
+	newstr, _ := url.QueryUnescape(mrStr)
+	log.Info("newstr:", newstr)
+	eBlock, err := factomapi.GetEntryBlokByMRStr(newstr)
 	if err != nil {
 		httpcode = 400
 		buf.WriteString("Bad Request")
@@ -142,27 +757,20 @@ func handleChains(ctx *web.Context) {
 	}
 
 	// Send back JSON response
-	for _, v := range chains {
-		err = factomapi.SafeMarshal(buf, v)
-		if err != nil {
-			log.Error(err)
-			break
-		}
-	}
-
+	err = factomapi.SafeMarshal(buf, eBlock)
 	if err != nil {
 		httpcode = 400
-		buf.WriteString("Bad request ")
+		buf.WriteString("Bad request")
 		log.Error(err)
 		return
 	}
 }
 
-// handleCreditBalance will return the current entry credit balance of the
-// spesified pubKey
-func handleCreditBalance(ctx *web.Context) {
+// handleECAddressHistory will take an entry credit public key and return every
+// purchase and payment of entry credits by the key in json format.
+func handleECAddressHistory(ctx *web.Context, pubKeyStr string) {
 	log := serverLog
-	log.Debug("handleGetCreditBalance")
+	log.Debug("handleECAddressHistory")
 	var httpcode int = 200
 	buf := new(bytes.Buffer)
 
@@ -171,33 +779,16 @@ func handleCreditBalance(ctx *web.Context) {
 		ctx.Write(buf.Bytes())
 	}()
 
-	ecPubKey := new(common.Hash)
-	if ctx.Params["pubkey"] == "wallet" {
-		ecPubKey.Bytes = (*wallet.ClientPublicKey().Key)[:]
-	} else {
-		p, err := hex.DecodeString(ctx.Params["pubkey"])
-		if err != nil {
-			log.Error(err)
-		}
-		ecPubKey.Bytes = p
-	}
-
-	log.Info("handleGetCreditBalance using pubkey: ", ecPubKey,
-		" requested", ctx.Params["pubkey"])
-
-	balance, err := factomapi.GetEntryCreditBalance(ecPubKey)
+	txs, err := factomapi.GetEntryCreditHistory(pubKeyStr)
 	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad Request")
 		log.Error(err)
+		return
 	}
 
-	ecBalance := new(common.ECBalance)
-	ecBalance.Credits = balance
-	ecBalance.PublicKey = ecPubKey
-
-	log.Info("Balance for pubkey ", ctx.Params["pubkey"], " is: ", balance)
-
 	// Send back JSON response
-	err = factomapi.SafeMarshal(buf, ecBalance)
+	err = factomapi.SafeMarshal(buf, txs)
 	if err != nil {
 		httpcode = 400
 		buf.WriteString("Bad request ")
@@ -206,11 +797,12 @@ func handleCreditBalance(ctx *web.Context) {
 	}
 }
 
-// handleDBlockByHash will take a directory block hash and return the directory
-// block information in json format.
-func handleDBlockByHash(ctx *web.Context, hashStr string) {
+// handleECBalanceProof will take an entry credit public key and return its
+// balance with a proof against the BalanceMR of the latest entry credit block
+// in json format.
+func handleECBalanceProof(ctx *web.Context, pubKeyStr string) {
 	log := serverLog
-	log.Debug("handleDBlockByHash")
+	log.Debug("handleECBalanceProof")
 	var httpcode int = 200
 	buf := new(bytes.Buffer)
 
@@ -219,17 +811,21 @@ func handleDBlockByHash(ctx *web.Context, hashStr string) {
 		ctx.Write(buf.Bytes())
 	}()
 
-	dBlock, err := factomapi.GetDirectoryBlokByHashStr(hashStr)
-	log.Debug(dBlock)
+	proof, err := factomapi.GetEntryCreditBalanceProof(pubKeyStr)
 	if err != nil {
 		httpcode = 400
 		buf.WriteString("Bad Request")
 		log.Error(err)
 		return
 	}
+	if proof == nil {
+		httpcode = 404
+		buf.WriteString("No balance for the public key")
+		return
+	}
 
 	// Send back JSON response
-	err = factomapi.SafeMarshal(buf, dBlock)
+	err = factomapi.SafeMarshal(buf, proof)
 	if err != nil {
 		httpcode = 400
 		buf.WriteString("Bad request ")
@@ -238,11 +834,12 @@ func handleDBlockByHash(ctx *web.Context, hashStr string) {
 	}
 }
 
-// handleDBInfoByHash will take a Directory Block Hash and return the directory
-// block information in json format.
-func handleDBInfoByHash(ctx *web.Context, hashStr string) {
+// handleEntryCost quotes the price of an entry given as a hex encoded binary
+// "entry", of a new chain given its hex encoded binary first entry as "chain",
+// or of an entry of "size" bytes, a new chain if "newchain" is true.
+func handleEntryCost(ctx *web.Context) {
 	log := serverLog
-	log.Debug("handleDBInfoByHash")
+	log.Debug("handleEntryCost")
 	var httpcode int = 200
 	buf := new(bytes.Buffer)
 
@@ -251,17 +848,37 @@ func handleDBInfoByHash(ctx *web.Context, hashStr string) {
 		ctx.Write(buf.Bytes())
 	}()
 
-	dBInfo, err := factomapi.GetDBInfoByHashStr(hashStr)
-	log.Debug(dBInfo)
+	var size int
+	var newChain bool
+	var err error
+	if p, ok := ctx.Params["entry"]; ok {
+		size = len(p) / 2
+		_, err = hex.DecodeString(p)
+	} else if p, ok := ctx.Params["chain"]; ok {
+		size = len(p) / 2
+		newChain = true
+		_, err = hex.DecodeString(p)
+	} else {
+		size, err = strconv.Atoi(ctx.Params["size"])
+		newChain = ctx.Params["newchain"] == "true"
+	}
 	if err != nil {
 		httpcode = 400
-		buf.WriteString("Bad Request")
+		buf.WriteString("Bad entry or size")
+		log.Error(err)
+		return
+	}
+
+	cost, err := factomapi.GetEntryCost(size, newChain)
+	if err != nil {
+		httpcode = 400
+		fmt.Fprintln(buf, err)
 		log.Error(err)
 		return
 	}
 
 	// Send back JSON response
-	err = factomapi.SafeMarshal(buf, dBInfo)
+	err = factomapi.SafeMarshal(buf, cost)
 	if err != nil {
 		httpcode = 400
 		buf.WriteString("Bad request ")
@@ -270,13 +887,9 @@ func handleDBInfoByHash(ctx *web.Context, hashStr string) {
 	}
 }
 
-// handleDBlockByRange will get a block height range and return the information
-// for all of the directory blocks within the range in json format.
-func handleDBlocksByRange(ctx *web.Context, fromHeightStr string,
-	toHeightStr string) {
+func handleEntryByHash(ctx *web.Context, hashStr string) {
 	log := serverLog
-	log.Debug("handleDBlocksByRange")
-
+	log.Debug("handleEBlockByMR")
 	var httpcode int = 200
 	buf := new(bytes.Buffer)
 
@@ -285,23 +898,39 @@ func handleDBlocksByRange(ctx *web.Context, fromHeightStr string,
 		ctx.Write(buf.Bytes())
 	}()
 
-	fromBlockHeight, err := strconv.Atoi(fromHeightStr)
+	entry, err := factomapi.GetEntryByHashStr(hashStr)
 	if err != nil {
 		httpcode = 400
-		buf.WriteString("Bad fromBlockHeight")
+		buf.WriteString("Bad Request")
 		log.Error(err)
 		return
 	}
-	toBlockHeight, err := strconv.Atoi(toHeightStr)
+
+	// Send back JSON response
+	err = factomapi.SafeMarshal(buf, entry)
 	if err != nil {
 		httpcode = 400
-		buf.WriteString("Bad toBlockHeight")
+		buf.WriteString("Bad request")
 		log.Error(err)
 		return
 	}
+}
 
-	dBlocks, err := factomapi.GetDirectoryBloks(uint32(fromBlockHeight),
-		uint32(toBlockHeight))
+// handleEntriesByExtID will get a series of entries and return them as a
+// stream of json objects.
+func handleEntriesByExtID(ctx *web.Context, eid string) {
+	log := serverLog
+	log.Debug("handleEntriesByExtID")
+
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	entries, err := factomapi.GetEntriesByExtID(eid)
 	if err != nil {
 		httpcode = 400
 		buf.WriteString("Bad request")
@@ -310,8 +939,8 @@ func handleDBlocksByRange(ctx *web.Context, fromHeightStr string,
 	}
 
 	// Send back JSON response
-	for _, block := range dBlocks {
-		err = factomapi.SafeMarshal(buf, &block)
+	for _, entry := range entries {
+		err = factomapi.SafeMarshal(buf, &entry)
 		if err != nil {
 			httpcode = 400
 			buf.WriteString("Bad request")
@@ -321,9 +950,80 @@ func handleDBlocksByRange(ctx *web.Context, fromHeightStr string,
 	}
 }
 
-func handleEBlockByHash(ctx *web.Context, hashStr string) {
+// handleEvents streams database events to the client as Server-Sent Events
+// until the client goes away. The optional "types" parameter is a comma
+// separated list of dblock, eblock, ecblock, entry and rollback, and "chainid"
+// a comma separated list of ChainIDs that EBlock and entry events are
+// limited to.
+func handleEvents(ctx *web.Context) {
 	log := serverLog
-	log.Debug("handleEBlockByHash")
+	log.Debug("handleEvents")
+
+	filter, err := newEventFilter(ctx.Params["types"], ctx.Params["chainid"])
+	if err != nil {
+		ctx.WriteHeader(400)
+		ctx.Write([]byte("Bad Request"))
+		log.Error(err)
+		return
+	}
+
+	flusher, ok := ctx.ResponseWriter.(http.Flusher)
+	if !ok {
+		ctx.WriteHeader(500)
+		ctx.Write([]byte("Streaming unsupported"))
+		log.Error("handleEvents: response writer cannot be flushed")
+		return
+	}
+
+	sub := factomapi.SubscribeEvents(eventBufferSize)
+	defer factomapi.UnsubscribeEvents(sub)
+
+	ctx.Header().Set("Content-Type", "text/event-stream")
+	ctx.Header().Set("Cache-Control", "no-cache")
+	ctx.WriteHeader(200)
+	flusher.Flush()
+
+	// The keep-alive comments let us notice clients that have disconnected
+	// while no events are coming in.
+	interval := time.Duration(refreshInSeconds) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	keepAlive := time.NewTicker(interval)
+	defer keepAlive.Stop()
+
+	done := ctx.Request.Context().Done()
+	for {
+		select {
+		case e, ok := <-sub.C():
+			if !ok {
+				// the database has been closed
+				return
+			}
+			if !filter.match(e) {
+				continue
+			}
+			if err := writeEvent(ctx, e); err != nil {
+				log.Debug("handleEvents: ", err)
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(ctx, ": keep-alive\n\n"); err != nil {
+				log.Debug("handleEvents: ", err)
+				return
+			}
+		case <-done:
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// handleQueueStats returns the depth and counters of the submission queue in
+// json format.
+func handleQueueStats(ctx *web.Context) {
+	log := serverLog
+	log.Debug("handleQueueStats")
 	var httpcode int = 200
 	buf := new(bytes.Buffer)
 
@@ -332,27 +1032,53 @@ func handleEBlockByHash(ctx *web.Context, hashStr string) {
 		ctx.Write(buf.Bytes())
 	}()
 
-	eBlock, err := factomapi.GetEntryBlokByHashStr(hashStr)
+	stats := factomapi.GetSubmitQueueStats()
+
+	// Send back JSON response
+	err := factomapi.SafeMarshal(buf, &stats)
 	if err != nil {
 		httpcode = 400
-		buf.WriteString("Bad Request")
+		buf.WriteString("Bad request ")
 		log.Error(err)
 		return
 	}
+}
+
+// handleCacheStats returns the hits, misses and size of the block and entry
+// cache in json format.
+func handleCacheStats(ctx *web.Context) {
+	log := serverLog
+	log.Debug("handleCacheStats")
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	stats := factomapi.GetCacheStats()
+	if stats == nil {
+		httpcode = 404
+		buf.WriteString("Cache not found")
+		return
+	}
 
 	// Send back JSON response
-	err = factomapi.SafeMarshal(buf, eBlock)
+	err := factomapi.SafeMarshal(buf, stats)
 	if err != nil {
 		httpcode = 400
-		buf.WriteString("Bad request")
+		buf.WriteString("Bad request ")
 		log.Error(err)
 		return
 	}
 }
 
-func handleEBlockByMR(ctx *web.Context, mrStr string) {
+// handleDBStats returns the keys and bytes of each table of the database, and
+// the compactions of leveldb, in json format.
+func handleDBStats(ctx *web.Context) {
 	log := serverLog
-	log.Debug("handleEBlockByMR")
+	log.Debug("handleDBStats")
 	var httpcode int = 200
 	buf := new(bytes.Buffer)
 
@@ -360,10 +1086,8 @@ func handleEBlockByMR(ctx *web.Context, mrStr string) {
 		ctx.WriteHeader(httpcode)
 		ctx.Write(buf.Bytes())
 	}()
-	log.Info("mrstr:", mrStr)
-	newstr, _ := url.QueryUnescape(mrStr)
-	log.Info("newstr:", newstr)
-	eBlock, err := factomapi.GetEntryBlokByMRStr(newstr)
+
+	stats, err := factomapi.GetStorageStats()
 	if err != nil {
 		httpcode = 400
 		buf.WriteString("Bad Request")
@@ -372,18 +1096,19 @@ func handleEBlockByMR(ctx *web.Context, mrStr string) {
 	}
 
 	// Send back JSON response
-	err = factomapi.SafeMarshal(buf, eBlock)
+	err = factomapi.SafeMarshal(buf, stats)
 	if err != nil {
 		httpcode = 400
-		buf.WriteString("Bad request")
+		buf.WriteString("Bad request ")
 		log.Error(err)
 		return
 	}
 }
 
-func handleEntryByHash(ctx *web.Context, hashStr string) {
+// handleCompact compacts the database, returning when it is done.
+func handleCompact(ctx *web.Context) {
 	log := serverLog
-	log.Debug("handleEBlockByMR")
+	log.Debug("handleCompact")
 	var httpcode int = 200
 	buf := new(bytes.Buffer)
 
@@ -392,30 +1117,100 @@ func handleEntryByHash(ctx *web.Context, hashStr string) {
 		ctx.Write(buf.Bytes())
 	}()
 
-	entry, err := factomapi.GetEntryByHashStr(hashStr)
-	if err != nil {
+	if err := factomapi.CompactDB(); err != nil {
 		httpcode = 400
 		buf.WriteString("Bad Request")
 		log.Error(err)
 		return
 	}
+	buf.WriteString("Compacted")
+}
 
-	// Send back JSON response
-	err = factomapi.SafeMarshal(buf, entry)
+// handleBackup streams a backup of the database, taken while the node runs,
+// for factomdb restore.
+func handleBackup(ctx *web.Context) {
+	log := serverLog
+	log.Debug("handleBackup")
+
+	ctx.Header().Set("Content-Type", "application/octet-stream")
+	ctx.Header().Set("Content-Disposition", "attachment; filename=factomd.backup")
+	ctx.WriteHeader(200)
+
+	// The status has been sent, a failed backup ends without its hash and
+	// is refused by restore
+	info, err := factomapi.BackupDB(ctx)
+	if err != nil {
+		log.Error(err)
+		return
+	}
+	log.Info("Backup of ", info.Keys, " keys with hash ", info.Hash)
+}
+
+// handleRawData will take the kind of a block or entry and its height, hash or
+// merkle root, and return its binary form hex encoded.
+func handleRawData(ctx *web.Context, kind string, key string) {
+	log := serverLog
+	log.Debug("handleRawData")
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	data, err := factomapi.GetRawData(kind, key)
 	if err != nil {
 		httpcode = 400
-		buf.WriteString("Bad request")
+		buf.WriteString("Bad Request")
 		log.Error(err)
 		return
 	}
+	if data == nil {
+		httpcode = 404
+		buf.WriteString("Not found")
+		return
+	}
+
+	buf.WriteString(hex.EncodeToString(data))
 }
 
-// handleEntriesByExtID will get a series of entries and return them as a
-// stream of json objects.
-func handleEntriesByExtID(ctx *web.Context, eid string) {
+// handleRevealChain takes the hex encoded binary first entry of a chain that
+// has been committed with handleCommitChain and submits it to factomapi.
+func handleRevealChain(ctx *web.Context) {
 	log := serverLog
-	log.Debug("handleEntriesByExtID")
+	log.Debug("handleRevealChain")
+	var httpcode int = 200
+	buf := new(bytes.Buffer)
+
+	defer func() {
+		ctx.WriteHeader(httpcode)
+		ctx.Write(buf.Bytes())
+	}()
+
+	e, err := unmarshalEntryParam(ctx.Params["entry"])
+	if err != nil {
+		httpcode = 400
+		buf.WriteString("Bad request ")
+		log.Error(err)
+		return
+	}
 
+	if err := factomapi.SubmitRevealChain(e); err != nil {
+		httpcode = submitErrorCode(err)
+		fmt.Fprintln(buf, "there was a problem with submitting the chain:", err)
+		log.Error(err)
+		return
+	}
+
+	fmt.Fprintln(buf, "Chain Submitted")
+}
+
+// handleRevealEntry takes a hex encoded binary entry that has been committed
+// with handleCommitEntry and submits it to factomapi.
+func handleRevealEntry(ctx *web.Context) {
+	log := serverLog
+	log.Debug("handleRevealEntry")
 	var httpcode int = 200
 	buf := new(bytes.Buffer)
 
@@ -424,24 +1219,22 @@ func handleEntriesByExtID(ctx *web.Context, eid string) {
 		ctx.Write(buf.Bytes())
 	}()
 
-	entries, err := factomapi.GetEntriesByExtID(eid)
+	e, err := unmarshalEntryParam(ctx.Params["entry"])
 	if err != nil {
 		httpcode = 400
-		buf.WriteString("Bad request")
+		buf.WriteString("Bad request ")
 		log.Error(err)
 		return
 	}
 
-	// Send back JSON response
-	for _, entry := range entries {
-		err = factomapi.SafeMarshal(buf, &entry)
-		if err != nil {
-			httpcode = 400
-			buf.WriteString("Bad request")
-			log.Error(err)
-			return
-		}
+	if err := factomapi.SubmitRevealEntry(e); err != nil {
+		httpcode = submitErrorCode(err)
+		fmt.Fprintln(buf, "there was a problem with submitting the entry:", err)
+		log.Error(err)
+		return
 	}
+
+	fmt.Fprintln(buf, "Entry Submitted")
 }
 
 // handleSubmitChain converts a json post to a factomapi.Chain then submits the
@@ -462,7 +1255,7 @@ func handleSubmitChain(ctx *web.Context) {
 			return
 		} else {
             c.FirstEntry.GenerateIDFromName()
-            c.ChainID = &c.FirstEntry.ChainID
+            c.ChainID = c.FirstEntry.ChainID
 		}
 
 		log.Debug("c.ChainID:", c.ChainID.String())
@@ -522,3 +1315,27 @@ func handleSubmitEntry(ctx *web.Context) {
 		ctx.WriteHeader(403)
 	}
 }
+
+// submitErrorCode is the http status for a failed submission. A full queue is
+// reported as 503 so clients know to try again later.
+func submitErrorCode(err error) int {
+	if err == factomapi.ErrQueueFull {
+		return 503
+	}
+	return 400
+}
+
+// unmarshalEntryParam decodes a hex encoded binary entry
+func unmarshalEntryParam(p string) (*common.Entry, error) {
+	data, err := hex.DecodeString(p)
+	if err != nil {
+		return nil, err
+	}
+
+	e := new(common.Entry)
+	if err := e.UnmarshalBinary(data); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
@@ -0,0 +1,155 @@
+package wsapi
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/FactomProject/FactomCode/database/dbgen"
+	"github.com/FactomProject/FactomCode/database/dbsync"
+	"github.com/FactomProject/FactomCode/database/ldb"
+	"github.com/FactomProject/FactomCode/factomapi"
+	"github.com/FactomProject/FactomCode/factomclient"
+)
+
+// TestSyncFromRaw syncs a database from another one served by /v1/raw
+func TestSyncFromRaw(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := ldb.OpenLevelDB(dir+"/src", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	g, err := dbgen.New(dbgen.DefaultConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Generate(src, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	factomapi.SetDB(src)
+	defer factomapi.SetDB(nil)
+	setHandlers()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	dst, err := ldb.OpenLevelDB(dir+"/dst", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	client := factomclient.NewClient(strings.TrimPrefix(ts.URL, "http://"))
+	synced, err := dbsync.NewSyncer(dst, client).Sync(context.Background())
+	if err != nil || synced != 5 {
+		t.Fatalf("synced %d DBlocks: %v", synced, err)
+	}
+
+	want, _ := src.FetchDBlockHead()
+	got, _ := dst.FetchDBlockHead()
+	if got == nil || !got.DBHash.IsSameAs(want.DBHash) {
+		t.Errorf("synced to another head")
+	}
+	if missing, err := dbsync.Check(dst); err != nil || len(missing) != 0 {
+		t.Errorf("%d missing after the sync: %v", len(missing), err)
+	}
+	srcChains, _ := src.FetchAllChains()
+	dstChains, _ := dst.FetchAllChains()
+	if len(dstChains) != len(srcChains) {
+		t.Errorf("synced %d chains of %d", len(dstChains), len(srcChains))
+	}
+
+	// Nothing is left to sync
+	if synced, err := dbsync.NewSyncer(dst, client).Sync(context.Background()); synced != 0 || err != nil {
+		t.Errorf("synced %d DBlocks again: %v", synced, err)
+	}
+}
+
+// TestRepairFromRaw repairs the Entry Blocks missing from a database from
+// another one served by /v1/raw, and counts their chains again
+func TestRepairFromRaw(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wsapi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src, err := ldb.OpenLevelDB(dir+"/src", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	dst, err := ldb.OpenLevelDB(dir+"/dst", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dst.Close()
+
+	// Every chain has an Entry Block in every Directory Block. dst misses
+	// the first Entry Block of one chain and one in the middle of another.
+	cfg := dbgen.DefaultConfig
+	cfg.ChainsPerBlock = cfg.Chains
+	g, err := dbgen.New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for h := 0; h < 4; h++ {
+		b, err := g.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := dbgen.Write(src, b); err != nil {
+			t.Fatal(err)
+		}
+
+		skip := -1
+		if h == 0 || h == 2 {
+			skip = h
+		}
+		for i := range b.EBlocks {
+			if i == skip {
+				b.EBlocks = append(b.EBlocks[:i], b.EBlocks[i+1:]...)
+				b.Entries = append(b.Entries[:i], b.Entries[i+1:]...)
+				break
+			}
+		}
+		if err := dbgen.Write(dst, b); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	factomapi.SetDB(src)
+	defer factomapi.SetDB(nil)
+	setHandlers()
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	missing, err := dbsync.Check(dst)
+	if err != nil || len(missing) != 2 {
+		t.Fatalf("%d missing: %v", len(missing), err)
+	}
+	client := factomclient.NewClient(strings.TrimPrefix(ts.URL, "http://"))
+	if repaired, err := dbsync.NewSyncer(dst, client).Repair(context.Background(), missing); err != nil || repaired != 2 {
+		t.Fatalf("repaired %d: %v", repaired, err)
+	}
+
+	for _, m := range missing {
+		want, _ := src.FetchChainByHash(m.ChainID)
+		got, _ := dst.FetchChainByHash(m.ChainID)
+		if got == nil || got.EBlockCount != want.EBlockCount || got.EntryCount != want.EntryCount ||
+			got.CreatedHeight != want.CreatedHeight || !got.FirstEntryHash.IsSameAs(want.FirstEntryHash) ||
+			!reflect.DeepEqual(got.Name, want.Name) {
+			t.Errorf("chain %s not counted again: %+v, want %+v", m.ChainID.String(), got, want)
+		}
+	}
+}
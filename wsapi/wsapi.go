@@ -27,31 +27,59 @@ var server = web.NewServer()
 // Start runs the wsapi server which
 func Start(db database.Db, inMsgQ chan<- wire.FtmInternalMsg) {
 	factomapi.SetDB(db)
-	factomapi.SetInMsgQueue(inMsgQ)
+	if err := factomapi.StartSubmitQueue(cfg.SubmitQueueSize, cfg.SubmitJournalPath, inMsgQ); err != nil {
+		wsLog.Error(err)
+	}
 
 	wsLog.Debug("Setting handlers")
+	setHandlers()
+
+	wsLog.Info("Starting server")
+	go server.Run("localhost:" + strconv.Itoa(portNumber))
+}
+
+// setHandlers routes the requests of the server to the handlers
+func setHandlers() {
 	server.Post(`/v1/buycredit/?`, handleBuyCredit)
+	server.Post(`/v1/commitchain/?`, handleCommitChain)
+	server.Post(`/v1/compact/?`, handleCompact)
+	server.Post(`/v1/commitentry/?`, handleCommitEntry)
 	server.Post(`/v1/creditbalance/?`, handleCreditBalance)
+	server.Post(`/v1/entrycost/?`, handleEntryCost)
+	server.Post(`/v1/revealchain/?`, handleRevealChain)
+	server.Post(`/v1/revealentry/?`, handleRevealEntry)
 	server.Post(`/v1/submitchain/?`, handleSubmitChain)
 	server.Post(`/v1/submitentry/?`, handleSubmitEntry)
 
 	server.Get(`/v1/dblockheight/?`, handleBlockHeight)
 	server.Get(`/v1/blockheight/?`, handleBlockHeight)
+	server.Get(`/v1/backup/?`, handleBackup)
 	server.Get(`/v1/buycredit/?`, handleBuyCredit)
+	server.Get(`/v1/cachestats/?`, handleCacheStats)
 	server.Get(`/v1/chain/([^/]+)(?)`, handleChainByHash)
+	server.Get(`/v1/chain/([^/]+)/entries/?`, handleChainEntries)
 	server.Get(`/v1/chains/?`, handleChains)
 	server.Get(`/v1/creditbalance/?`, handleCreditBalance)
 	server.Get(`/v1/dblock/([^/]+)(?)`, handleDBlockByHash)
+	server.Get(`/v1/dblockbyheight/([^/]+)(?)`, handleDBlockByHeight)
 	server.Get(`/v1/dbinfo/([^/]+)(?)`, handleDBInfoByHash)
+	server.Get(`/v1/dbstats/?`, handleDBStats)
 	server.Get(`/v1/dblocksbyrange/([^/]+)(?:/([^/]+))?`, handleDBlocksByRange)
 	server.Get(`/v1/eblock/([^/]+)(?)`, handleEBlockByMR)
 	server.Get(`/v1/eblockbyhash/([^/]+)(?)`, handleEBlockByHash)
+	server.Get(`/v1/eblockbyheight/([^/]+)/([^/]+)(?)`, handleEBlockByHeight)
 	server.Get(`/v1/eblockbymr/([^/]+)(?)`, handleEBlockByMR)
+	server.Get(`/v1/ecaddress/([^/]+)/history/?`, handleECAddressHistory)
+	server.Get(`/v1/ecbalanceproof/([^/]+)(?)`, handleECBalanceProof)
+	server.Get(`/v1/ecblock/([^/]+)(?)`, handleCBlockByHash)
+	server.Get(`/v1/ecblockbyheight/([^/]+)(?)`, handleCBlockByHeight)
+	server.Get(`/v1/ecblocksbyrange/([^/]+)(?:/([^/]+))?`, handleCBlocksByRange)
 	server.Get(`/v1/entry/([^/]+)(?)`, handleEntryByHash)
+	server.Get(`/v1/entrycost/?`, handleEntryCost)
 	server.Get(`/v1/entriesbyeid/([^/]+)(?)`, handleEntriesByExtID)
-
-	wsLog.Info("Starting server")
-	go server.Run("localhost:" + strconv.Itoa(portNumber))
+	server.Get(`/v1/events/?`, handleEvents)
+	server.Get(`/v1/queuestats/?`, handleQueueStats)
+	server.Get(`/v1/raw/([^/]+)/([^/]+)(?)`, handleRawData)
 }
 
 func Stop() {